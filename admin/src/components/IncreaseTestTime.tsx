@@ -1,61 +1,148 @@
-import React, { useState } from 'react';
+import React, { useEffect, useState } from 'react'
+import { Card, CardContent } from '@/components/ui/card'
+import { Input } from '@/components/ui/input'
+import { Button } from '@/components/ui/button'
+import { Label } from '@/components/ui/label'
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from '@/components/ui/select'
+import { useToast } from '@/hooks/use-toast'
+import { Batch, Test } from '@common/types'
+import api from '@/lib/api'
 
-const IncreaseTestTime: React.FC = () => {
-  const [testPassword, setTestPassword] = useState('');
-  const [additionalTime, setAdditionalTime] = useState('');
-  const [message, setMessage] = useState('');
+// every test the candidates are taking
+const ALL_TESTS = 'all'
+
+export default function IncreaseTestTime() {
+  const [mode, setMode] = useState<'users' | 'batch'>('users')
+  const [usernames, setUsernames] = useState('')
+  const [batch, setBatch] = useState('')
+  const [testId, setTestId] = useState(ALL_TESTS)
+  const [minutes, setMinutes] = useState('')
+  const [batches, setBatches] = useState<Batch[]>([])
+  const [tests, setTests] = useState<Test[]>([])
+  const { toast } = useToast()
+
+  useEffect(() => {
+    async function fetchOptions() {
+      try {
+        const batchResponse = await api.get(`${import.meta.env.SERVER_URL}/batch/get_batches`)
+        setBatches(batchResponse.data.data ?? [])
+        const testResponse = await api.get(`${import.meta.env.SERVER_URL}/test/get_all_tests`)
+        setTests(testResponse.data.tests ?? [])
+      } catch (error) {
+        console.error('Error fetching batches and tests:', error)
+      }
+    }
+    fetchOptions()
+  }, [])
 
   const handleSubmit = async (e: React.FormEvent<HTMLFormElement>) => {
-    e.preventDefault();
-    // Implement the logic to increase test time here
-    console.log({ testPassword, additionalTime });
-    setMessage('Test time increased successfully!');
-  };
+    e.preventDefault()
+
+    const body = {
+      usernames: mode === 'users' ? usernames.split(',').map(u => u.trim()).filter(u => u !== '') : [],
+      batch: mode === 'batch' ? batch : '',
+      test_id: testId === ALL_TESTS ? '' : testId,
+      minutes: parseInt(minutes),
+    }
+
+    try {
+      const response = await api.post(`${import.meta.env.SERVER_URL}/admin/increase_test_time`, body)
+      toast({
+        title: "Time increased",
+        description: response.data.message,
+      })
+      setMinutes('')
+    } catch (error: any) {
+      console.error('Error increasing test time:', error)
+      toast({
+        variant: "destructive",
+        title: "Failed to increase time",
+        description: error.response?.data?.error ?? "Please try again later.",
+      })
+    }
+  }
 
   return (
-    <div className="max-w-md mx-auto mt-10">
-      <h2 className="text-2xl font-bold mb-4">Increase Test Time</h2>
-      <form onSubmit={handleSubmit} className="space-y-4">
-        <div>
-          <label htmlFor="testPassword" className="block mb-1">
-            Test Password:
-          </label>
-          <input
-            type="password"
-            id="testPassword"
-            value={testPassword}
-            onChange={(e) => setTestPassword(e.target.value)}
-            required
-            className="w-full px-3 py-2 border rounded-md"
-          />
-        </div>
-        <div>
-          <label htmlFor="additionalTime" className="block mb-1">
-            Additional Time (in minutes):
-          </label>
-          <input
-            type="number"
-            id="additionalTime"
-            value={additionalTime}
-            onChange={(e) => setAdditionalTime(e.target.value)}
-            required
-            className="w-full px-3 py-2 border rounded-md"
-          />
-        </div>
-        <button
-          type="submit"
-          className="w-full bg-green-500 text-white py-2 rounded-md hover:bg-green-600"
-        >
-          Increase Time
-        </button>
-      </form>
-      {message && (
-        <div className="mt-4 p-2 bg-green-100 text-green-700 rounded">
-          {message}
-        </div>
-      )}
-    </div>
-  );
-};
+    <div className="w-full mx-auto p-4 space-y-6">
+      <h1 className="text-3xl font-bold mb-8">Increase Test Time</h1>
+      <Card>
+        <CardContent className="p-6 w-full">
+          <form onSubmit={handleSubmit} className="space-y-4">
+            <div className="space-y-2">
+              <Label>Give time to</Label>
+              <Select value={mode} onValueChange={(value) => setMode(value as 'users' | 'batch')}>
+                <SelectTrigger>
+                  <SelectValue />
+                </SelectTrigger>
+                <SelectContent>
+                  <SelectItem value="users">Candidates</SelectItem>
+                  <SelectItem value="batch">Whole batch</SelectItem>
+                </SelectContent>
+              </Select>
+            </div>
 
-export default IncreaseTestTime;
+            {mode === 'users' ? (
+              <div className="space-y-2">
+                <Label htmlFor="usernames">Usernames (comma separated)</Label>
+                <Input
+                  type="text"
+                  id="usernames"
+                  value={usernames}
+                  onChange={(e) => setUsernames(e.target.value)}
+                  placeholder="e.g. user1, user2"
+                  required
+                />
+              </div>
+            ) : (
+              <div className="space-y-2">
+                <Label>Batch</Label>
+                <Select value={batch} onValueChange={setBatch}>
+                  <SelectTrigger>
+                    <SelectValue placeholder="Select batch" />
+                  </SelectTrigger>
+                  <SelectContent>
+                    {batches.map((b) => (
+                      <SelectItem key={b.Id} value={b.Name}>{b.Name}</SelectItem>
+                    ))}
+                  </SelectContent>
+                </Select>
+              </div>
+            )}
+
+            <div className="space-y-2">
+              <Label>Test</Label>
+              <Select value={testId} onValueChange={setTestId}>
+                <SelectTrigger>
+                  <SelectValue />
+                </SelectTrigger>
+                <SelectContent>
+                  <SelectItem value={ALL_TESTS}>All running tests</SelectItem>
+                  {tests.map((test) => (
+                    <SelectItem key={test.Id} value={test.Id}>{test.TestName}</SelectItem>
+                  ))}
+                </SelectContent>
+              </Select>
+            </div>
+
+            <div className="space-y-2">
+              <Label htmlFor="minutes">Additional Time (minutes)</Label>
+              <Input
+                type="number"
+                id="minutes"
+                value={minutes}
+                onChange={(e) => setMinutes(e.target.value)}
+                placeholder="Enter minutes"
+                min="1"
+                required
+              />
+            </div>
+
+            <Button type="submit" className="w-full mt-4" disabled={mode === 'batch' && batch === ''}>
+              Increase Time
+            </Button>
+          </form>
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
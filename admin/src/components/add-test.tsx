@@ -10,6 +10,7 @@ import { Alert, AlertDescription } from '@/components/ui/alert';
 import api from '@/lib/api';
 import { X } from 'lucide-react';
 import { useToast } from '@/hooks/use-toast';
+import { SubmissionPolicy } from '@common/types';
 
 // const testTypes = [
 //   { value: 'typing', label: 'Typing Test' },
@@ -23,6 +24,9 @@ export default function AddTest() {
   const [testType, setTestType] = useState('typing');
   const [duration, setDuration] = useState('');
   const [typingText, setTypingText] = useState('');
+  const [negativeMarks, setNegativeMarks] = useState('');
+  const [submissionPolicy, setSubmissionPolicy] = useState<string>(SubmissionPolicy.SubmitOnce);
+  const [maxAttempts, setMaxAttempts] = useState('');
   const [file, setFile] = useState<any>(null);
   const [testTypes, setTestTypes] = useState([]);
   const { toast } = useToast();
@@ -72,10 +76,17 @@ export default function AddTest() {
     formData.append('testName', testName);
     formData.append('type', testType);
     formData.append('duration', duration.toString());
+    formData.append('submissionPolicy', submissionPolicy);
+    if (submissionPolicy === SubmissionPolicy.SubmitMultiple && maxAttempts !== '') {
+      formData.append('maxAttempts', maxAttempts);
+    }
 
     if (testType === 'typing') {
       formData.append('typingText', typingText);
     } else if (file) {
+      if (testType === 'mcq' && negativeMarks !== '') {
+        formData.append('negativeMarks', negativeMarks);
+      }
       formData.append('file', file);
     }
 
@@ -93,6 +104,9 @@ export default function AddTest() {
       setTestName('');
       setDuration('');
       setTypingText('');
+      setNegativeMarks('');
+      setSubmissionPolicy(SubmissionPolicy.SubmitOnce);
+      setMaxAttempts('');
       setFile(null);
     } catch (error) {
       console.error('Error adding test:', error);
@@ -155,6 +169,49 @@ export default function AddTest() {
               />
             </div>
 
+            <div className="space-y-2">
+              <Label htmlFor="submissionPolicy">Submissions</Label>
+              <Select value={submissionPolicy} onValueChange={setSubmissionPolicy}>
+                <SelectTrigger id="submissionPolicy">
+                  <SelectValue />
+                </SelectTrigger>
+                <SelectContent>
+                  <SelectItem value={SubmissionPolicy.SubmitOnce}>Submit once</SelectItem>
+                  <SelectItem value={SubmissionPolicy.SubmitLastWins}>Resubmit until the deadline, the last one counts</SelectItem>
+                  <SelectItem value={SubmissionPolicy.SubmitMultiple}>Several attempts, each one counts</SelectItem>
+                </SelectContent>
+              </Select>
+            </div>
+
+            {submissionPolicy === SubmissionPolicy.SubmitMultiple && (
+              <div className="space-y-2">
+                <Label htmlFor="maxAttempts">Max Attempts (per session)</Label>
+                <Input
+                  type="number"
+                  id="maxAttempts"
+                  value={maxAttempts}
+                  onChange={(e) => setMaxAttempts(e.target.value)}
+                  placeholder="Unlimited"
+                  min="1"
+                />
+              </div>
+            )}
+
+            {testType === 'mcq' && (
+              <div className="space-y-2">
+                <Label htmlFor="negativeMarks">Negative Marks (per wrong answer)</Label>
+                <Input
+                  type="number"
+                  id="negativeMarks"
+                  value={negativeMarks}
+                  onChange={(e) => setNegativeMarks(e.target.value)}
+                  placeholder="0"
+                  min="0"
+                  step="0.25"
+                />
+              </div>
+            )}
+
             {testType === 'typing' ? (
               <div className="space-y-2">
                 <Label htmlFor="typingText">Typing Text</Label>
@@ -0,0 +1,132 @@
+import React, { useState } from 'react'
+import { Card, CardContent } from '@/components/ui/card'
+import { Input } from '@/components/ui/input'
+import { Button } from '@/components/ui/button'
+import { Label } from '@/components/ui/label'
+import { Badge } from '@/components/ui/badge'
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from '@/components/ui/select'
+import { Table, TableBody, TableCell, TableHead, TableHeader, TableRow } from '@/components/ui/table'
+import { useToast } from '@/hooks/use-toast'
+import { ActivityEvent, ActivityKind } from '@common/types'
+import api from '@/lib/api'
+
+const ALL_KINDS = 'all'
+
+const kindLabels: Record<ActivityKind, string> = {
+  [ActivityKind.TestOpened]: 'Test opened',
+  [ActivityKind.AppLaunched]: 'App launched',
+  [ActivityKind.AppClosed]: 'App closed',
+  [ActivityKind.FocusLost]: 'Left the exam window',
+  [ActivityKind.ForeignWindow]: 'Other window opened',
+  [ActivityKind.SubmissionAttempted]: 'Submission attempted',
+}
+
+// kinds worth a second look
+const suspicious = [ActivityKind.FocusLost, ActivityKind.ForeignWindow]
+
+export default function CandidateActivity() {
+  const [username, setUsername] = useState('')
+  const [kind, setKind] = useState<string>(ALL_KINDS)
+  const [events, setEvents] = useState<ActivityEvent[] | null>(null)
+  const { toast } = useToast()
+
+  const handleSubmit = async (e: React.FormEvent<HTMLFormElement>) => {
+    e.preventDefault()
+
+    const params: Record<string, string> = { username: username.trim() }
+    if (kind !== ALL_KINDS) {
+      params.kind = kind
+    }
+
+    try {
+      const response = await api.get(`${import.meta.env.SERVER_URL}/admin/activity`, { params })
+      setEvents(response.data.events ?? [])
+    } catch (error: any) {
+      console.error('Error fetching activity:', error)
+      toast({
+        variant: "destructive",
+        title: "Failed to fetch activity",
+        description: error.response?.data?.error ?? "Please try again later.",
+      })
+    }
+  }
+
+  return (
+    <div className="w-full mx-auto p-4 space-y-6">
+      <h1 className="text-3xl font-bold mb-8">Candidate Activity</h1>
+      <Card>
+        <CardContent className="p-6 w-full">
+          <form onSubmit={handleSubmit} className="space-y-4">
+            <div className="space-y-2">
+              <Label htmlFor="username">Username</Label>
+              <Input
+                type="text"
+                id="username"
+                value={username}
+                onChange={(e) => setUsername(e.target.value)}
+                placeholder="e.g. user1"
+                required
+              />
+            </div>
+
+            <div className="space-y-2">
+              <Label>Kind</Label>
+              <Select value={kind} onValueChange={setKind}>
+                <SelectTrigger>
+                  <SelectValue />
+                </SelectTrigger>
+                <SelectContent>
+                  <SelectItem value={ALL_KINDS}>Everything</SelectItem>
+                  {Object.values(ActivityKind).map((k) => (
+                    <SelectItem key={k} value={k}>{kindLabels[k]}</SelectItem>
+                  ))}
+                </SelectContent>
+              </Select>
+            </div>
+
+            <Button type="submit" className="w-full mt-4">
+              Show Activity
+            </Button>
+          </form>
+        </CardContent>
+      </Card>
+
+      {events !== null && (
+        <Card>
+          <CardContent className="p-6 w-full">
+            <Table>
+              <TableHeader>
+                <TableRow>
+                  <TableHead>Time</TableHead>
+                  <TableHead>Event</TableHead>
+                  <TableHead>Test</TableHead>
+                  <TableHead>Detail</TableHead>
+                </TableRow>
+              </TableHeader>
+              <TableBody>
+                {events.length === 0 ? (
+                  <TableRow>
+                    <TableCell colSpan={4} className="h-24 text-center">
+                      No activity recorded.
+                    </TableCell>
+                  </TableRow>
+                ) : events.map((event) => (
+                  <TableRow key={event.Id}>
+                    <TableCell>{new Date(event.At).toLocaleString()}</TableCell>
+                    <TableCell>
+                      <Badge variant={suspicious.includes(event.Kind) ? 'destructive' : 'secondary'}>
+                        {kindLabels[event.Kind] ?? event.Kind}
+                      </Badge>
+                    </TableCell>
+                    <TableCell className="font-mono text-sm">{/^0+$/.test(event.TestId) ? '' : event.TestId}</TableCell>
+                    <TableCell>{event.Detail}</TableCell>
+                  </TableRow>
+                ))}
+              </TableBody>
+            </Table>
+          </CardContent>
+        </Card>
+      )}
+    </div>
+  )
+}
@@ -1,11 +1,17 @@
 import { useEffect, useState } from 'react'
 import { Button } from "@/components/ui/button"
-import { PlusCircle, Users, FileSpreadsheet, Database, Menu } from 'lucide-react'
+import { PlusCircle, Users, FileSpreadsheet, Database, Menu, LogOut, Clock, Megaphone, MonitorCheck, ShieldAlert, History, ListChecks } from 'lucide-react'
 import { Sheet, SheetContent, SheetTrigger } from './ui/sheet'
 import AddTest from './add-test'
 import UserDetails from './user-details'
 import AddUser from './add-user'
 import AddBatch from './add-batch'
+import IncreaseTestTime from './IncreaseTestTime'
+import NotifyUsers from './notify-users'
+import LivePresence from './live-presence'
+import CandidateActivity from './candidate-activity'
+import DocumentSnapshots from './document-snapshots'
+import SubmissionHistory from './submission-history'
 import { useNavigate } from 'react-router-dom'
 import api from '@/lib/api'
 
@@ -29,7 +35,13 @@ export default function Dashboard() {
     checkAuthStatus();
   }, [])
 
-  
+  const logout = async () => {
+    try {
+      await api.post(`${import.meta.env.SERVER_URL}/admin/logout`);
+    } finally {
+      navigate('/login');
+    }
+  }
 
   const renderContent = () => {
     switch (activeSection) {
@@ -41,6 +53,18 @@ export default function Dashboard() {
         return <AddUser />
       case 'createBatch':
         return <AddBatch />
+      case 'increaseTime':
+        return <IncreaseTestTime />
+      case 'notifyUsers':
+        return <NotifyUsers />
+      case 'livePresence':
+        return <LivePresence />
+      case 'candidateActivity':
+        return <CandidateActivity />
+      case 'documentSnapshots':
+        return <DocumentSnapshots />
+      case 'submissionHistory':
+        return <SubmissionHistory />
       default:
         return null
     }
@@ -53,6 +77,9 @@ export default function Dashboard() {
           <img src="/WCL_LOGO.png" alt="WCL Logo" className="mr-2 h-10 w-10" />
           <h1 className="text-xl font-bold">WCL Admin Panel</h1>
         </div>
+        <Button variant="ghost" className="text-primary-foreground hidden md:flex" onClick={logout}>
+          <LogOut className="mr-2 h-4 w-4" /> Log out
+        </Button>
         <Sheet>
           <SheetTrigger asChild>
             <Button variant="ghost" className="text-primary-foreground md:hidden">
@@ -89,6 +116,55 @@ export default function Dashboard() {
               >
                 <FileSpreadsheet className="mr-2 h-4 w-4" /> Create Batch
               </Button>
+              <Button
+                variant="ghost"
+                className="w-full justify-start text-blue-600 hover:bg-blue-100"
+                onClick={() => setActiveSection('increaseTime')}
+              >
+                <Clock className="mr-2 h-4 w-4" /> Increase Test Time
+              </Button>
+              <Button
+                variant="ghost"
+                className="w-full justify-start text-blue-600 hover:bg-blue-100"
+                onClick={() => setActiveSection('notifyUsers')}
+              >
+                <Megaphone className="mr-2 h-4 w-4" /> Message Candidates
+              </Button>
+              <Button
+                variant="ghost"
+                className="w-full justify-start text-blue-600 hover:bg-blue-100"
+                onClick={() => setActiveSection('livePresence')}
+              >
+                <MonitorCheck className="mr-2 h-4 w-4" /> Live Candidates
+              </Button>
+              <Button
+                variant="ghost"
+                className="w-full justify-start text-blue-600 hover:bg-blue-100"
+                onClick={() => setActiveSection('candidateActivity')}
+              >
+                <ShieldAlert className="mr-2 h-4 w-4" /> Candidate Activity
+              </Button>
+              <Button
+                variant="ghost"
+                className="w-full justify-start text-blue-600 hover:bg-blue-100"
+                onClick={() => setActiveSection('documentSnapshots')}
+              >
+                <History className="mr-2 h-4 w-4" /> Document Snapshots
+              </Button>
+              <Button
+                variant="ghost"
+                className="w-full justify-start text-blue-600 hover:bg-blue-100"
+                onClick={() => setActiveSection('submissionHistory')}
+              >
+                <ListChecks className="mr-2 h-4 w-4" /> Submission History
+              </Button>
+              <Button
+                variant="ghost"
+                className="w-full justify-start text-blue-600 hover:bg-blue-100"
+                onClick={logout}
+              >
+                <LogOut className="mr-2 h-4 w-4" /> Log out
+              </Button>
             </nav>
           </SheetContent>
         </Sheet>
@@ -124,6 +200,48 @@ export default function Dashboard() {
           >
             <FileSpreadsheet className="mr-2 h-4 w-4" /> Create Batch
           </Button>
+          <Button
+            variant="ghost"
+            className="w-full justify-start text-blue-600 hover:bg-blue-100"
+            onClick={() => setActiveSection('increaseTime')}
+          >
+            <Clock className="mr-2 h-4 w-4" /> Increase Test Time
+          </Button>
+          <Button
+            variant="ghost"
+            className="w-full justify-start text-blue-600 hover:bg-blue-100"
+            onClick={() => setActiveSection('notifyUsers')}
+          >
+            <Megaphone className="mr-2 h-4 w-4" /> Message Candidates
+          </Button>
+          <Button
+            variant="ghost"
+            className="w-full justify-start text-blue-600 hover:bg-blue-100"
+            onClick={() => setActiveSection('livePresence')}
+          >
+            <MonitorCheck className="mr-2 h-4 w-4" /> Live Candidates
+          </Button>
+          <Button
+            variant="ghost"
+            className="w-full justify-start text-blue-600 hover:bg-blue-100"
+            onClick={() => setActiveSection('candidateActivity')}
+          >
+            <ShieldAlert className="mr-2 h-4 w-4" /> Candidate Activity
+          </Button>
+          <Button
+            variant="ghost"
+            className="w-full justify-start text-blue-600 hover:bg-blue-100"
+            onClick={() => setActiveSection('documentSnapshots')}
+          >
+            <History className="mr-2 h-4 w-4" /> Document Snapshots
+          </Button>
+          <Button
+            variant="ghost"
+            className="w-full justify-start text-blue-600 hover:bg-blue-100"
+            onClick={() => setActiveSection('submissionHistory')}
+          >
+            <ListChecks className="mr-2 h-4 w-4" /> Submission History
+          </Button>
         </nav>
 
         {/* Main Content */}
@@ -0,0 +1,148 @@
+import React, { useState } from 'react'
+import { Card, CardContent } from '@/components/ui/card'
+import { Input } from '@/components/ui/input'
+import { Button } from '@/components/ui/button'
+import { Label } from '@/components/ui/label'
+import { Table, TableBody, TableCell, TableHead, TableHeader, TableRow } from '@/components/ui/table'
+import { useToast } from '@/hooks/use-toast'
+import { Snapshot } from '@common/types'
+import api from '@/lib/api'
+
+const formatSize = (bytes: number) => bytes < 1024 ? `${bytes} B` : `${(bytes / 1024).toFixed(1)} KB`
+
+export default function DocumentSnapshots() {
+  const [username, setUsername] = useState('')
+  const [testId, setTestId] = useState('')
+  const [snapshots, setSnapshots] = useState<Snapshot[] | null>(null)
+  const [isRestoring, setIsRestoring] = useState(false)
+  const { toast } = useToast()
+
+  const handleSubmit = async (e: React.FormEvent<HTMLFormElement>) => {
+    e.preventDefault()
+
+    try {
+      const response = await api.get(`${import.meta.env.SERVER_URL}/admin/snapshots`, {
+        params: { username: username.trim(), test_id: testId.trim() },
+      })
+      setSnapshots(response.data.snapshots ?? [])
+    } catch (error: any) {
+      console.error('Error fetching snapshots:', error)
+      toast({
+        variant: "destructive",
+        title: "Failed to fetch snapshots",
+        description: error.response?.data?.error ?? "Please try again later.",
+      })
+    }
+  }
+
+  // sends the latest version to the candidate's app, e.g. on a replacement machine
+  const handleRestore = async () => {
+    setIsRestoring(true)
+    try {
+      const response = await api.post(`${import.meta.env.SERVER_URL}/admin/restore_snapshot`, {
+        username: username.trim(),
+        test_id: testId.trim(),
+      })
+      toast({
+        title: "Snapshot restored",
+        description: response.data.message,
+      })
+    } catch (error: any) {
+      console.error('Error restoring snapshot:', error)
+      toast({
+        variant: "destructive",
+        title: "Failed to restore snapshot",
+        description: error.response?.data?.error ?? "Please try again later.",
+      })
+    } finally {
+      setIsRestoring(false)
+    }
+  }
+
+  return (
+    <div className="w-full mx-auto p-4 space-y-6">
+      <h1 className="text-3xl font-bold mb-8">Document Snapshots</h1>
+      <Card>
+        <CardContent className="p-6 w-full">
+          <form onSubmit={handleSubmit} className="space-y-4">
+            <div className="space-y-2">
+              <Label htmlFor="username">Username</Label>
+              <Input
+                type="text"
+                id="username"
+                value={username}
+                onChange={(e) => setUsername(e.target.value)}
+                placeholder="e.g. user1"
+                required
+              />
+            </div>
+
+            <div className="space-y-2">
+              <Label htmlFor="testId">Test ID</Label>
+              <Input
+                type="text"
+                id="testId"
+                value={testId}
+                onChange={(e) => setTestId(e.target.value)}
+                required
+              />
+            </div>
+
+            <Button type="submit" className="w-full mt-4">
+              Show Snapshots
+            </Button>
+          </form>
+        </CardContent>
+      </Card>
+
+      {snapshots !== null && (
+        <Card>
+          <CardContent className="p-6 w-full space-y-4">
+            <Table>
+              <TableHeader>
+                <TableRow>
+                  <TableHead>Version</TableHead>
+                  <TableHead>Uploaded</TableHead>
+                  <TableHead>Size</TableHead>
+                  <TableHead>Attempt</TableHead>
+                  <TableHead></TableHead>
+                </TableRow>
+              </TableHeader>
+              <TableBody>
+                {snapshots.length === 0 ? (
+                  <TableRow>
+                    <TableCell colSpan={5} className="h-24 text-center">
+                      No snapshots uploaded.
+                    </TableCell>
+                  </TableRow>
+                ) : snapshots.map((snapshot) => (
+                  <TableRow key={snapshot.Id}>
+                    <TableCell>{snapshot.Version}</TableCell>
+                    <TableCell>{new Date(snapshot.TakenAt).toLocaleString()}</TableCell>
+                    <TableCell>{formatSize(snapshot.Size)}</TableCell>
+                    <TableCell className="font-mono text-sm">{snapshot.AttemptId}</TableCell>
+                    <TableCell>
+                      <a
+                        href={`${import.meta.env.SERVER_URL}/admin/storage/${snapshot.FileHash}`}
+                        className="text-blue-600 hover:underline"
+                        download
+                      >
+                        Download
+                      </a>
+                    </TableCell>
+                  </TableRow>
+                ))}
+              </TableBody>
+            </Table>
+
+            {snapshots.length > 0 && (
+              <Button onClick={handleRestore} disabled={isRestoring} className="w-full">
+                Restore Latest Version on the Candidate's Machine
+              </Button>
+            )}
+          </CardContent>
+        </Card>
+      )}
+    </div>
+  )
+}
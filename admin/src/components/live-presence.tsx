@@ -0,0 +1,100 @@
+import { useEffect, useState } from 'react'
+import { Card, CardContent, CardHeader, CardTitle } from '@/components/ui/card'
+import { Badge } from '@/components/ui/badge'
+import { CandidatePresence } from '@common/types'
+import api from '@/lib/api'
+
+const secondsSince = (time: string) => Math.max(0, Math.round((Date.now() - new Date(time).getTime()) / 1000))
+
+export default function LivePresence() {
+  const [candidates, setCandidates] = useState<Record<string, CandidatePresence>>({})
+  const [live, setLive] = useState(false)
+  // re-render every few seconds so "last seen" stays current
+  const [, setTick] = useState(0)
+
+  useEffect(() => {
+    let source: EventSource | null = null
+    let closed = false
+
+    const connect = async () => {
+      try {
+        // also refreshes an expired access token before the stream needs it
+        const response = await api.get(`${import.meta.env.SERVER_URL}/admin/presence`)
+        const snapshot: Record<string, CandidatePresence> = {}
+        for (const presence of response.data.presence as CandidatePresence[]) {
+          snapshot[presence.Username] = presence
+        }
+        setCandidates(snapshot)
+      } catch (error) {
+        console.error('Error fetching presence:', error)
+      }
+      if (closed) {
+        return
+      }
+
+      source = new EventSource(`${import.meta.env.SERVER_URL}/admin/presence/stream`, { withCredentials: true })
+      source.onopen = () => setLive(true)
+      source.addEventListener('presence', (event) => {
+        const presence: CandidatePresence = JSON.parse((event as MessageEvent).data)
+        setCandidates(prev => ({ ...prev, [presence.Username]: presence }))
+      })
+      source.onerror = () => {
+        setLive(false)
+        // the browser retries by itself, unless the server refused the stream
+        if (source?.readyState === EventSource.CLOSED && !closed) {
+          setTimeout(connect, 5000)
+        }
+      }
+    }
+    connect()
+
+    const timer = setInterval(() => setTick(t => t + 1), 5000)
+    return () => {
+      closed = true
+      source?.close()
+      clearInterval(timer)
+    }
+  }, [])
+
+  const batches: Record<string, CandidatePresence[]> = {}
+  for (const presence of Object.values(candidates)) {
+    const batch = presence.Batch || 'No batch'
+    batches[batch] = [...(batches[batch] ?? []), presence]
+  }
+
+  return (
+    <div className="w-full mx-auto p-4 space-y-6">
+      <div className="flex items-center justify-between mb-8">
+        <h1 className="text-3xl font-bold">Live Candidates</h1>
+        <Badge variant={live ? 'default' : 'destructive'}>{live ? 'Live' : 'Reconnecting'}</Badge>
+      </div>
+
+      {Object.keys(batches).length === 0 && (
+        <p className="text-gray-500">No candidate has connected yet.</p>
+      )}
+
+      {Object.entries(batches).sort().map(([batch, members]) => (
+        <Card key={batch}>
+          <CardHeader>
+            <CardTitle>{batch}</CardTitle>
+          </CardHeader>
+          <CardContent className="grid grid-cols-2 md:grid-cols-4 lg:grid-cols-6 gap-3">
+            {members.sort((a, b) => (a.Hostname || a.Username).localeCompare(b.Hostname || b.Username)).map((presence) => (
+              <div
+                key={presence.Username}
+                className={`rounded-md border p-3 text-sm ${presence.Connected ? 'border-green-500 bg-green-50' : 'border-gray-300 bg-gray-100 text-gray-500'}`}
+              >
+                <div className="font-bold">{presence.Hostname || 'unknown machine'}</div>
+                <div>{presence.Username}</div>
+                <div>{presence.Connected ? 'connected' : 'disconnected'} · {secondsSince(presence.LastSeen)}s ago</div>
+                {presence.Route && <div>page: {presence.Route}</div>}
+                {presence.OpenApp && <div>app: {presence.OpenApp}</div>}
+                <div>submitted: {presence.Submitted?.length ?? 0}</div>
+              </div>
+            ))}
+          </CardContent>
+        </Card>
+      ))}
+    </div>
+  )
+}
@@ -0,0 +1,161 @@
+import React, { useEffect, useState } from 'react'
+import { Card, CardContent } from '@/components/ui/card'
+import { Input } from '@/components/ui/input'
+import { Button } from '@/components/ui/button'
+import { Label } from '@/components/ui/label'
+import { Textarea } from '@/components/ui/textarea'
+import { Checkbox } from '@/components/ui/checkbox'
+import { Badge } from '@/components/ui/badge'
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from '@/components/ui/select'
+import { useToast } from '@/hooks/use-toast'
+import { Batch } from '@common/types'
+import api from '@/lib/api'
+
+type Mode = 'users' | 'batch' | 'everyone'
+
+interface Delivery {
+  Username: string
+  Status: 'sent' | 'queued' | 'dropped'
+}
+
+export default function NotifyUsers() {
+  const [mode, setMode] = useState<Mode>('users')
+  const [usernames, setUsernames] = useState('')
+  const [batch, setBatch] = useState('')
+  const [message, setMessage] = useState('')
+  const [warn, setWarn] = useState(false)
+  const [batches, setBatches] = useState<Batch[]>([])
+  const [deliveries, setDeliveries] = useState<Delivery[]>([])
+  const { toast } = useToast()
+
+  useEffect(() => {
+    async function fetchBatches() {
+      try {
+        const response = await api.get(`${import.meta.env.SERVER_URL}/batch/get_batches`)
+        setBatches(response.data.data ?? [])
+      } catch (error) {
+        console.error('Error fetching batches:', error)
+      }
+    }
+    fetchBatches()
+  }, [])
+
+  const handleSubmit = async (e: React.FormEvent<HTMLFormElement>) => {
+    e.preventDefault()
+
+    const body = {
+      usernames: mode === 'users' ? usernames.split(',').map(u => u.trim()).filter(u => u !== '') : [],
+      batch: mode === 'batch' ? batch : '',
+      everyone: mode === 'everyone',
+      message,
+      warn,
+    }
+
+    try {
+      const response = await api.post(`${import.meta.env.SERVER_URL}/admin/notify_users`, body)
+      setDeliveries(response.data.deliveries ?? [])
+      toast({
+        title: "Message sent",
+        description: response.data.message,
+      })
+      setMessage('')
+    } catch (error: any) {
+      console.error('Error sending message:', error)
+      toast({
+        variant: "destructive",
+        title: "Failed to send",
+        description: error.response?.data?.error ?? "Please try again later.",
+      })
+    }
+  }
+
+  return (
+    <div className="w-full mx-auto p-4 space-y-6">
+      <h1 className="text-3xl font-bold mb-8">Message Candidates</h1>
+      <Card>
+        <CardContent className="p-6 w-full">
+          <form onSubmit={handleSubmit} className="space-y-4">
+            <div className="space-y-2">
+              <Label>Send to</Label>
+              <Select value={mode} onValueChange={(value) => setMode(value as Mode)}>
+                <SelectTrigger>
+                  <SelectValue />
+                </SelectTrigger>
+                <SelectContent>
+                  <SelectItem value="users">Candidates</SelectItem>
+                  <SelectItem value="batch">Whole batch</SelectItem>
+                  <SelectItem value="everyone">Everyone</SelectItem>
+                </SelectContent>
+              </Select>
+            </div>
+
+            {mode === 'users' && (
+              <div className="space-y-2">
+                <Label htmlFor="usernames">Usernames (comma separated)</Label>
+                <Input
+                  type="text"
+                  id="usernames"
+                  value={usernames}
+                  onChange={(e) => setUsernames(e.target.value)}
+                  placeholder="e.g. user1, user2"
+                  required
+                />
+              </div>
+            )}
+
+            {mode === 'batch' && (
+              <div className="space-y-2">
+                <Label>Batch</Label>
+                <Select value={batch} onValueChange={setBatch}>
+                  <SelectTrigger>
+                    <SelectValue placeholder="Select batch" />
+                  </SelectTrigger>
+                  <SelectContent>
+                    {batches.map((b) => (
+                      <SelectItem key={b.Id} value={b.Name}>{b.Name}</SelectItem>
+                    ))}
+                  </SelectContent>
+                </Select>
+              </div>
+            )}
+
+            <div className="space-y-2">
+              <Label htmlFor="message">Message</Label>
+              <Textarea
+                id="message"
+                value={message}
+                onChange={(e) => setMessage(e.target.value)}
+                placeholder="e.g. 10 minutes remaining"
+                required
+              />
+            </div>
+
+            <div className="flex items-center space-x-2">
+              <Checkbox id="warn" checked={warn} onCheckedChange={(checked) => setWarn(checked === true)} />
+              <Label htmlFor="warn">Show as a warning</Label>
+            </div>
+
+            <Button type="submit" className="w-full mt-4" disabled={mode === 'batch' && batch === ''}>
+              Send
+            </Button>
+          </form>
+        </CardContent>
+      </Card>
+
+      {deliveries.length > 0 && (
+        <Card>
+          <CardContent className="p-6 w-full space-y-2">
+            {deliveries.map((delivery) => (
+              <div key={delivery.Username} className="flex justify-between">
+                <span>{delivery.Username}</span>
+                <Badge variant={delivery.Status === 'dropped' ? 'destructive' : delivery.Status === 'sent' ? 'default' : 'secondary'}>
+                  {delivery.Status}
+                </Badge>
+              </div>
+            ))}
+          </CardContent>
+        </Card>
+      )}
+    </div>
+  )
+}
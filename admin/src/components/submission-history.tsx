@@ -0,0 +1,121 @@
+import React, { useState } from 'react'
+import { Card, CardContent } from '@/components/ui/card'
+import { Input } from '@/components/ui/input'
+import { Button } from '@/components/ui/button'
+import { Label } from '@/components/ui/label'
+import { Table, TableBody, TableCell, TableHead, TableHeader, TableRow } from '@/components/ui/table'
+import { useToast } from '@/hooks/use-toast'
+import { TestSubmission } from '@common/types'
+import api from '@/lib/api'
+
+// the submission that counts is the latest one of an attempt that is not superseded
+const submissionState = (submission: TestSubmission) => {
+  if (submission.Superseded) {
+    return <span className="text-gray-500">replaced</span>
+  }
+  if (submission.Late) {
+    return <span className="text-amber-600">counts (late)</span>
+  }
+  return <span className="text-green-600">counts</span>
+}
+
+export default function SubmissionHistory() {
+  const [username, setUsername] = useState('')
+  const [testId, setTestId] = useState('')
+  const [submissions, setSubmissions] = useState<TestSubmission[] | null>(null)
+  const { toast } = useToast()
+
+  const handleSubmit = async (e: React.FormEvent<HTMLFormElement>) => {
+    e.preventDefault()
+
+    const params: Record<string, string> = { username: username.trim() }
+    if (testId.trim() !== '') {
+      params.test_id = testId.trim()
+    }
+
+    try {
+      const response = await api.get(`${import.meta.env.SERVER_URL}/admin/submissions`, { params })
+      setSubmissions(response.data.submissions ?? [])
+    } catch (error: any) {
+      console.error('Error fetching submissions:', error)
+      toast({
+        variant: "destructive",
+        title: "Failed to fetch submissions",
+        description: error.response?.data?.error ?? "Please try again later.",
+      })
+    }
+  }
+
+  return (
+    <div className="w-full mx-auto p-4 space-y-6">
+      <h1 className="text-3xl font-bold mb-8">Submission History</h1>
+      <Card>
+        <CardContent className="p-6 w-full">
+          <form onSubmit={handleSubmit} className="space-y-4">
+            <div className="space-y-2">
+              <Label htmlFor="username">Username</Label>
+              <Input
+                type="text"
+                id="username"
+                value={username}
+                onChange={(e) => setUsername(e.target.value)}
+                placeholder="e.g. user1"
+                required
+              />
+            </div>
+
+            <div className="space-y-2">
+              <Label htmlFor="testId">Test ID (optional)</Label>
+              <Input
+                type="text"
+                id="testId"
+                value={testId}
+                onChange={(e) => setTestId(e.target.value)}
+                placeholder="All tests"
+              />
+            </div>
+
+            <Button type="submit" className="w-full mt-4">
+              Show Submissions
+            </Button>
+          </form>
+        </CardContent>
+      </Card>
+
+      {submissions !== null && (
+        <Card>
+          <CardContent className="p-6 w-full">
+            <Table>
+              <TableHeader>
+                <TableRow>
+                  <TableHead>Submitted</TableHead>
+                  <TableHead>Test</TableHead>
+                  <TableHead>Attempt</TableHead>
+                  <TableHead>Status</TableHead>
+                  <TableHead>Submission ID</TableHead>
+                </TableRow>
+              </TableHeader>
+              <TableBody>
+                {submissions.length === 0 ? (
+                  <TableRow>
+                    <TableCell colSpan={5} className="h-24 text-center">
+                      No submissions found.
+                    </TableCell>
+                  </TableRow>
+                ) : submissions.map((submission) => (
+                  <TableRow key={submission.Id}>
+                    <TableCell>{submission.SubmittedAt ? new Date(submission.SubmittedAt).toLocaleString() : '-'}</TableCell>
+                    <TableCell className="font-mono text-sm">{submission.TestId}</TableCell>
+                    <TableCell>{submission.AttemptNumber ?? 1}</TableCell>
+                    <TableCell>{submissionState(submission)}</TableCell>
+                    <TableCell className="font-mono text-sm">{submission.ClientSubmissionId ?? '-'}</TableCell>
+                  </TableRow>
+                ))}
+              </TableBody>
+            </Table>
+          </CardContent>
+        </Card>
+      )}
+    </div>
+  )
+}
@@ -8,4 +8,31 @@ const api = axios.create({
   }
 });
 
-export default api;
\ No newline at end of file
+// access tokens are short lived. on a 401, trade the refresh cookie for a new one and
+// retry once. concurrent requests share a single refresh
+let refreshing: Promise<unknown> | null = null;
+
+api.interceptors.response.use(undefined, async (error) => {
+  const request = error.config;
+  const url: string = request?.url ?? '';
+  if (error.response?.status !== 401 || !request || request._retried || url.includes('/admin/refresh') || url.includes('/admin/login')) {
+    return Promise.reject(error);
+  }
+
+  if (!refreshing) {
+    refreshing = api.post('/admin/refresh').finally(() => {
+      refreshing = null;
+    });
+  }
+
+  try {
+    await refreshing;
+  } catch {
+    return Promise.reject(error);
+  }
+
+  request._retried = true;
+  return api(request);
+});
+
+export default api;
@@ -6,13 +6,23 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
+// how long the office app gets to write the file after it was told to save
+const forceSaveWait = 3 * time.Second
+
 type App struct {
-	send   chan common.Message
-	recv   chan common.Message
-	runner IRunner
-	client *Client
+	send    chan common.Message
+	recv    chan common.Message
+	runner  IRunner
+	client  *Client
+	outbox  *Outbox
+	journal *Journal
+	// session the app was killed in the middle of, until the candidate resumes or drops it
+	resumable *journalState
 
 	exitCtx context.Context
 	exitFn  context.CancelFunc
@@ -22,8 +32,21 @@ type App struct {
 		connection_started bool
 	}
 	test_state struct {
+		mutex     sync.Mutex
 		submitted map[common.ID]bool
 		tests     map[common.ID]string
+		// when the server will stop accepting each started test. derived from the time the
+		// server says is left, so a wrong clock on this machine does not matter
+		deadlines map[common.ID]time.Time
+		// latest answers of typing and mcq tests as the ui reported them. submitted when the
+		// server ends the exam before the candidate does
+		drafts map[common.ID]common.TestSubmission
+		// where each submission is on its way to the server
+		sync map[common.ID]common.TSubmissionStatus
+		// hash of the document last uploaded as a snapshot, by test id
+		snapshots map[common.ID]string
+		// test the candidate opened last. activity the runner reports is tied to it
+		current common.ID
 	}
 }
 
@@ -45,15 +68,38 @@ func newApp() (*App, error) {
 	}
 	app.test_state.submitted = make(map[common.ID]bool)
 	app.test_state.tests = make(map[common.ID]string)
+	app.test_state.deadlines = make(map[common.ID]time.Time)
+	app.test_state.drafts = make(map[common.ID]common.TestSubmission)
+	app.test_state.sync = make(map[common.ID]common.TSubmissionStatus)
+	app.test_state.snapshots = make(map[common.ID]string)
 	var err error
 
+	datadir, err := dataDir()
+	if err != nil {
+		return nil, err
+	}
+	app.outbox, err = openOutbox(filepath.Join(datadir, "outbox"))
+	if err != nil {
+		return nil, err
+	}
+	app.journal, err = openJournal(datadir)
+	if err != nil {
+		return nil, err
+	}
+	app.resumable, err = app.journal.load()
+	if err != nil {
+		log.Println("dropping saved session:", err)
+		app.clearJournal()
+	}
+
 	client, err := newClient(app.send)
 	if err != nil {
 		return nil, err
 	}
 	app.client = client
+	client.tokensChanged = app.saveJournal
 
-	app.runner, err = NewRunner(app.send)
+	app.runner, err = NewRunner(app.send, app.reportActivity)
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +107,17 @@ func newApp() (*App, error) {
 	return app, nil
 }
 
+// sends what the candidate did to the server. activity without a test belongs to the test
+// opened last
+func (self *App) reportActivity(activity common.TActivity) {
+	if activity.TestId.IsZero() {
+		self.test_state.mutex.Lock()
+		activity.TestId = self.test_state.current
+		self.test_state.mutex.Unlock()
+	}
+	self.client.reportActivity(activity)
+}
+
 func (self *App) login(user_login *common.TUserLoginRequest) error {
 	err := self.client.login(user_login)
 	if err != nil {
@@ -70,6 +127,9 @@ func (self *App) login(user_login *common.TUserLoginRequest) error {
 		self.send <- errorMessage
 		return err
 	}
+	self.resumable = nil
+	self.restoreQueued(self.client.currentUser().Username)
+	self.saveJournal()
 
 	return nil
 }
@@ -82,6 +142,8 @@ func (self *App) maintainConnection() {
 
 	go self.client.maintainConn()
 	go self.handleServerMessages()
+	go self.uploadSubmissions()
+	go self.autosave()
 }
 
 func (self *App) handleServerMessages() {
@@ -98,14 +160,152 @@ func (self *App) handleServerMessages() {
 		}
 
 		switch msg.Typ {
+		case common.Notification, common.WarnUser:
+			// announcements from proctors go straight to the ui
+			self.send <- msg
+		case common.DeadlineChanged:
+			val, err := common.Get[common.TDeadlineChanged](msg)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			self.deadlineChanged(val)
+		case common.TestFinished:
+			self.finishTests()
+		case common.RestoreSnapshot:
+			val, err := common.Get[common.TRestoreSnapshot](msg)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			err = self.restoreSnapshot(val)
+			if err != nil {
+				self.notifyErr(fmt.Errorf("could not restore your work: %v", err))
+			}
 		default:
 			log.Printf("message type '%s' not handled ('%s')\n", msg.Typ.TSName(), msg.Val)
 		}
 	}
 }
 
+func (self *App) setDeadline(testId common.ID, remaining int64) {
+	self.test_state.mutex.Lock()
+	defer self.test_state.mutex.Unlock()
+
+	self.test_state.deadlines[testId] = time.Now().Add(time.Duration(remaining) * time.Second)
+}
+
+// the message may have waited on the server while we were offline, so ask for the time
+// that is left now and only fall back to the one in the message
+func (self *App) deadlineChanged(val *common.TDeadlineChanged) {
+	status, err := self.client.attemptStatus(val.TestId)
+	if err == nil {
+		val.Remaining = status.Remaining
+	} else {
+		log.Println(err)
+	}
+	self.setDeadline(val.TestId, val.Remaining)
+	self.saveJournal()
+
+	self.send <- common.NewMessage(*val)
+	self.send <- common.NewMessage(common.TNotification{
+		Message: fmt.Sprintf("You have been given %d more minutes", val.Minutes),
+		Typ:     "default",
+	})
+}
+
+func (self *App) isSubmitted(testId common.ID) bool {
+	self.test_state.mutex.Lock()
+	defer self.test_state.mutex.Unlock()
+
+	return self.test_state.submitted[testId]
+}
+
+// whether the candidate's work on a test no longer counts: it is submitted and a new
+// submission would not replace the old one. whether the time is up is left to the server,
+// which adds a grace period to the deadline
+func (self *App) isClosed(testId common.ID) bool {
+	if !self.isSubmitted(testId) {
+		return false
+	}
+	test, err := self.findTestById(testId)
+	return err != nil || test.SubmissionPolicy != common.SubmitLastWins
+}
+
+func (self *App) setDraft(draft common.TestSubmission) {
+	self.test_state.mutex.Lock()
+	defer self.test_state.mutex.Unlock()
+
+	self.test_state.drafts[draft.TestId] = draft
+}
+
+// the file the candidate works on for an office test, if they opened it
+func (self *App) testFile(testId common.ID) (string, bool) {
+	self.test_state.mutex.Lock()
+	defer self.test_state.mutex.Unlock()
+
+	path, ok := self.test_state.tests[testId]
+	return path, ok
+}
+
+// saves the document in the open office app, if any, and closes it
+func (self *App) closeOpenApp() {
+	if !self.runner.IsAppOpen() {
+		return
+	}
+	err := self.runner.ForceSave()
+	if err != nil {
+		log.Println("could not save the open app:", err)
+	}
+	// give the app a moment to write the file
+	time.Sleep(forceSaveWait)
+	err = self.runner.KillApp()
+	if err != nil {
+		log.Println("could not close the open app:", err)
+	}
+	self.setOpenApp("")
+}
+
+// the server ended the exam. saves and closes the open office app, submits whatever the
+// candidate has for every test that is not submitted yet and moves the ui to the end
+func (self *App) finishTests() {
+	self.closeOpenApp()
+
+	for _, test := range self.client.tests {
+		if self.isSubmitted(test.Id) {
+			continue
+		}
+
+		self.test_state.mutex.Lock()
+		submission, ok := self.test_state.drafts[test.Id]
+		self.test_state.mutex.Unlock()
+		if !ok {
+			submission = common.TestSubmission{
+				TestId:   test.Id,
+				TestInfo: common.TestInfo{Type: test.Type},
+			}
+		}
+		err := self.submit(&submission)
+		if err != nil {
+			log.Printf("could not submit test '%s': %v", test.TestName, err)
+		}
+	}
+
+	self.clearJournal()
+
+	self.send <- common.NewMessage(common.TNotification{
+		Message: "The exam is over. Your work has been submitted",
+		Typ:     "default",
+	})
+	self.send <- common.NewMessage(common.TTestFinished{})
+}
+
 func (self *App) startTest() error {
-	tests, err := self.client.getTests(self.client.user.Batch)
+	user := self.client.currentUser()
+	if user == nil {
+		return fmt.Errorf("not logged in")
+	}
+	tests, err := self.client.getTests(user.Batch)
 	self.client.tests = tests
 
 	if err != nil {
@@ -5,11 +5,17 @@ import (
 	"common"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -20,11 +26,23 @@ var server_url string
 // https / wss
 var server_is_secure string
 
+// the server revoked our session (or it expired). only a new login helps
+var errSessionEnded = errors.New("your session has ended. please log in again")
+
 type Client struct {
 	client http.Client
-	jwt    string
-	user   *common.User
-	tests  []common.Test
+	// jwt is short lived. refreshToken gets a new one from the server
+	auth struct {
+		mutex        sync.Mutex
+		jwt          string
+		refreshToken string
+		// the logged in user, nil before login. the uploader and autosave read it while
+		// login or resume set it
+		user *common.User
+	}
+	// called after the tokens were refreshed, e.g. to save them
+	tokensChanged func()
+	tests         []common.CandidateTest
 
 	server struct {
 		conn         *websocket.Conn
@@ -41,6 +59,14 @@ type Client struct {
 	frontend struct {
 		send chan<- common.Message
 	}
+
+	// what this machine is doing, for the proctors. sent in full whenever the connection
+	// comes up, since changes made while offline are not queued
+	presence struct {
+		mutex  sync.Mutex
+		state  common.TPresence
+		online bool
+	}
 }
 
 func newClient(send chan<- common.Message) (*Client, error) {
@@ -52,6 +78,13 @@ func newClient(send chan<- common.Message) (*Client, error) {
 	self.server.send = make(chan common.Message, 100)
 	self.server.recv = make(chan common.Message, 100)
 
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Println("could not get hostname:", err)
+	}
+	self.presence.state.Hostname = hostname
+	self.presence.state.OS = runtime.GOOS
+
 	ctx, destroy := context.WithCancel(context.Background())
 	self.exit.ctx = ctx
 	self.exit.destroy = destroy
@@ -74,6 +107,42 @@ func (self *Client) notifyErr(err error) {
 	}
 }
 
+// applies a change to the presence of this machine and tells the server, if connected
+func (self *Client) setPresence(change func(presence *common.TPresence)) {
+	self.presence.mutex.Lock()
+	defer self.presence.mutex.Unlock()
+
+	old := self.presence.state
+	change(&self.presence.state)
+	if !self.presence.online || old == self.presence.state {
+		return
+	}
+	select {
+	case self.server.send <- common.NewMessage(self.presence.state):
+	default:
+		log.Println("server send queue is full, dropping presence")
+	}
+}
+
+func (self *Client) setOnline(online bool) {
+	self.presence.mutex.Lock()
+	defer self.presence.mutex.Unlock()
+
+	self.presence.online = online
+}
+
+// tells the server what the candidate did. waits in the send queue while offline
+func (self *Client) reportActivity(activity common.TActivity) {
+	if activity.At.IsZero() {
+		activity.At = time.Now()
+	}
+	select {
+	case self.server.send <- common.NewMessage(activity):
+	default:
+		log.Printf("server send queue is full, dropping activity '%s'\n", activity.Kind)
+	}
+}
+
 func (self *Client) closeServerConn() {
 	if self.server.conn == nil {
 		return
@@ -115,32 +184,215 @@ func (self *Client) login(user_login *common.TUserLoginRequest) error {
 		return err
 	}
 
-	self.jwt = result.Jwt
-	self.user = &result.User
-	log.Println(self.user)
+	self.setTokens(&result)
+	self.setUser(&result.User)
+	log.Println(result.User)
+
+	return nil
+}
+
+func (self *Client) setTokens(result *common.UserLoginResponse) {
+	self.auth.mutex.Lock()
+	defer self.auth.mutex.Unlock()
+
+	self.auth.jwt = result.Jwt
+	self.auth.refreshToken = result.RefreshToken
+}
+
+func (self *Client) setUser(user *common.User) {
+	self.auth.mutex.Lock()
+	defer self.auth.mutex.Unlock()
+
+	self.auth.user = user
+}
+
+// the logged in user, nil if there is none
+func (self *Client) currentUser() *common.User {
+	self.auth.mutex.Lock()
+	defer self.auth.mutex.Unlock()
+
+	return self.auth.user
+}
+
+func (self *Client) tokens() (string, string) {
+	self.auth.mutex.Lock()
+	defer self.auth.mutex.Unlock()
+
+	return self.auth.jwt, self.auth.refreshToken
+}
+
+func (self *Client) jwt() string {
+	self.auth.mutex.Lock()
+	defer self.auth.mutex.Unlock()
+
+	return self.auth.jwt
+}
+
+// trades the refresh token for a new jwt. staleJwt is the jwt the server refused. if
+// someone else already refreshed it, there is nothing to do
+func (self *Client) refresh(staleJwt string) error {
+	err := self.renewTokens(staleJwt)
+	if err == nil && self.tokensChanged != nil {
+		self.tokensChanged()
+	}
+	return err
+}
+
+func (self *Client) renewTokens(staleJwt string) error {
+	self.auth.mutex.Lock()
+	defer self.auth.mutex.Unlock()
+
+	if self.auth.jwt != staleJwt {
+		return nil
+	}
+	if self.auth.refreshToken == "" {
+		return errSessionEnded
+	}
+
+	json_data, err := json.Marshal(common.UserRefreshRequest{RefreshToken: self.auth.refreshToken})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", server_url+"/user/refresh", bytes.NewBuffer(json_data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		self.auth.jwt = ""
+		self.auth.refreshToken = ""
+		return errSessionEnded
+	}
+	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	var result common.UserLoginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
 
+	self.auth.jwt = result.Jwt
+	self.auth.refreshToken = result.RefreshToken
 	return nil
 }
 
+// sends req with the jwt. if the server refuses the jwt, refreshes it and tries once more
+func (self *Client) authorizedDo(req *http.Request) (*http.Response, error) {
+	jwt := self.jwt()
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	resp, err := self.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	err = self.refresh(jwt)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", "Bearer "+self.jwt())
+	return self.client.Do(retry)
+}
+
+// the server answered, but not with a success
+type ServerError struct {
+	Status  int
+	Message string
+	// what went wrong, for the requests that say so. e.g. "already_submitted" when submitting
+	Code string
+}
+
+func (self *ServerError) Error() string {
+	return self.Message
+}
+
+// the server's reason for refusing a request, if it gave one
+func responseError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error != "" {
+		return &ServerError{Status: resp.StatusCode, Message: body.Error, Code: body.Code}
+	}
+	return &ServerError{Status: resp.StatusCode, Message: resp.Status}
+}
+
+// reconnect delays grow from reconnectMinDelay to reconnectMaxDelay. the random part keeps
+// a lab full of apps from reconnecting all at once after the server restarts
+const reconnectMinDelay = time.Second
+const reconnectMaxDelay = 30 * time.Second
+
+// how long a connection has to stay up before the reconnect delays start over
+const stableConnection = time.Minute
+
+func reconnectDelay(failures int) time.Duration {
+	delay := reconnectMaxDelay
+	if failures < 16 {
+		delay = min(reconnectMinDelay<<failures, reconnectMaxDelay)
+	}
+	// somewhere between half of it and all of it
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
 func (self *Client) maintainConn() {
+	failures := 0
 	for {
 		ctx, close := context.WithCancel(context.Background())
 
 		err := self.connect(ctx, close)
 
+		if errors.Is(err, errSessionEnded) {
+			// logged in somewhere else or revoked by an admin. reconnecting won't work
+			close()
+			self.notifyErr(err)
+			return
+		}
 		if err != nil {
 			log.Println(err)
 			close()
+			failures++
 		}
+		connectedAt := time.Now()
 
 		// block till connection breaks
 		<-ctx.Done()
+		self.setOnline(false)
+
+		if err == nil {
+			// a connection that drops right after it was made counts as a failure, so the
+			// delays still grow when the server keeps dropping us
+			if time.Since(connectedAt) >= stableConnection {
+				failures = 0
+			} else {
+				failures++
+			}
+		}
 
+		delay := reconnectDelay(failures)
 		select {
 		case <-self.exit.ctx.Done():
 			return
 		default:
-			msg := "server disconnected. trying reconnection in 5 seconds..."
+			msg := fmt.Sprintf("server disconnected. trying reconnection in %d seconds...", int(delay.Seconds()+0.5))
 			log.Println(msg)
 			self.notifyErr(fmt.Errorf(msg))
 		}
@@ -149,7 +401,7 @@ func (self *Client) maintainConn() {
 		case <-self.exit.ctx.Done():
 			log.Println("terminating connection with server")
 			return
-		case <-time.After(time.Second * 5):
+		case <-time.After(delay):
 			continue
 		}
 	}
@@ -169,28 +421,64 @@ func (self *Client) connect(exit context.Context, cancel context.CancelFunc) err
 
 	log.Println(url)
 
-	header := http.Header{}
-	header.Add("Authorization", "Bearer "+self.jwt)
+	dial := func(jwt string) (*websocket.Conn, *http.Response, error) {
+		header := http.Header{}
+		header.Add("Authorization", "Bearer "+jwt)
+		return websocket.DefaultDialer.Dial(url.String(), header)
+	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(url.String(), header)
+	jwt := self.jwt()
+	conn, resp, err := dial(jwt)
+	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+		err = self.refresh(jwt)
+		if err != nil {
+			return err
+		}
+		conn, _, err = dial(self.jwt())
+	}
 	if err != nil {
 		return err
 	}
 	self.server.conn = conn
 
+	self.presence.mutex.Lock()
+	conn.SetWriteDeadline(time.Now().Add(time.Second * 5))
+	err = conn.WriteJSON(common.NewMessage(self.presence.state))
+	self.presence.online = err == nil
+	self.presence.mutex.Unlock()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	pingInterval := envDuration("WS_PING_INTERVAL", 5*time.Second)
+	pongTimeout := envDuration("WS_PONG_TIMEOUT", 15*time.Second)
+
 	go func() {
 		defer cancel()
+		// also stops the reader below
+		defer conn.Close()
+
+		ping := time.NewTicker(pingInterval)
+		defer ping.Stop()
+
 		for {
 			select {
 			case <-exit.Done():
 				return
+			case <-ping.C:
+				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second*5))
+				if err != nil {
+					log.Println(err)
+					return
+				}
 			case msg, ok := <-self.server.send:
 				if !ok {
 					return
 				}
 				log.Println(msg)
-				self.server.conn.SetWriteDeadline(time.Now().Add(time.Second * 5))
-				err := self.server.conn.WriteJSON(msg)
+				conn.SetWriteDeadline(time.Now().Add(time.Second * 5))
+				err := conn.WriteJSON(msg)
 				if err != nil {
 					log.Println(err)
 					return
@@ -201,13 +489,33 @@ func (self *Client) connect(exit context.Context, cancel context.CancelFunc) err
 	}()
 	go func() {
 		defer cancel()
+
+		// a server that stays silent (no message, ping or pong) for pongTimeout is gone
+		alive := func() {
+			conn.SetReadDeadline(time.Now().Add(pongTimeout))
+		}
+		alive()
+		conn.SetPongHandler(func(string) error {
+			alive()
+			return nil
+		})
+		conn.SetPingHandler(func(data string) error {
+			alive()
+			err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second*5))
+			if err == websocket.ErrCloseSent {
+				return nil
+			}
+			return err
+		})
+
 		for {
 			var msg common.Message
-			err := self.server.conn.ReadJSON(&msg)
+			err := conn.ReadJSON(&msg)
 			if err != nil {
 				log.Println(err)
 				return
 			}
+			alive()
 			self.server.recv <- msg
 		}
 	}()
@@ -215,65 +523,193 @@ func (self *Client) connect(exit context.Context, cancel context.CancelFunc) err
 	return nil
 }
 
-func (self *Client) getTests(batchName string) ([]common.Test, error) {
+// WS_PING_INTERVAL and WS_PONG_TIMEOUT, same as on the server
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("invalid %s '%s'. using %s", key, value, fallback)
+		return fallback
+	}
+	return duration
+}
+
+func (self *Client) getTests(batchName string) ([]common.CandidateTest, error) {
 	url := server_url + "/batch/tests/" + batchName
 	log.Println(url)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return []common.Test{}, err
+		return []common.CandidateTest{}, err
 	}
 	req.Header.Set("content-type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+self.jwt)
 
-	resp, err := self.client.Do(req)
+	resp, err := self.authorizedDo(req)
 	if err != nil {
-		return []common.Test{}, err
+		return []common.CandidateTest{}, err
 	}
 	defer resp.Body.Close()
 
 	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
-		return []common.Test{}, fmt.Errorf("%s", resp.Status)
+		return []common.CandidateTest{}, fmt.Errorf("%s", resp.Status)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return []common.Test{}, err
+		return []common.CandidateTest{}, err
 	}
 
 	log.Println(string(body))
 
-	var result []common.Test
+	var result []common.CandidateTest
 	if err := json.Unmarshal(body, &result); err != nil {
-		return []common.Test{}, err
+		return []common.CandidateTest{}, err
 	}
 
 	return result, nil
 }
 
-func (self *Client) submitTest(submission common.TestSubmission) error {
+// asks the server to start the clock for a test. asking again returns the running attempt
+func (self *Client) startAttempt(testId common.ID) (*common.AttemptStatus, error) {
+	req, err := http.NewRequest("POST", server_url+"/test/start/"+testId.Hex(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", "application/json")
+	return self.doAttemptRequest(req)
+}
+
+// the clock of the latest attempt at a test. unlike startAttempt it never starts one
+func (self *Client) attemptStatus(testId common.ID) (*common.AttemptStatus, error) {
+	req, err := http.NewRequest("GET", server_url+"/test/status/"+testId.Hex(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return self.doAttemptRequest(req)
+}
+
+func (self *Client) doAttemptRequest(req *http.Request) (*common.AttemptStatus, error) {
+	resp, err := self.authorizedDo(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return nil, responseError(resp)
+	}
+
+	var status common.AttemptStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// uploads a submission of the logged in user. the server takes the user from the token.
+// replayed is set when the server already had this submission
+func (self *Client) submitTest(submission common.TestSubmission) (replayed bool, err error) {
 	url := server_url + "/test/submit"
 
+	submission.UserId = common.ID{}
 	jsonData, err := json.Marshal(submission)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return err
+		return false, err
 	}
 	req.Header.Set("content-type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+self.jwt)
 
-	resp, err := self.client.Do(req)
+	resp, err := self.authorizedDo(req)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer resp.Body.Close()
 
 	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
-		return fmt.Errorf("%s", resp.Status)
+		return false, responseError(resp)
 	}
 
-	return nil
+	var body struct {
+		Replayed bool `json:"replayed"`
+	}
+	// older servers answer with an empty body
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	return body.Replayed, nil
+}
+
+// uploads the document of an office test. the server keeps it as the next version of the
+// running attempt
+func (self *Client) uploadSnapshot(testId common.ID, data []byte) (*common.Snapshot, error) {
+	url := server_url + "/test/snapshot/" + testId.Hex()
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", "application/octet-stream")
+
+	resp, err := self.authorizedDo(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return nil, responseError(resp)
+	}
+
+	var snapshot common.Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// the latest snapshot of the user's running attempt at a test
+func (self *Client) downloadSnapshot(testId common.ID) ([]byte, error) {
+	req, err := http.NewRequest("GET", server_url+"/test/snapshot/"+testId.Hex(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := self.authorizedDo(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return nil, responseError(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// the file of a test. files on the server are fetched with the user's token, the token is
+// not sent anywhere else
+func (self *Client) downloadTestFile(fileUrl string) ([]byte, error) {
+	req, err := http.NewRequest("GET", fileUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *http.Response
+	if strings.HasPrefix(fileUrl, server_url+"/") {
+		resp, err = self.authorizedDo(req)
+	} else {
+		resp, err = self.client.Do(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return nil, responseError(resp)
+	}
+	return io.ReadAll(resp.Body)
 }
@@ -4,7 +4,9 @@ import (
 	assets "app"
 	types "common"
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 )
 
 const template_docx = "template.docx"
@@ -28,6 +30,8 @@ type IRunner interface {
 	FocusOrOpenApp(typ types.AppType, file_path string) error
 	FocusOpenApp() error
 	IsAppOpen() bool
+	// saves the document in the open app, if any
+	ForceSave() error
 	KillApp() error
 }
 
@@ -51,7 +55,7 @@ func (self *Runner) NewTemplate(typ types.AppType) (string, error) {
 		return "", fmt.Errorf("unknown app type %d", typ)
 	}
 
-	file, err := os.CreateTemp("", tmp)
+	file, err := os.CreateTemp(documentsDir(), tmp)
 	if err != nil {
 		return "", err
 	}
@@ -65,6 +69,21 @@ func (self *Runner) NewTemplate(typ types.AppType) (string, error) {
 	return dest, nil
 }
 
+// where the documents of office tests are created. kept with the app's data rather than in
+// the temp directory, so a resumed session still finds them after a reboot
+func documentsDir() string {
+	datadir, err := dataDir()
+	if err == nil {
+		dir := filepath.Join(datadir, "documents")
+		err = os.MkdirAll(dir, os.ModePerm)
+		if err == nil {
+			return dir
+		}
+	}
+	log.Println("using the temp directory for documents:", err)
+	return ""
+}
+
 func (self *Runner) newTemplate(name string, dest string) error {
 	// NOTE: non os specific path separaters
 	path := fmt.Sprintf("templates/%s", name)
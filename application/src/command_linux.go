@@ -16,8 +16,9 @@ import (
 )
 
 type Runner struct {
-	send  chan<- types.Message
-	paths struct {
+	send   chan<- types.Message
+	report func(types.TActivity)
+	paths  struct {
 		kill       string
 		excel      string
 		notepad    string
@@ -32,9 +33,10 @@ type Runner struct {
 	}
 }
 
-func NewRunner(send chan<- types.Message) (*Runner, error) {
+func NewRunner(send chan<- types.Message, report func(types.TActivity)) (*Runner, error) {
 	runner := &Runner{
-		send: send,
+		send:   send,
+		report: report,
 	}
 
 	runner.CheckApps()
@@ -130,6 +132,18 @@ func (self *Runner) KillApp() error {
 	return nil
 }
 
+func (self *Runner) ForceSave() error {
+	if !self.isOpen() {
+		return nil
+	}
+	err := self.FocusOpenApp()
+	if err != nil {
+		return err
+	}
+	robotgo.KeyTap("s", "ctrl")
+	return nil
+}
+
 func (self *Runner) IsAppOpen() bool {
 	return self.isOpen()
 }
@@ -57,6 +57,7 @@ type Runner struct {
 		powerpoint string
 	}
 	send         chan<- types.Message
+	report       func(types.TActivity)
 	webview_hwnd win.HWND
 	this_pid     uint32
 	state        struct {
@@ -71,9 +72,10 @@ type Runner struct {
 	exitClose context.CancelFunc
 }
 
-func NewRunner(send chan<- types.Message) (*Runner, error) {
+func NewRunner(send chan<- types.Message, report func(types.TActivity)) (*Runner, error) {
 	runner := &Runner{}
 	runner.send = send
+	runner.report = report
 
 	ctx, close := context.WithCancel(context.Background())
 	runner.exitCtx = ctx
@@ -398,6 +400,13 @@ func (self *Runner) forceSaveInApp() error {
 	return nil
 }
 
+func (self *Runner) ForceSave() error {
+	if !self.isOpen() {
+		return nil
+	}
+	return self.forceSaveInApp()
+}
+
 func (self *Runner) IsAppOpen() bool {
 	return self.isOpen()
 }
@@ -513,6 +522,7 @@ func (self *Runner) preventDistractions(ctx context.Context) {
 		_ = win.SetWindowPos(hwnd, 1, 0, 0, 0, 0, win.SWP_NOMOVE|win.SWP_NOSIZE)
 		// _ = win.PostMessage(hwnd, win.WM_CLOSE, 0, 0)
 		self.send <- types.NewMessage(types.TWarnUser{Message: "Unknown open application detected. Please do not open any other application during test"})
+		self.report(types.TActivity{Kind: types.ActivityForeignWindow, Detail: title})
 	}
 
 	for {
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"common"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const journalFile = "session.journal"
+const journalKeyFile = "journal.key"
+
+// everything needed to pick a session up again after the app died
+type journalState struct {
+	User         common.User
+	Jwt          string
+	RefreshToken string
+	// office documents of the tests, by test id
+	Files     map[common.ID]string
+	Submitted map[common.ID]bool
+	Deadlines map[common.ID]time.Time
+	Drafts    map[common.ID]common.TestSubmission
+	Current   common.ID
+	SavedAt   time.Time
+}
+
+// the session of the logged in candidate, encrypted with AES-GCM. the key is kept in the
+// os key store (DPAPI on windows, the keyring on linux), see journalkey_*.go
+type Journal struct {
+	dir   string
+	mutex sync.Mutex
+	aead  cipher.AEAD
+}
+
+// a stored journal key that can never be read back. a key store that can not be asked right
+// now is not one, a new key would drop a journal that is still good
+var errBrokenJournalKey = errors.New("journal key can not be used")
+
+func openJournal(dir string) (*Journal, error) {
+	key, err := loadJournalKey(dir)
+	if err == nil && len(key) != 32 {
+		err = fmt.Errorf("%w: it has %d bytes", errBrokenJournalKey, len(key))
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case errors.Is(err, errBrokenJournalKey):
+			// a journal written with the old key can not be read anymore and is dropped
+			log.Printf("%v, making a new one", err)
+		default:
+			return nil, fmt.Errorf("could not load the journal key: %v", err)
+		}
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		err = storeJournalKey(dir, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newJournal(dir, key)
+}
+
+func newJournal(dir string, key []byte) (*Journal, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{dir: dir, aead: aead}, nil
+}
+
+func (self *Journal) save(state *journalState) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	state.SavedAt = time.Now()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, self.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	return writeFileAtomic(self.dir, journalFile, self.aead.Seal(nonce, nonce, data, nil))
+}
+
+// the saved session. nil if there is none
+func (self *Journal) load() (*journalState, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(self.dir, journalFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	size := self.aead.NonceSize()
+	if len(data) < size {
+		return nil, fmt.Errorf("journal is truncated")
+	}
+	data, err = self.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("journal can't be decrypted: %v", err)
+	}
+
+	var state journalState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (self *Journal) clear() error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	err := os.Remove(filepath.Join(self.dir, journalFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// replaces dir/name with data, so a crash leaves either the old or the new contents
+func writeFileAtomic(dir string, name string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+// writes the session of the logged in candidate to the journal
+func (self *App) saveJournal() {
+	user := self.client.currentUser()
+	if user == nil {
+		return
+	}
+	state := journalState{User: *user}
+	state.Jwt, state.RefreshToken = self.client.tokens()
+
+	self.test_state.mutex.Lock()
+	state.Files = maps.Clone(self.test_state.tests)
+	state.Submitted = maps.Clone(self.test_state.submitted)
+	state.Deadlines = maps.Clone(self.test_state.deadlines)
+	state.Drafts = maps.Clone(self.test_state.drafts)
+	state.Current = self.test_state.current
+	self.test_state.mutex.Unlock()
+
+	err := self.journal.save(&state)
+	if err != nil {
+		log.Println("could not save the session:", err)
+	}
+}
+
+// the exam is over for this candidate, nothing left to resume
+func (self *App) clearJournal() {
+	self.resumable = nil
+	err := self.journal.clear()
+	if err != nil {
+		log.Println("could not clear the session:", err)
+	}
+}
+
+// picks up the session in the journal where it was cut short, or throws it away
+func (self *App) resume(resume bool) error {
+	state := self.resumable
+	self.resumable = nil
+	if state == nil {
+		return fmt.Errorf("there is no session to resume")
+	}
+	if !resume {
+		self.clearJournal()
+		return nil
+	}
+
+	self.test_state.mutex.Lock()
+	for testId, path := range state.Files {
+		// a document that is gone can't be reopened. the candidate starts it again
+		if _, err := os.Stat(path); err != nil {
+			log.Printf("document of test '%s' is gone: %v\n", testId.Hex(), err)
+			continue
+		}
+		self.test_state.tests[testId] = path
+	}
+	maps.Copy(self.test_state.submitted, state.Submitted)
+	maps.Copy(self.test_state.deadlines, state.Deadlines)
+	maps.Copy(self.test_state.drafts, state.Drafts)
+	self.test_state.current = state.Current
+	self.test_state.mutex.Unlock()
+
+	self.client.setTokens(&common.UserLoginResponse{
+		User:         state.User,
+		Jwt:          state.Jwt,
+		RefreshToken: state.RefreshToken,
+	})
+	self.client.setUser(&state.User)
+	self.restoreQueued(state.User.Username)
+	self.maintainConnection()
+
+	// fetches the tests with the saved tokens and moves the ui to them
+	err := self.startTest()
+	if err != nil {
+		return fmt.Errorf("could not resume the session, please log in again: %v", err)
+	}
+	self.saveJournal()
+	return nil
+}
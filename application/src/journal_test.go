@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"common"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testJournal(t *testing.T, dir string, fill byte) *Journal {
+	t.Helper()
+	journal, err := newJournal(dir, bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return journal
+}
+
+func TestJournalSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	journal := testJournal(t, dir, 1)
+
+	state, err := journal.load()
+	if err != nil || state != nil {
+		t.Fatalf("empty journal: got %v, %v", state, err)
+	}
+
+	testId := primitive.NewObjectID()
+	deadline := time.Now().Add(time.Hour).Round(0)
+	saved := &journalState{
+		User:         common.User{Username: "alice", Batch: "b1"},
+		Jwt:          "access",
+		RefreshToken: "refresh",
+		Files:        map[common.ID]string{testId: "/tmp/test.docx"},
+		Submitted:    map[common.ID]bool{testId: true},
+		Deadlines:    map[common.ID]time.Time{testId: deadline},
+		Current:      testId,
+	}
+	if err := journal.save(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, journalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("refresh")) {
+		t.Error("journal has the refresh token in plain text")
+	}
+
+	state, err = journal.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.User.Username != "alice" || state.Jwt != "access" || state.RefreshToken != "refresh" ||
+		state.Files[testId] != "/tmp/test.docx" || !state.Submitted[testId] ||
+		!state.Deadlines[testId].Equal(deadline) || state.Current != testId {
+		t.Errorf("loaded %+v, saved %+v", state, saved)
+	}
+
+	if err := journal.clear(); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := journal.load(); err != nil || state != nil {
+		t.Fatalf("cleared journal: got %v, %v", state, err)
+	}
+	if err := journal.clear(); err != nil {
+		t.Fatalf("clearing twice: %v", err)
+	}
+}
+
+func TestJournalTampered(t *testing.T) {
+	dir := t.TempDir()
+	journal := testJournal(t, dir, 1)
+	if err := journal.save(&journalState{User: common.User{Username: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, journalFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := bytes.Clone(data)
+	flipped[len(flipped)-1] ^= 1
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"flipped bit", flipped},
+		{"truncated", data[:len(data)-4]},
+		{"shorter than a nonce", data[:4]},
+		{"empty", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := os.WriteFile(path, c.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if state, err := journal.load(); err == nil {
+				t.Fatalf("got %+v, want an error", state)
+			}
+		})
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testJournal(t, dir, 2).load(); err == nil {
+		t.Fatal("journal was read with another key")
+	}
+}
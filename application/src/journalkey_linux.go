@@ -0,0 +1,89 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// the journal key is kept in the user's keyring through secret-tool (libsecret). without a
+// keyring it falls back to a plain journal.key, which only keeps out readers that do not
+// look next to the journal
+
+var journalKeyAttrs = []string{"application", "gravishken", "key", "journal"}
+
+func loadJournalKey(dir string) ([]byte, error) {
+	out, err := exec.Command("secret-tool", append([]string{"lookup"}, journalKeyAttrs...)...).Output()
+	if err == nil && len(out) > 0 {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBrokenJournalKey, err)
+		}
+		return key, nil
+	}
+
+	// secret-tool is not installed, or it found no key and says nothing about it. any other
+	// failure may be the keyring being busy or locked, so it must not lead to a new key
+	var lookupErr error
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil, errors.Is(err, exec.ErrNotFound):
+	case errors.As(err, &exitErr):
+		stderr := strings.TrimSpace(string(exitErr.Stderr))
+		if exitErr.ExitCode() != 1 || stderr != "" {
+			lookupErr = fmt.Errorf("secret-tool lookup: %v %s", err, stderr)
+		}
+	default:
+		lookupErr = fmt.Errorf("secret-tool lookup: %v", err)
+	}
+
+	key, err := os.ReadFile(filepath.Join(dir, journalKeyFile))
+	if errors.Is(err, os.ErrNotExist) && lookupErr != nil {
+		// the keyring may have the key of a journal that is still there. without a journal
+		// there is nothing to lose and a new key is made
+		if _, statErr := os.Stat(filepath.Join(dir, journalFile)); statErr == nil {
+			return nil, lookupErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lookupErr != nil {
+		// without a keyring the key stays in the plain file
+		return key, nil
+	}
+	// move a plain key into the keyring once there is one
+	err = storeJournalKey(dir, key)
+	if err != nil {
+		log.Println("could not store the journal key:", err)
+	}
+	return key, nil
+}
+
+func storeJournalKey(dir string, key []byte) error {
+	args := append([]string{"store", "--label=Gravishken session key"}, journalKeyAttrs...)
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = strings.NewReader(base64.StdEncoding.EncodeToString(key))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		// the keyring has it now, no plain copy is needed
+		err = os.Remove(filepath.Join(dir, journalKeyFile))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	log.Printf("no keyring to keep the journal key in (%v %s), it is stored in plain text", err, strings.TrimSpace(stderr.String()))
+	return writeFileAtomic(dir, journalKeyFile, key)
+}
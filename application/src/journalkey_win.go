@@ -0,0 +1,48 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// the journal key is kept in journal.key encrypted with DPAPI, so only the windows user that
+// wrote it can read it back
+
+func loadJournalKey(dir string) ([]byte, error) {
+	blob, err := os.ReadFile(filepath.Join(dir, journalKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) == 0 {
+		return nil, nil
+	}
+
+	in := windows.DataBlob{Size: uint32(len(blob)), Data: &blob[0]}
+	var out windows.DataBlob
+	err = windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		// e.g. written by another windows user
+		return nil, fmt.Errorf("%w: %v", errBrokenJournalKey, err)
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...), nil
+}
+
+func storeJournalKey(dir string, key []byte) error {
+	in := windows.DataBlob{Size: uint32(len(key)), Data: &key[0]}
+	var out windows.DataBlob
+	err := windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	return writeFileAtomic(dir, journalKeyFile, unsafe.Slice(out.Data, out.Size))
+}
@@ -31,11 +31,10 @@ func main() {
 	_ = godotenv.Overload()
 
 	if runtime.GOOS == "windows" {
-		// NOTE: APPDATA is set on windows automatically
-		datadir := filepath.Join(os.Getenv("APPDATA"), "Gravishken")
-		_ = os.Mkdir(datadir, os.ModePerm)
-
-		_ = godotenv.Overload(filepath.Join(datadir, ".env"))
+		datadir, err := dataDir()
+		if err == nil {
+			_ = godotenv.Overload(filepath.Join(datadir, ".env"))
+		}
 	}
 
 	url, ok := os.LookupEnv("SERVER_URL")
@@ -102,3 +101,18 @@ func main() {
 	}
 
 }
+
+// where the app keeps what has to outlive it. %APPDATA%\Gravishken on windows (APPDATA is
+// set there automatically), ~/.config/Gravishken on linux
+func dataDir() (string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(config, "Gravishken")
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"common"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// what the server says when the attempt already has a submission. submissions queued before
+// they got a ClientSubmissionId rely on it to tell that an earlier upload made it, the server
+// recognises the others by their id. servers that do not send codes only send the message
+const alreadySubmittedCode = "already_submitted"
+const alreadySubmittedError = "test was already submitted"
+
+type queuedSubmission struct {
+	// only uploaded while this user is logged in
+	Username   string
+	Submission common.TestSubmission
+	QueuedAt   time.Time
+}
+
+// submissions that are saved on this machine but not on the server yet. each one is a file
+// in dir, so they survive restarts. the server refused the ones with a .rejected extension,
+// they are kept so the work is not lost
+type Outbox struct {
+	dir    string
+	mutex  sync.Mutex
+	queued map[string]queuedSubmission
+	// something was queued or a user logged in
+	wake chan struct{}
+}
+
+func openOutbox(dir string) (*Outbox, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &Outbox{
+		dir:    dir,
+		queued: make(map[string]queuedSubmission),
+		wake:   make(chan struct{}, 1),
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var queued queuedSubmission
+		err = json.Unmarshal(data, &queued)
+		if err != nil {
+			log.Printf("skipping broken queued submission '%s': %v\n", file, err)
+			continue
+		}
+		self.queued[filepath.Base(file)] = queued
+	}
+	if len(self.queued) > 0 {
+		log.Printf("%d submissions waiting to be uploaded\n", len(self.queued))
+	}
+	return self, nil
+}
+
+// the id the server uses to recognise a submission the app uploads again
+func newSubmissionId() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// a test may be submitted more than once, so submissions with an id get a file of their own
+func outboxFile(username string, submission *common.TestSubmission) string {
+	if submission.ClientSubmissionId == "" {
+		return fmt.Sprintf("%s_%x.json", submission.TestId.Hex(), username)
+	}
+	return fmt.Sprintf("%s_%x_%s.json", submission.TestId.Hex(), username, submission.ClientSubmissionId)
+}
+
+// writes the submission to disk. it is safe from a crash once this returns
+func (self *Outbox) add(username string, submission common.TestSubmission) error {
+	queued := queuedSubmission{
+		Username:   username,
+		Submission: submission,
+		QueuedAt:   time.Now(),
+	}
+	data, err := json.Marshal(queued)
+	if err != nil {
+		return err
+	}
+
+	name := outboxFile(username, &submission)
+	err = writeFileAtomic(self.dir, name, data)
+	if err != nil {
+		return err
+	}
+
+	self.mutex.Lock()
+	self.queued[name] = queued
+	self.mutex.Unlock()
+
+	self.notify()
+	return nil
+}
+
+// submissions of a user that are still waiting, oldest first
+func (self *Outbox) pending(username string) []queuedSubmission {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	pending := []queuedSubmission{}
+	for _, queued := range self.queued {
+		if queued.Username == username {
+			pending = append(pending, queued)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].QueuedAt.Before(pending[j].QueuedAt)
+	})
+	return pending
+}
+
+// the server has it
+func (self *Outbox) done(queued queuedSubmission) error {
+	name := outboxFile(queued.Username, &queued.Submission)
+
+	self.mutex.Lock()
+	delete(self.queued, name)
+	self.mutex.Unlock()
+
+	err := os.Remove(filepath.Join(self.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// the server won't take it. keeps the file aside instead of retrying
+func (self *Outbox) reject(queued queuedSubmission) error {
+	name := outboxFile(queued.Username, &queued.Submission)
+
+	self.mutex.Lock()
+	delete(self.queued, name)
+	self.mutex.Unlock()
+
+	path := filepath.Join(self.dir, name)
+	return os.Rename(path, strings.TrimSuffix(path, ".json")+".rejected")
+}
+
+func (self *Outbox) notify() {
+	select {
+	case self.wake <- struct{}{}:
+	default:
+	}
+}
+
+// the server looked at the request and refused it for good. a missing login or a busy
+// server is worth waiting out
+func refusedForGood(err error) bool {
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	switch serverErr.Status {
+	case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return serverErr.Status < http.StatusInternalServerError
+}
+
+// the server has this submission already. with a ClientSubmissionId it says so with a
+// success, a conflict means it refused the submission
+func alreadySubmitted(submission *common.TestSubmission, err error) bool {
+	var serverErr *ServerError
+	if submission.ClientSubmissionId != "" || !errors.As(err, &serverErr) || serverErr.Status != http.StatusConflict {
+		return false
+	}
+	if serverErr.Code != "" {
+		return serverErr.Code == alreadySubmittedCode
+	}
+	return serverErr.Message == alreadySubmittedError
+}
+
+// uploads queued submissions until the app exits. retries with growing delays while the
+// server can't be reached
+func (self *App) uploadSubmissions() {
+	failures := 0
+	for {
+		var retry <-chan time.Time
+		if self.uploadPending() {
+			failures = 0
+		} else {
+			retry = time.After(reconnectDelay(failures))
+			failures++
+		}
+
+		select {
+		case <-self.exitCtx.Done():
+			return
+		case <-self.outbox.wake:
+		case <-retry:
+		}
+	}
+}
+
+// tries every submission of the logged in user once. false if any has to be tried again
+func (self *App) uploadPending() bool {
+	user := self.client.currentUser()
+	if user == nil {
+		return true
+	}
+
+	for _, queued := range self.outbox.pending(user.Username) {
+		testId := queued.Submission.TestId
+
+		replayed, err := self.client.submitTest(queued.Submission)
+		if replayed {
+			log.Printf("server already had submission of test '%s'\n", testId.Hex())
+		}
+		switch {
+		case err == nil || alreadySubmitted(&queued.Submission, err):
+			if err := self.outbox.done(queued); err != nil {
+				log.Println("could not remove uploaded submission:", err)
+			}
+			self.setSyncStatus(common.TSubmissionStatus{TestId: testId, Status: common.SyncUploaded})
+			self.send <- common.NewMessage(common.TNotification{
+				Message: fmt.Sprintf("%s uploaded to the server", self.testName(testId)),
+				Typ:     "success",
+			})
+		case refusedForGood(err):
+			log.Printf("server rejected submission of test '%s': %v\n", testId.Hex(), err)
+			if err := self.outbox.reject(queued); err != nil {
+				log.Println("could not set rejected submission aside:", err)
+			}
+			self.setSyncStatus(common.TSubmissionStatus{TestId: testId, Status: common.SyncRejected, Message: err.Error()})
+			self.notifyErr(fmt.Errorf("the server did not accept %s: %v. please tell the examiner", self.testName(testId), err))
+		default:
+			log.Printf("could not upload submission of test '%s': %v\n", testId.Hex(), err)
+			self.setSyncStatus(common.TSubmissionStatus{TestId: testId, Status: common.SyncQueued, Message: err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+// tells the ui where a submission is. unchanged statuses are not sent again
+func (self *App) setSyncStatus(status common.TSubmissionStatus) {
+	self.test_state.mutex.Lock()
+	old, ok := self.test_state.sync[status.TestId]
+	self.test_state.sync[status.TestId] = status
+	self.test_state.mutex.Unlock()
+
+	if ok && old == status {
+		return
+	}
+	self.send <- common.NewMessage(status)
+}
+
+func (self *App) testName(testId common.ID) string {
+	test, err := self.findTestById(testId)
+	if err != nil {
+		return "the test"
+	}
+	return fmt.Sprintf("'%s'", test.TestName)
+}
+
+// queued submissions of the user count as submitted. called once the user is known
+func (self *App) restoreQueued(username string) {
+	for _, queued := range self.outbox.pending(username) {
+		self.test_state.mutex.Lock()
+		self.test_state.submitted[queued.Submission.TestId] = true
+		self.test_state.mutex.Unlock()
+		self.setSyncStatus(common.TSubmissionStatus{TestId: queued.Submission.TestId, Status: common.SyncQueued})
+	}
+	self.outbox.notify()
+}
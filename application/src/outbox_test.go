@@ -0,0 +1,156 @@
+package main
+
+import (
+	"common"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func mustOpenOutbox(t *testing.T, dir string) *Outbox {
+	t.Helper()
+	outbox, err := openOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outbox
+}
+
+func pendingIds(outbox *Outbox, username string) []string {
+	ids := []string{}
+	for _, queued := range outbox.pending(username) {
+		ids = append(ids, queued.Submission.ClientSubmissionId)
+	}
+	return ids
+}
+
+func TestOutbox(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	outbox := mustOpenOutbox(t, dir)
+	testId := primitive.NewObjectID()
+
+	for _, add := range []struct{ username, id string }{
+		{"alice", "first"},
+		{"bob", "other"},
+		{"alice", "second"},
+		{"alice", "third"},
+	} {
+		err := outbox.add(add.username, common.TestSubmission{TestId: testId, ClientSubmissionId: add.id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fmt.Sprint(pendingIds(outbox, "alice")); got != "[first second third]" {
+		t.Fatalf("pending of alice: %s", got)
+	}
+	select {
+	case <-outbox.wake:
+	default:
+		t.Error("adding did not wake the uploader")
+	}
+
+	// a broken file does not keep the others from loading
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	outbox = mustOpenOutbox(t, dir)
+	pending := outbox.pending("alice")
+	if got := fmt.Sprint(pendingIds(outbox, "alice")); got != "[first second third]" {
+		t.Fatalf("pending of alice after a restart: %s", got)
+	}
+
+	if err := outbox.done(pending[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.reject(pending[1]); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(pendingIds(outbox, "alice")); got != "[third]" {
+		t.Fatalf("pending of alice: %s", got)
+	}
+
+	// what the server has is gone, what it refused is kept aside
+	outbox = mustOpenOutbox(t, dir)
+	if got := fmt.Sprint(pendingIds(outbox, "alice")); got != "[third]" {
+		t.Fatalf("pending of alice after a restart: %s", got)
+	}
+	if got := fmt.Sprint(pendingIds(outbox, "bob")); got != "[other]" {
+		t.Fatalf("pending of bob: %s", got)
+	}
+	rejected, err := filepath.Glob(filepath.Join(dir, "*.rejected"))
+	if err != nil || len(rejected) != 1 {
+		t.Fatalf("rejected files %v, %v", rejected, err)
+	}
+
+	// done twice is fine, the server may confirm an upload again
+	if err := outbox.done(pending[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutboxWithoutClientId(t *testing.T) {
+	outbox := mustOpenOutbox(t, t.TempDir())
+	testId := primitive.NewObjectID()
+
+	// submissions without an id replace each other
+	for _, typed := range []string{"first", "second"} {
+		submission := common.TestSubmission{TestId: testId, TestInfo: common.TestInfo{TypingTestInfo: &common.TypingTestInfo{TypedText: typed}}}
+		if err := outbox.add("alice", submission); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pending := outbox.pending("alice")
+	if len(pending) != 1 || pending[0].Submission.TestInfo.TypingTestInfo.TypedText != "second" {
+		t.Fatalf("pending %+v, want the second submission only", pending)
+	}
+}
+
+func TestRefusedForGood(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&ServerError{Status: http.StatusBadRequest}, true},
+		{&ServerError{Status: http.StatusForbidden}, true},
+		{&ServerError{Status: http.StatusConflict}, true},
+		{&ServerError{Status: http.StatusUnauthorized}, false},
+		{&ServerError{Status: http.StatusTooManyRequests}, false},
+		{&ServerError{Status: http.StatusBadGateway}, false},
+		{fmt.Errorf("wrapped: %w", &ServerError{Status: http.StatusForbidden}), true},
+		{errors.New("connection refused"), false},
+	}
+	for _, c := range cases {
+		if got := refusedForGood(c.err); got != c.want {
+			t.Errorf("%v: got %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestAlreadySubmitted(t *testing.T) {
+	withId := &common.TestSubmission{ClientSubmissionId: "id"}
+	withoutId := &common.TestSubmission{}
+	conflict := &ServerError{Status: http.StatusConflict, Code: alreadySubmittedCode, Message: alreadySubmittedError}
+	cases := []struct {
+		name       string
+		submission *common.TestSubmission
+		err        error
+		want       bool
+	}{
+		{"code", withoutId, conflict, true},
+		{"message of an old server", withoutId, &ServerError{Status: http.StatusConflict, Message: alreadySubmittedError}, true},
+		{"other code", withoutId, &ServerError{Status: http.StatusConflict, Code: "id_taken", Message: alreadySubmittedError}, false},
+		{"other status", withoutId, &ServerError{Status: http.StatusBadRequest, Code: alreadySubmittedCode}, false},
+		{"submission with an id", withId, conflict, false},
+		{"no server error", withoutId, errors.New("timeout"), false},
+	}
+	for _, c := range cases {
+		if got := alreadySubmitted(c.submission, c.err); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
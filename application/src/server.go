@@ -7,7 +7,6 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/fs"
 	"log"
 	"net/http"
@@ -35,6 +34,7 @@ func (self *App) serve() {
 					return
 				}
 				log.Println(msg)
+				self.trackRoute(msg)
 				ws.SetWriteDeadline(time.Now().Add(time.Second * 5))
 				err := ws.WriteJSON(msg)
 				if err != nil {
@@ -106,7 +106,7 @@ func (self *App) serve() {
 	mux.HandleFunc("/get-user", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("content-type", "application/json")
 		w.Header().Add("access-control-allow-origin", "*")
-		if err := json.NewEncoder(w).Encode(self.client.user); err != nil {
+		if err := json.NewEncoder(w).Encode(self.client.currentUser()); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
@@ -117,13 +117,124 @@ func (self *App) serve() {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
+	// the file of a test, e.g. the picture of the document to recreate. the server only
+	// hands it out with the candidate's token, which the ui does not have
+	mux.HandleFunc("/test-file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("access-control-allow-origin", "*")
+
+		var testId common.ID
+		err := testId.UnmarshalText([]byte(r.URL.Query().Get("id")))
+		if err != nil {
+			http.Error(w, "Unknown test", http.StatusBadRequest)
+			return
+		}
+		test, err := self.findTestById(testId)
+		if err != nil || test.FilePath == "" {
+			http.Error(w, "Unknown test", http.StatusNotFound)
+			return
+		}
+
+		data, err := self.client.downloadTestFile(test.FilePath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Add("content-type", http.DetectContentType(data))
+		w.Write(data)
+	})
 	mux.HandleFunc("/get-submitted-ids", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("content-type", "application/json")
 		w.Header().Add("access-control-allow-origin", "*")
+		self.test_state.mutex.Lock()
+		defer self.test_state.mutex.Unlock()
 		if err := json.NewEncoder(w).Encode(self.test_state.submitted); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
+	// the session the app was killed in the middle of, or null
+	mux.HandleFunc("/get-resumable", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/json")
+		w.Header().Add("access-control-allow-origin", "*")
+		var resumable *common.ResumableSession
+		if state := self.resumable; state != nil {
+			resumable = &common.ResumableSession{
+				Username: state.User.Username,
+				SavedAt:  state.SavedAt,
+			}
+		}
+		if err := json.NewEncoder(w).Encode(resumable); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/get-sync-status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/json")
+		w.Header().Add("access-control-allow-origin", "*")
+		self.test_state.mutex.Lock()
+		defer self.test_state.mutex.Unlock()
+		statuses := []common.TSubmissionStatus{}
+		for _, status := range self.test_state.sync {
+			statuses = append(statuses, status)
+		}
+		if err := json.NewEncoder(w).Encode(statuses); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/start-test", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/json")
+		w.Header().Add("access-control-allow-origin", "*")
+
+		var testId common.ID
+		err := testId.UnmarshalText([]byte(r.URL.Query().Get("id")))
+		if err != nil {
+			http.Error(w, "Unknown test", http.StatusBadRequest)
+			return
+		}
+
+		status, err := self.client.startAttempt(testId)
+		if err != nil {
+			self.notifyErr(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		self.setDeadline(testId, status.Remaining)
+		self.test_state.mutex.Lock()
+		self.test_state.current = testId
+		self.test_state.mutex.Unlock()
+		self.saveJournal()
+		self.reportActivity(common.TActivity{Kind: common.ActivityTestOpened, TestId: testId})
+
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	// the ui reports the answers of typing and mcq tests as the candidate goes
+	mux.HandleFunc("/save-draft", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("access-control-allow-origin", "*")
+
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var draft common.TestSubmission
+		if err := json.NewDecoder(r.Body).Decode(&draft); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := self.findTestById(draft.TestId); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		self.setDraft(draft)
+		self.saveJournal()
+		w.WriteHeader(http.StatusNoContent)
+	})
 	mux.HandleFunc("/submit-test", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("access-control-allow-origin", "*")
 
@@ -150,72 +261,25 @@ func (self *App) serve() {
 		if self.runner.IsAppOpen() {
 			_ = self.runner.FocusOpenApp()
 			msg := "An Application is open. Please save your work, close the app and retry"
+			self.reportSubmission(submission.TestId, msg)
 			self.notifyErr(fmt.Errorf(msg))
 			http.Error(w, msg, http.StatusBadRequest)
 			return
 		}
 
-		test, err := self.findTestById(submission.TestId)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		switch test.Type {
-		case common.TypingTest, common.MCQTest:
-		case common.DocxTest, common.ExcelTest, common.PptTest:
-			path, ok := self.test_state.tests[test.Id]
-			if !ok {
-				self.notifyErr(fmt.Errorf("No data found. Did you complete the test?"))
-				http.Error(w, "No test data found", http.StatusBadRequest)
-				return
-			}
-
-			file, err := os.Open(path)
-			if err != nil {
-				err = fmt.Errorf("failed opening test file")
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			defer file.Close()
-
-			filedata, err := io.ReadAll(file)
-			if err != nil {
-				err = fmt.Errorf("failed reading test file")
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			encodedData := base64.StdEncoding.EncodeToString(filedata)
-			info := common.AppTestInfo{
-				FileData: encodedData,
-			}
-			switch test.Type {
-			case common.DocxTest:
-				submission.TestInfo.DocxTestInfo = &info
-			case common.ExcelTest:
-				submission.TestInfo.ExcelTestInfo = &info
-			case common.PptTest:
-				submission.TestInfo.PptTestInfo = &info
-			default:
-				panic("unreachable")
-			}
-		default:
-			if err != nil {
-				http.Error(w, "Unknown test", http.StatusBadRequest)
-				return
-			}
-		}
-
-		err = self.client.submitTest(submission)
+		err := self.submit(&submission)
 		if err != nil {
+			self.reportSubmission(submission.TestId, err.Error())
+			self.notifyErr(err)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		self.test_state.submitted[submission.TestId] = true
+		self.reportSubmission(submission.TestId, "ok")
 
 		self.maybeFinishTest()
 		w.WriteHeader(http.StatusNoContent)
 		self.send <- common.NewMessage(common.TNotification{
-			Message: fmt.Sprintf("Test submitted Sucessfully"),
+			Message: "Test saved locally. It is uploaded to the server in the background",
 			Typ:     "success",
 		})
 	})
@@ -269,7 +333,42 @@ func (self *App) serve() {
 	<-self.exitCtx.Done()
 }
 
-func (self *App) findTestById(id common.ID) (*common.Test, error) {
+// tells the proctors which page the ui is on
+func (self *App) trackRoute(msg common.Message) {
+	route := ""
+	switch msg.Typ {
+	case common.LoadRoute:
+		val, err := common.Get[common.TLoadRoute](msg)
+		if err != nil {
+			return
+		}
+		route = val.Route
+	case common.TestFinished:
+		route = "/end"
+	default:
+		return
+	}
+	self.client.setPresence(func(presence *common.TPresence) {
+		presence.Route = route
+	})
+}
+
+// outcome is "ok" or why the submission failed
+func (self *App) reportSubmission(testId common.ID, outcome string) {
+	self.reportActivity(common.TActivity{
+		Kind:   common.ActivitySubmissionAttempted,
+		TestId: testId,
+		Detail: outcome,
+	})
+}
+
+func (self *App) setOpenApp(name string) {
+	self.client.setPresence(func(presence *common.TPresence) {
+		presence.OpenApp = name
+	})
+}
+
+func (self *App) findTestById(id common.ID) (*common.CandidateTest, error) {
 	for _, test := range self.client.tests {
 		if test.Id == id {
 			return &test, nil
@@ -278,13 +377,78 @@ func (self *App) findTestById(id common.ID) (*common.Test, error) {
 	return nil, fmt.Errorf("Unknown test")
 }
 
+// adds the file of office tests to a submission and sends it to the server
+func (self *App) submit(submission *common.TestSubmission) error {
+	test, err := self.findTestById(submission.TestId)
+	if err != nil {
+		return err
+	}
+
+	switch test.Type {
+	case common.TypingTest, common.MCQTest:
+	case common.DocxTest, common.ExcelTest, common.PptTest:
+		path, ok := self.testFile(test.Id)
+		if !ok {
+			return fmt.Errorf("No data found. Did you complete the test?")
+		}
+
+		filedata, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed reading test file")
+		}
+		info := common.AppTestInfo{
+			FileData: base64.StdEncoding.EncodeToString(filedata),
+		}
+		switch test.Type {
+		case common.DocxTest:
+			submission.TestInfo.DocxTestInfo = &info
+		case common.ExcelTest:
+			submission.TestInfo.ExcelTestInfo = &info
+		case common.PptTest:
+			submission.TestInfo.PptTestInfo = &info
+		default:
+			panic("unreachable")
+		}
+	default:
+		return fmt.Errorf("Unknown test")
+	}
+
+	user := self.client.currentUser()
+	if user == nil {
+		return fmt.Errorf("not logged in")
+	}
+	if submission.ClientSubmissionId == "" {
+		submission.ClientSubmissionId = newSubmissionId()
+	}
+	// the uploader takes it from here, however long the server is unreachable
+	err = self.outbox.add(user.Username, *submission)
+	if err != nil {
+		return fmt.Errorf("could not save the submission: %v", err)
+	}
+
+	self.test_state.mutex.Lock()
+	self.test_state.submitted[submission.TestId] = true
+	delete(self.test_state.drafts, submission.TestId)
+	self.test_state.mutex.Unlock()
+
+	self.setSyncStatus(common.TSubmissionStatus{TestId: submission.TestId, Status: common.SyncQueued})
+	self.saveJournal()
+	return nil
+}
+
+// moves the ui to the end once every test is submitted. tests that can be submitted again
+// keep the candidate on the tests until the session ends
 func (self *App) maybeFinishTest() {
 	for _, test := range self.client.tests {
-		_, ok := self.test_state.submitted[test.Id]
-		if !ok {
+		if !self.isSubmitted(test.Id) {
+			return
+		}
+		switch test.SubmissionPolicy {
+		case common.SubmitLastWins, common.SubmitMultiple:
 			return
 		}
 	}
+	self.clearJournal()
 
 	self.send <- common.NewMessage(common.TTestFinished{})
 }
@@ -331,6 +495,17 @@ func (self *App) handleMessages() {
 			}
 			message := common.NewMessage(routeMessage)
 			self.send <- message
+		case common.ResumeSession:
+			val, err := common.Get[common.TResumeSession](msg)
+			if err != nil {
+				self.notifyErr(err)
+				continue
+			}
+			err = self.resume(val.Resume)
+			if err != nil {
+				self.notifyErr(err)
+				continue
+			}
 		case common.StartTest:
 			err := self.startTest()
 			if err != nil {
@@ -346,24 +521,56 @@ func (self *App) handleMessages() {
 				continue
 			}
 			var dest string
-			// TODO: self.state.tests will be wiped if app restarts. :) but i don't care rn
-			dest, ok := self.test_state.tests[val.TestId]
+			// a resumed session reopens the document the candidate was working on
+			dest, ok := self.testFile(val.TestId)
 			if !ok {
 				dest, err = self.runner.NewTemplate(val.Typ)
 				if err != nil {
 					self.notifyErr(err)
 					continue
 				}
+				self.test_state.mutex.Lock()
 				self.test_state.tests[val.TestId] = dest
+				self.test_state.mutex.Unlock()
+				self.saveJournal()
+			}
+			launched := !self.runner.IsAppOpen()
+			self.setOpenApp(val.Typ.TSName())
+			if launched {
+				self.reportActivity(common.TActivity{Kind: common.ActivityAppLaunched, TestId: val.TestId, Detail: val.Typ.TSName()})
 			}
 			go (func() {
 				err = self.runner.FocusOrOpenApp(val.Typ, dest)
 				self.notifyErr(err)
+				if !self.runner.IsAppOpen() {
+					self.setOpenApp("")
+					if launched {
+						self.reportActivity(common.TActivity{Kind: common.ActivityAppClosed, TestId: val.TestId, Detail: val.Typ.TSName()})
+						// the candidate just saved and closed the document
+						err := self.snapshot(val.TestId)
+						if err != nil {
+							log.Printf("could not upload snapshot of test '%s': %v\n", val.TestId.Hex(), err)
+						}
+					}
+				}
 			})()
+		case common.Activity:
+			val, err := common.Get[common.TActivity](msg)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			// the window loses focus to the office app of the test all the time. other
+			// windows are caught by the runner
+			if val.Kind == common.ActivityFocusLost && self.runner.IsAppOpen() {
+				continue
+			}
+			self.reportActivity(*val)
 		case common.Quit:
 			self.exitFn()
 		case common.QuitApp:
 			self.runner.KillApp()
+			self.setOpenApp("")
 		case common.Err:
 			val, err := common.Get[common.TErr](msg)
 			if err != nil {
@@ -371,7 +578,7 @@ func (self *App) handleMessages() {
 				continue
 			}
 			log.Println(val)
-		case common.ExeNotFound, common.TestFinished:
+		case common.ExeNotFound, common.TestFinished, common.DeadlineChanged, common.SubmissionStatus, common.RestoreSnapshot:
 			log.Printf("message of type '%s' cannot be handled here: '%s'\n", msg.Typ.TSName(), msg.Val)
 		case common.Unknown:
 			log.Printf("unknown message type received: '%s'\n", msg.Val)
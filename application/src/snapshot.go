@@ -0,0 +1,162 @@
+package main
+
+import (
+	"common"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AUTOSAVE_INTERVAL (default 2m) is how often the documents of office tests are uploaded
+// while the candidate works on them. they are also uploaded whenever the office app closes
+func autosaveInterval() time.Duration {
+	return envDuration("AUTOSAVE_INTERVAL", 2*time.Minute)
+}
+
+// uploads the documents of the tests that are still open until the app exits. a last_wins
+// test stays open after it is submitted, the candidate may keep working on it
+func (self *App) autosave() {
+	ticker := time.NewTicker(autosaveInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-self.exitCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		self.test_state.mutex.Lock()
+		testIds := []common.ID{}
+		for testId := range self.test_state.tests {
+			testIds = append(testIds, testId)
+		}
+		self.test_state.mutex.Unlock()
+
+		for _, testId := range testIds {
+			if self.isClosed(testId) {
+				continue
+			}
+			err := self.snapshot(testId)
+			if err != nil {
+				log.Printf("could not upload snapshot of test '%s': %v\n", testId.Hex(), err)
+			}
+		}
+	}
+}
+
+// uploads the document of a test as the office app last saved it, unless the server already
+// has this version of it
+func (self *App) snapshot(testId common.ID) error {
+	if self.client.currentUser() == nil {
+		return nil
+	}
+	path, ok := self.testFile(testId)
+	if !ok {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	self.test_state.mutex.Lock()
+	uploaded := self.test_state.snapshots[testId] == hash
+	self.test_state.mutex.Unlock()
+	if uploaded {
+		return nil
+	}
+
+	snapshot, err := self.client.uploadSnapshot(testId, data)
+	if err != nil {
+		return err
+	}
+	log.Printf("uploaded version %d of test '%s'\n", snapshot.Version, testId.Hex())
+
+	self.test_state.mutex.Lock()
+	self.test_state.snapshots[testId] = hash
+	self.test_state.mutex.Unlock()
+	return nil
+}
+
+// a proctor handed the candidate the latest snapshot of a test, e.g. on a replacement
+// machine. it replaces the document the app has for the test
+func (self *App) restoreSnapshot(val *common.TRestoreSnapshot) error {
+	test, err := self.findTestById(val.TestId)
+	if user := self.client.currentUser(); err != nil && len(self.client.tests) == 0 && user != nil {
+		// the candidate has not got to the tests on this machine yet
+		self.client.tests, err = self.client.getTests(user.Batch)
+		if err == nil {
+			test, err = self.findTestById(val.TestId)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if self.isClosed(val.TestId) {
+		return fmt.Errorf("test '%s' is already submitted", val.TestId.Hex())
+	}
+
+	data, err := self.client.downloadSnapshot(val.TestId)
+	if err != nil {
+		return err
+	}
+	// the server hands out its latest version, which may be newer than the one in the message
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	// the office app may have the old document open. save it so nothing is lost, then
+	// close it so the restored one is opened next time
+	self.closeOpenApp()
+
+	path, ok := self.testFile(val.TestId)
+	if ok {
+		err = writeFileAtomic(filepath.Dir(path), filepath.Base(path), data)
+	} else {
+		path, err = writeDocument(test.Type, data)
+	}
+	if err != nil {
+		return err
+	}
+
+	self.test_state.mutex.Lock()
+	self.test_state.tests[val.TestId] = path
+	self.test_state.snapshots[val.TestId] = hash
+	self.test_state.mutex.Unlock()
+	self.saveJournal()
+
+	self.send <- common.NewMessage(common.TNotification{
+		Message: fmt.Sprintf("Your work on '%s' was restored from the server. Open the test to continue", test.TestName),
+		Typ:     "default",
+	})
+	return nil
+}
+
+// creates a new document of an office test with the given contents
+func writeDocument(typ common.TestType, data []byte) (string, error) {
+	switch typ {
+	case common.DocxTest, common.ExcelTest, common.PptTest:
+	default:
+		return "", fmt.Errorf("test type '%s' has no document", typ)
+	}
+
+	file, err := os.CreateTemp(documentsDir(), tmp_prefix+"_*."+string(typ))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	_, err = file.Write(data)
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"common"
+	"context"
+	"time"
+	"unicode/utf8"
+)
+
+// longest Detail kept. the app sends window titles and error messages, nothing longer
+const activityDetailLimit = 500
+
+// stores something a candidate's app reported, tied to the attempt that was running at the time
+func (this *Database) RecordActivity(ctx context.Context, username string, activity *common.TActivity) error {
+	event := common.ActivityEvent{
+		Username:   username,
+		TestId:     activity.TestId,
+		Kind:       activity.Kind,
+		Detail:     activity.Detail,
+		At:         activity.At,
+		ReceivedAt: time.Now(),
+	}
+	if event.At.IsZero() {
+		event.At = event.ReceivedAt
+	}
+	if len(event.Detail) > activityDetailLimit {
+		cut := activityDetailLimit
+		for cut > 0 && !utf8.RuneStart(event.Detail[cut]) {
+			cut--
+		}
+		event.Detail = event.Detail[:cut]
+	}
+
+	if !event.TestId.IsZero() {
+		attempt, err := this.Attempts.FindLatest(ctx, username, event.TestId)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		if attempt != nil {
+			event.AttemptId = attempt.Id
+		}
+	}
+
+	return this.Activity.Add(ctx, &event)
+}
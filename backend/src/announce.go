@@ -0,0 +1,61 @@
+package main
+
+import (
+	"common"
+	"context"
+	"fmt"
+)
+
+type Delivery struct {
+	Username string
+	Status   DeliveryStatus
+}
+
+// usernames of the given users, the users of a batch and, with everyone, every candidate
+// that has connected since the server started. without duplicates
+func (this *Database) Recipients(ctx context.Context, usernames []string, batch string, everyone bool) ([]string, error) {
+	for _, username := range usernames {
+		_, err := this.Users.FindByUsername(ctx, username)
+		if err == ErrNotFound {
+			return nil, fmt.Errorf("unknown user '%s'", username)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if batch != "" {
+		users, err := this.Users.FindByBatch(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching users of batch: %v", err)
+		}
+		for _, user := range users {
+			usernames = append(usernames, user.Username)
+		}
+	}
+	if everyone {
+		usernames = append(usernames, this.Clients.names()...)
+	}
+
+	seen := map[string]bool{}
+	recipients := []string{}
+	for _, username := range usernames {
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		recipients = append(recipients, username)
+	}
+	return recipients, nil
+}
+
+// sends a message to the apps of the recipients
+func (this *Database) Announce(recipients []string, msg common.Message) []Delivery {
+	deliveries := make([]Delivery, 0, len(recipients))
+	for _, username := range recipients {
+		deliveries = append(deliveries, Delivery{
+			Username: username,
+			Status:   this.Clients.notify(username, msg),
+		})
+	}
+	return deliveries
+}
@@ -2,17 +2,16 @@ package main
 
 import (
 	models "common"
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ModelInterface interface {
@@ -28,43 +27,27 @@ var _ ModelInterface = (*models.Test)(nil)
 // Define your JWT claims structure
 type Claims struct {
 	Username string `json:"username"`
+	// the login session the token was issued for. see CheckSession
+	SessionId string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-var tokenKey = []byte("token")
-
-func VerifyJWT(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return tokenKey, nil
-	})
+func VerifyJWT(tokenString string) (*Claims, error) {
+	return userKeys.Verify(tokenString)
+}
 
+func ApplicationTokenVerifier(users UserRepository, sessions SessionRepository, tokenString string) (*Claims, error) {
+	claims, err := VerifyJWT(tokenString)
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if exp, ok := claims["exp"].(float64); ok {
-			if time.Now().Unix() > int64(exp) {
-				return nil, errors.New("token has expired")
-			}
-		}
-		return claims, nil
-	}
-
-	return nil, errors.New("invalid token")
-}
-
-func ApplicationTokenVerifier(Collection *mongo.Collection, tokenString string) (jwt.MapClaims, error) {
-	claims, err := VerifyJWT(tokenString)
+	err = CheckSession(context.TODO(), sessions, claims)
 	if err != nil {
 		return nil, err
 	}
 
-	userName := claims["username"].(string)
-	user, err := models.FindByUsername(Collection, userName)
+	user, err := users.FindByUsername(context.TODO(), claims.Username)
 	if err != nil || user == nil {
 		return nil, errors.New("user not found")
 	}
@@ -84,10 +67,10 @@ func ApiKeyVerifier(apiKey string) (bool, error) {
 	return apiKey == backendAPISecret, nil
 }
 
-func ValidRequestVerifier(Collection *mongo.Collection, tokenString, apiKey string) (bool, error) {
+func ValidRequestVerifier(users UserRepository, sessions SessionRepository, tokenString, apiKey string) (bool, error) {
 	fmt.Println("validRequestVerifier: called")
 
-	claims, err := ApplicationTokenVerifier(Collection, tokenString)
+	claims, err := ApplicationTokenVerifier(users, sessions, tokenString)
 	if err != nil {
 		fmt.Println("validRequestVerifier: decoded error: ", err)
 		return false, err
@@ -114,7 +97,7 @@ func ValidRequestVerifier(Collection *mongo.Collection, tokenString, apiKey stri
 
 // }
 
-func UserJWTAuthMiddleware(userCollection *mongo.Collection) gin.HandlerFunc {
+func UserJWTAuthMiddleware(users UserRepository, sessions SessionRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -131,7 +114,7 @@ func UserJWTAuthMiddleware(userCollection *mongo.Collection) gin.HandlerFunc {
 		}
 
 		tokenString := bearerToken[1]
-		claims, err := ApplicationTokenVerifier(userCollection, tokenString)
+		claims, err := ApplicationTokenVerifier(users, sessions, tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
@@ -143,7 +126,7 @@ func UserJWTAuthMiddleware(userCollection *mongo.Collection) gin.HandlerFunc {
 	}
 }
 
-func AdminJWTAuthMiddleware(userCollection *mongo.Collection) gin.HandlerFunc {
+func AdminJWTAuthMiddleware(sessions SessionRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("Entering AdminJWTAuthMiddleware")
 
@@ -156,17 +139,22 @@ func AdminJWTAuthMiddleware(userCollection *mongo.Collection) gin.HandlerFunc {
 				"isAuthenticated": false,
 				"error":           "No token found",
 			})
+			c.Abort()
 			return
 		}
 		log.Println("Auth token cookie found")
 
 		claims, err := ValidateAdminToken(token)
+		if err == nil {
+			err = CheckSession(c, sessions, claims)
+		}
 		if err != nil {
 			log.Printf("Admin token validation failed: %v", err)
 			c.JSON(401, gin.H{
 				"isAuthenticated": false,
 				"error":           "Invalid token",
 			})
+			c.Abort()
 			return
 		}
 		log.Println("Admin token validated successfully")
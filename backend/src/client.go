@@ -18,6 +18,12 @@ type Client struct {
 	tempId int64
 	send   chan types.Message
 	recv   chan types.Message
+
+	// session of the live connection and a func to drop it, nil while offline. guarded
+	// by ClientsCtx.mutex
+	sessionId  string
+	disconnect context.CancelFunc
+	connId     int64
 }
 
 func (self *Client) Close() {
@@ -25,7 +31,7 @@ func (self *Client) Close() {
 	// keep send open ig :/
 }
 
-func (self *Client) handleMessages() {
+func (self *Client) handleMessages(name string, db *Database) {
 	for {
 		msg, ok := <-self.recv
 		if !ok {
@@ -33,31 +39,75 @@ func (self *Client) handleMessages() {
 		}
 
 		switch msg.Typ {
+		case types.Presence:
+			val, err := types.Get[types.TPresence](msg)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			db.Presence.seen(name, val)
+		case types.Activity:
+			db.Presence.seen(name, nil)
+			val, err := types.Get[types.TActivity](msg)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			err = db.RecordActivity(context.Background(), name, val)
+			if err != nil {
+				log.Printf("could not record activity of '%s': %v\n", name, err)
+			}
 		default:
+			db.Presence.seen(name, nil)
 			log.Printf("message type '%s' not handled ('%s')\n", msg.Typ.TSName(), msg.Val)
 		}
 	}
 
 }
 
+// WS_PING_INTERVAL (default 5s) is how often the server pings candidates' apps. a connection
+// that stays silent for WS_PONG_TIMEOUT (default 15s) is dropped and the candidate shows up
+// as disconnected. the app reads the same variables
+func wsPingInterval() time.Duration {
+	return getEnvDuration("WS_PING_INTERVAL", 5*time.Second)
+}
+
+func wsPongTimeout() time.Duration {
+	return getEnvDuration("WS_PONG_TIMEOUT", 15*time.Second)
+}
+
+// messages queued for a client while it is offline. more than this are dropped
+const clientSendBuffer = 32
+
 type ClientsCtx struct {
 	// string -> *Client
 	clients sync.Map
 	tempId  int64
 	mutex   sync.Mutex
+	// handles the messages of clients
+	db *Database
 }
 
+// the client of a user, created on first use. it outlives connections, so messages for the
+// user queue up while they are offline and one goroutine handles what they send across
+// reconnects
 func (self *ClientsCtx) addClient(name string) *Client {
-	val, ok := self.clients.Load(name)
-	if !ok {
-		client := &Client{
-			send: make(chan types.Message),
-			recv: make(chan types.Message),
-		}
-		self.set(name, client)
-		return client
+	if val, ok := self.clients.Load(name); ok {
+		return val.(*Client)
+	}
+
+	client := &Client{
+		send: make(chan types.Message, clientSendBuffer),
+		recv: make(chan types.Message),
+	}
+	// two connections of a new user at once must end up with the same client
+	if val, loaded := self.clients.LoadOrStore(name, client); loaded {
+		return val.(*Client)
+	}
+	self.set(name, client)
+	if self.db != nil {
+		go client.handleMessages(name, self.db)
 	}
-	client, _ := val.(*Client)
 	return client
 }
 
@@ -88,6 +138,97 @@ func (self *ClientsCtx) get(name string) (*Client, error) {
 	return client, nil
 }
 
+// remembers the live connection of a client so it can be dropped when its session is revoked.
+// a client has one live connection. the one it had before is dropped, e.g. the old machine
+// when a candidate moves to another one. returns an id for disconnected
+func (self *ClientsCtx) connected(client *Client, sessionId string, disconnect context.CancelFunc) int64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if client.disconnect != nil {
+		log.Printf("dropping previous connection of session %s", client.sessionId)
+		client.disconnect()
+	}
+	client.sessionId = sessionId
+	client.disconnect = disconnect
+	client.connId++
+	return client.connId
+}
+
+// marks a client offline once its connection closed, unless it has reconnected meanwhile.
+// returns false in that case
+func (self *ClientsCtx) disconnected(client *Client, connId int64) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if client.connId != connId {
+		return false
+	}
+	client.disconnect = nil
+	return true
+}
+
+// drops the live connection of a client, if it has one. with a non empty sessionId only
+// when the connection belongs to that session
+func (self *ClientsCtx) disconnect(name string, sessionId string) {
+	client, err := self.get(name)
+	if err != nil {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if client.disconnect == nil || (sessionId != "" && client.sessionId != sessionId) {
+		return
+	}
+	log.Printf("dropping connection of %s (session %s)", name, client.sessionId)
+	client.disconnect()
+	client.disconnect = nil
+}
+
+type DeliveryStatus string
+
+const (
+	// the client is connected, the message is on its way
+	DeliverySent DeliveryStatus = "sent"
+	// the client is offline, the message goes out when it reconnects
+	DeliveryQueued DeliveryStatus = "queued"
+	// the client's queue is full
+	DeliveryDropped DeliveryStatus = "dropped"
+)
+
+// queues a message for a client. it goes out right away if the client is connected,
+// otherwise after it reconnects
+func (self *ClientsCtx) notify(name string, msg types.Message) DeliveryStatus {
+	client := self.addClient(name)
+
+	self.mutex.Lock()
+	online := client.disconnect != nil
+	self.mutex.Unlock()
+
+	select {
+	case client.send <- msg:
+		if online {
+			return DeliverySent
+		}
+		return DeliveryQueued
+	default:
+		log.Printf("send queue of %s is full, dropping '%s' message", name, msg.Typ.TSName())
+		return DeliveryDropped
+	}
+}
+
+// names of every client the server has seen since it started
+func (self *ClientsCtx) names() []string {
+	names := []string{}
+	self.clients.Range(func(key, value any) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	return names
+}
+
 // don't yeet clients from memory. push messages in them as they will be sent to user after reconnection
 func (self *ClientsCtx) remove(name string, tempId int64) {
 	self.mutex.Lock()
@@ -109,16 +250,28 @@ func (self *ClientsCtx) remove(name string, tempId int64) {
 	client.Close()
 }
 
-func AppRoutes(route *gin.Engine) {
-	var state ClientsCtx
+func AppRoutes(allControllers *Database, route *gin.Engine) {
+	state := allControllers.Clients
+
+	pingInterval := wsPingInterval()
+	pongTimeout := wsPongTimeout()
 
 	handleClient := func(ws *websocket.Conn, ctx context.Context, client *Client) {
 		defer ws.Close()
 
+		ping := time.NewTicker(pingInterval)
+		defer ping.Stop()
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
+			case <-ping.C:
+				err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second*5))
+				if err != nil {
+					log.Println(err)
+					return
+				}
 			case msg, ok := <-client.send:
 				if !ok {
 					return
@@ -128,15 +281,40 @@ func AppRoutes(route *gin.Engine) {
 				err := ws.WriteJSON(msg)
 				if err != nil {
 					log.Println(err)
+					// the app may not have it, so it goes out again after the app reconnects
+					select {
+					case client.send <- msg:
+					default:
+						log.Printf("send queue is full, dropping '%s' message", msg.Typ.TSName())
+					}
 					return
 				}
 			}
 		}
 	}
 
-	handleMessages := func(ws *websocket.Conn, close context.CancelFunc, client *Client) {
+	// a connection that stays silent (no message, ping or pong) for pongTimeout is dead
+	handleMessages := func(ws *websocket.Conn, close context.CancelFunc, client *Client, name string) {
 		defer ws.Close()
 
+		alive := func() {
+			ws.SetReadDeadline(time.Now().Add(pongTimeout))
+		}
+		alive()
+		ws.SetPongHandler(func(string) error {
+			alive()
+			allControllers.Presence.seen(name, nil)
+			return nil
+		})
+		ws.SetPingHandler(func(data string) error {
+			alive()
+			err := ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second*5))
+			if err == websocket.ErrCloseSent {
+				return nil
+			}
+			return err
+		})
+
 		for {
 			var msg types.Message
 			err := ws.ReadJSON(&msg)
@@ -145,6 +323,7 @@ func AppRoutes(route *gin.Engine) {
 				close()
 				return
 			}
+			alive()
 			client.recv <- msg
 		}
 	}
@@ -169,13 +348,16 @@ func AppRoutes(route *gin.Engine) {
 		token := bearerToken[1]
 
 		claims, err := VerifyJWT(token)
+		if err == nil {
+			err = CheckSession(c, allControllers.Sessions, claims)
+		}
 		if err != nil {
 			c.JSON(401, gin.H{"error": "Invalid or expired token"})
 			return
 		}
 
-		username, ok := claims["username"].(string)
-		if !ok {
+		username := claims.Username
+		if username == "" {
 			c.JSON(401, gin.H{"error": "Username not found in token"})
 			return
 		}
@@ -189,11 +371,21 @@ func AppRoutes(route *gin.Engine) {
 		ctx, cancel := context.WithCancel(context.Background())
 
 		client := state.addClient(username)
+		connId := state.connected(client, claims.SessionId, cancel)
+		batch := ""
+		if user, err := allControllers.Users.FindByUsername(c, username); err == nil {
+			batch = user.Batch
+		}
+		allControllers.Presence.connected(username, batch)
+		defer func() {
+			if state.disconnected(client, connId) {
+				allControllers.Presence.disconnected(username)
+			}
+		}()
 
 		log.Println("new conn")
-		go client.handleMessages()
 		go handleClient(ws, ctx, client)
-		handleMessages(ws, cancel, client)
+		handleMessages(ws, cancel, client, username)
 	}
 
 	route.GET("/ws", wsHandler)
@@ -1,134 +1,327 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"common"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Database struct {
-	Client               *mongo.Client
-	AdminCollection      *mongo.Collection
-	UserCollection       *mongo.Collection
-	TestCollection       *mongo.Collection
-	BatchCollection      *mongo.Collection
-	SubmissionCollection *mongo.Collection
+	*Repositories
+	Storage Storage
+	// websocket connections of candidates
+	Clients *ClientsCtx
+	// what the candidates' apps are doing, for proctors
+	Presence *PresenceHub
 }
 
 func connectDatabase() (*Database, error) {
-	uri, ok := os.LookupEnv("MONGODB_URI")
-	if !ok {
-		return nil, fmt.Errorf("MONGODB_URI not set")
+	repos, err := NewRepositoriesFromEnv()
+	if err != nil {
+		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	db := &Database{Repositories: repos, Presence: NewPresenceHub()}
+	db.Clients = &ClientsCtx{db: db}
+	return db, nil
+}
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+var ErrOtherBatch = errors.New("question papers are only given out for your own batch")
 
+// question papers go to candidates. only the stripped down CandidateTest may leave the server here.
+// the questions of mcq tests come in the candidate's own order
+func (this *Database) GetQuestionPaperHandler(ctx *gin.Context, username string, batchName string) ([]common.CandidateTest, error) {
+	user, err := this.Users.FindByUsername(ctx, username)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to MongoDB: %v", err)
+		return nil, fmt.Errorf("error finding user: %v", err)
+	}
+	if user.Batch != batchName {
+		return nil, ErrOtherBatch
 	}
 
-	log.Println("Successfully connected to MongoDB!")
+	batch, err := this.Batches.FindByName(ctx, batchName)
+	if err != nil {
+		return nil, fmt.Errorf("error finding batch: %v", err)
+	}
 
-	adminCollection := client.Database("GRAVTEST").Collection("Admin")
-	userCollection := client.Database("GRAVTEST").Collection("Users")
-	testCollection := client.Database("GRAVTEST").Collection("Tests")
-	batchCollection := client.Database("GRAVTEST").Collection("Batch")
-	SubmissionCollection := client.Database("GRAVTEST").Collection("Submission")
+	tests, err := this.Tests.FindByIds(ctx, batch.Tests)
+	if err != nil {
+		return nil, fmt.Errorf("error finding tests: %v", err)
+	}
 
-	db := Database{
-		Client:               client,
-		AdminCollection:      adminCollection,
-		UserCollection:       userCollection,
-		TestCollection:       testCollection,
-		BatchCollection:      batchCollection,
-		SubmissionCollection: SubmissionCollection,
+	candidateTests := make([]common.CandidateTest, 0, len(tests))
+	for _, t := range tests {
+		candidateTest, err := t.ToCandidateTest()
+		if err != nil {
+			return nil, fmt.Errorf("error preparing test '%s': %v", t.TestName, err)
+		}
+		if t.FileHash != "" {
+			candidateTest.FilePath = BlobURL(t.FileHash)
+		}
+		if t.Type == common.MCQTest {
+			candidateTest.McqJson, err = shuffledMcqJson(username, &t)
+			if err != nil {
+				return nil, fmt.Errorf("error preparing test '%s': %v", t.TestName, err)
+			}
+		}
+		candidateTests = append(candidateTests, *candidateTest)
 	}
-	return &db, nil
+
+	return candidateTests, nil
+}
+
+func (c *Database) GetAllTests(ctx *gin.Context) ([]common.Test, error) {
+	return c.Tests.All(ctx)
+}
+
+func setAdminCookies(ctx *gin.Context, access string, refresh string) {
+	// the access cookie outlives the token inside it, so an expired token gets a 401 the
+	// admin panel can answer with a refresh instead of looking like a logged out session
+	maxAge := int(refreshTokenTTL().Seconds())
+	ctx.SetCookie("auth_token", access, maxAge, "/", "", false, true)
+	ctx.SetCookie("refresh_token", refresh, maxAge, "/admin", "", false, true)
 }
 
-func (this *Database) GetQuestionPaperHandler(ctx *gin.Context, batchName string) ([]ModelInterface, error) {
-	batchCollection := this.BatchCollection
-	testCollection := this.TestCollection
+func clearAdminCookies(ctx *gin.Context) {
+	ctx.SetCookie("auth_token", "", -1, "/", "", false, true)
+	ctx.SetCookie("refresh_token", "", -1, "/admin", "", false, true)
+}
+
+func (this *Database) AdminLoginHandler(ctx *gin.Context, adminModel *common.Admin) {
+	access, refresh, err := AdminLogin(ctx, this.Admins, this.Sessions, adminModel)
 
-	tests, err := GetTestsByBatch(batchCollection, testCollection, batchName)
-	log.Println(tests, batchName, err)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": "Error while fetching question papers"})
-		return nil, err
+		ctx.JSON(401, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
-	// Convert []test.Test to []types.ModelInterface
-	var modelTests []ModelInterface
-	for _, t := range tests {
-		modelTests = append(modelTests, &t)
+	setAdminCookies(ctx, access, refresh)
+
+	ctx.JSON(200, gin.H{
+		"message": "Admin logged in successfully",
+	})
+}
+
+func (this *Database) AdminRefreshHandler(ctx *gin.Context) {
+	refresh, err := ctx.Cookie("refresh_token")
+	if err != nil {
+		ctx.JSON(401, gin.H{"error": "No refresh token found"})
+		return
 	}
 
-	return modelTests, nil
+	access, refresh, _, err := RefreshSession(ctx, this.Sessions, adminKeys, refresh)
+	if err == ErrSessionRevoked {
+		clearAdminCookies(ctx)
+		ctx.JSON(401, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{"message": "Error refreshing session", "error": err.Error()})
+		return
+	}
+
+	setAdminCookies(ctx, access, refresh)
+	ctx.JSON(200, gin.H{"message": "Session refreshed"})
 }
 
-func (c *Database) GetAllTests(ctx *gin.Context) ([]common.Test, error) {
-	var tests []common.Test
+// works without a valid access token too, so an admin can always log out
+func (this *Database) AdminLogoutHandler(ctx *gin.Context) {
+	if refresh, err := ctx.Cookie("refresh_token"); err == nil {
+		session, err := this.Sessions.FindByRefreshHash(ctx, hashRefreshToken(refresh))
+		if err == nil && session.Audience == adminAudience {
+			err = this.Sessions.Revoke(ctx, session.Id)
+		}
+		if err != nil && err != ErrNotFound {
+			log.Printf("could not revoke admin session: %v", err)
+		}
+	}
 
-	cursor, err := c.TestCollection.Find(context.TODO(), bson.M{})
+	clearAdminCookies(ctx)
+	ctx.JSON(200, gin.H{"message": "Logged out"})
+}
+
+// kills every session of a candidate, including a connected exam client. e.g. when a
+// candidate's machine is swapped mid exam, so the old machine is locked out right away
+func (this *Database) RevokeUserSessionsHandler(ctx *gin.Context, username string) {
+	revoked, err := this.Sessions.RevokeByUsername(ctx, userAudience, username)
 	if err != nil {
-		return nil, err
+		ctx.JSON(500, gin.H{"message": "Error revoking sessions", "error": err.Error()})
+		return
 	}
-	defer cursor.Close(context.TODO())
+	this.Clients.disconnect(username, "")
 
-	if err = cursor.All(context.TODO(), &tests); err != nil {
-		return nil, err
+	ctx.JSON(200, gin.H{
+		"message": fmt.Sprintf("Revoked %d sessions of %s", revoked, username),
+		"revoked": revoked,
+	})
+}
+
+func (this *Database) IncreaseTestTimeHandler(ctx *gin.Context, usernames []string, batch string, testId common.ID, minutes int) {
+	usernames, err := this.Recipients(ctx, usernames, batch, false)
+	if err != nil {
+		ctx.JSON(400, gin.H{"message": "Error finding users", "error": err.Error()})
+		return
+	}
+	if len(usernames) == 0 {
+		ctx.JSON(400, gin.H{"error": "No users given"})
+		return
+	}
+	if minutes <= 0 {
+		ctx.JSON(400, gin.H{"error": "Minutes must be positive"})
+		return
+	}
+
+	attempts, err := this.ExtendTime(ctx, usernames, testId, minutes)
+	if err != nil {
+		ctx.JSON(500, gin.H{"message": "Error increasing test time", "error": err.Error()})
+		return
 	}
 
-	return tests, nil
+	ctx.JSON(200, gin.H{
+		"message":  fmt.Sprintf("Gave %d minutes to %d running tests", minutes, len(attempts)),
+		"extended": len(attempts),
+		"attempts": attempts,
+	})
 }
 
-func (this *Database) AdminLoginHandler(ctx *gin.Context, adminModel *common.Admin) {
-	adminCollection := this.AdminCollection
-	token, err := AdminLogin(adminCollection, adminModel)
+// sends a notification or, with warn, a warning to candidates' apps
+func (this *Database) NotifyUsersHandler(ctx *gin.Context, usernames []string, batch string, everyone bool, text string, warn bool) {
+	recipients, err := this.Recipients(ctx, usernames, batch, everyone)
+	if err != nil {
+		ctx.JSON(400, gin.H{"message": "Error finding users", "error": err.Error()})
+		return
+	}
+	if len(recipients) == 0 {
+		ctx.JSON(400, gin.H{"error": "No users to send to"})
+		return
+	}
 
+	var msg common.Message
+	if warn {
+		msg = common.NewMessage(common.TWarnUser{Message: text})
+	} else {
+		msg = common.NewMessage(common.TNotification{Message: text, Typ: "default"})
+	}
+	deliveries := this.Announce(recipients, msg)
+
+	counts := map[DeliveryStatus]int{}
+	for _, delivery := range deliveries {
+		counts[delivery.Status]++
+	}
+	ctx.JSON(200, gin.H{
+		"message": fmt.Sprintf("Sent to %d, queued for %d offline, dropped for %d",
+			counts[DeliverySent], counts[DeliveryQueued], counts[DeliveryDropped]),
+		"deliveries": deliveries,
+	})
+}
+
+// ends a running exam session for every candidate right away, extra time included
+func (this *Database) FinishSessionHandler(ctx *gin.Context, sessionId common.ID) {
+	session, err := this.Exams.FindById(ctx, sessionId)
+	if err == ErrNotFound {
+		ctx.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
 	if err != nil {
-		ctx.JSON(401, gin.H{
-			"error": err.Error(),
-		})
+		ctx.JSON(500, gin.H{"message": "Error fetching session", "error": err.Error()})
 		return
 	}
 
-	// Set the token in a cookie
-	ctx.SetCookie("auth_token", token, 3600*48, "/", "", false, true)
+	deliveries, _, err := this.FinishSession(ctx, session, true)
+	if err != nil {
+		ctx.JSON(500, gin.H{"message": "Error finishing session", "error": err.Error()})
+		return
+	}
 
 	ctx.JSON(200, gin.H{
-		"message": "Admin logged in successfully",
+		"message":    fmt.Sprintf("Session '%s' finished for %d candidates", session.Name, len(deliveries)),
+		"deliveries": deliveries,
 	})
 }
 
+func (this *Database) ActivityHandler(ctx *gin.Context, filter ActivityFilter) {
+	events, err := this.Activity.Find(ctx, filter)
+	if err != nil {
+		ctx.JSON(500, gin.H{"message": "Error fetching activity", "error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"events": events})
+}
+
 func (this *Database) AdminRegisterHandler(ctx *gin.Context, adminModel *common.Admin) {
-	adminCollection := this.AdminCollection
-	err := RegisterAdmin(adminCollection, adminModel)
+	err := RegisterAdmin(ctx, this.Admins, adminModel)
 
 	if err != nil {
-		ctx.JSON(500, gin.H{
+		ctx.JSON(400, gin.H{
 			"message": "Error in Admin Register",
-			"error":   err,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": fmt.Sprintf("Admin '%s' registered as %s", adminModel.Username, adminModel.Role),
+	})
+}
+
+func (this *Database) AdminBootstrapHandler(ctx *gin.Context, token string, adminModel *common.Admin) {
+	err := BootstrapAdmin(ctx, this.Admins, token, adminModel)
+	if err == ErrBootstrapClosed {
+		ctx.JSON(403, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"message": "Error in Admin Register",
+			"error":   err.Error(),
 		})
 		return
 	}
 
 	ctx.JSON(200, gin.H{
-		"message": "Admin Register route here",
+		"message": fmt.Sprintf("Super admin '%s' registered", adminModel.Username),
 	})
 }
 
+func (this *Database) SetAdminRoleHandler(ctx *gin.Context, username string, role common.AdminRole) {
+	if !validRole(role) {
+		ctx.JSON(400, gin.H{"error": fmt.Sprintf("invalid role '%s'", role)})
+		return
+	}
+
+	admin, err := currentAdmin(ctx, this.Admins)
+	if err == nil && admin.Username == username && role != common.SuperAdmin {
+		// so there is always someone left who can hand out roles
+		ctx.JSON(400, gin.H{"error": "super admins can not demote themselves"})
+		return
+	}
+
+	err = this.Admins.SetRole(ctx, username, role)
+	if err == ErrNotFound {
+		ctx.JSON(404, gin.H{"error": "admin not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{"message": "Error setting role", "error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"message": fmt.Sprintf("'%s' is now %s", username, role)})
+}
+
 func (this *Database) AdminChangePassword(ctx *gin.Context) {
 	ctx.JSON(501, gin.H{
 		"message": "This route is not needed",
@@ -136,8 +329,7 @@ func (this *Database) AdminChangePassword(ctx *gin.Context) {
 }
 
 func (this *Database) AddTestToDB(ctx *gin.Context, test *common.Test) {
-	testCollection := this.TestCollection
-	err := Add_Model_To_DB(testCollection, test)
+	err := this.Tests.Add(ctx, test)
 
 	if err != nil {
 		ctx.JSON(500, gin.H{
@@ -153,9 +345,13 @@ func (this *Database) AddTestToDB(ctx *gin.Context, test *common.Test) {
 }
 
 func (this *Database) UpdateTypingTestText(ctx *gin.Context, typingTestText string, testID string) {
-	testCollection := this.TestCollection
+	objectID, err := primitive.ObjectIDFromHex(testID)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid test ID format"})
+		return
+	}
 
-	err := UpdateTypingTestText(testCollection, testID, typingTestText)
+	err = this.Tests.SetTypingText(ctx, objectID, typingTestText)
 	if err != nil {
 		ctx.JSON(500, gin.H{
 			"message": "Error while updating typing test text",
@@ -169,10 +365,45 @@ func (this *Database) UpdateTypingTestText(ctx *gin.Context, typingTestText stri
 	})
 }
 
-func (this *Database) AddBatchToDB(ctx *gin.Context, batchData *common.Batch) {
-	testCollection := this.BatchCollection
+func (this *Database) SetTestRubric(ctx *gin.Context, testId string, rubric []common.RubricRule) {
+	objectID, err := primitive.ObjectIDFromHex(testId)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid test ID format"})
+		return
+	}
 
-	err := Add_Model_To_DB(testCollection, batchData)
+	test, err := this.Tests.FindById(ctx, objectID)
+	if err == ErrNotFound {
+		ctx.JSON(404, gin.H{"error": "test not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = ValidateRubric(test.Type, rubric)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = this.Tests.SetRubric(ctx, objectID, rubric)
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"message": "Error while updating rubric",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "Rubric updated successfully",
+	})
+}
+
+func (this *Database) AddBatchToDB(ctx *gin.Context, batchData *common.Batch) {
+	err := this.Batches.Add(ctx, batchData)
 
 	if err != nil {
 		ctx.JSON(500, gin.H{
@@ -188,9 +419,7 @@ func (this *Database) AddBatchToDB(ctx *gin.Context, batchData *common.Batch) {
 }
 
 func (this *Database) GetBatches(ctx *gin.Context) {
-	testCollection := this.BatchCollection
-
-	batchData, err := Get_All_Models(testCollection, &common.Batch{})
+	batchData, err := this.Batches.All(ctx)
 
 	if err != nil {
 		ctx.JSON(500, gin.H{
@@ -207,9 +436,7 @@ func (this *Database) GetBatches(ctx *gin.Context) {
 }
 
 func (this *Database) UserLoginHandler(ctx *gin.Context, userModel *common.TUserLoginRequest) {
-	userCollection := this.UserCollection
-	response, err := UserLogin(userCollection, userModel)
-	user, _ := common.FindByUsername(userCollection, userModel.Username)
+	response, err := UserLogin(ctx, this.Users, this.Sessions, userModel)
 
 	if err != nil {
 		ctx.JSON(401, gin.H{
@@ -219,12 +446,44 @@ func (this *Database) UserLoginHandler(ctx *gin.Context, userModel *common.TUser
 		return
 	}
 
+	ctx.JSON(200, response)
+}
+
+func (this *Database) UserRefreshHandler(ctx *gin.Context, request *common.UserRefreshRequest) {
+	access, refresh, session, err := RefreshSession(ctx, this.Sessions, userKeys, request.RefreshToken)
+	if err == ErrSessionRevoked {
+		ctx.JSON(401, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{"message": "Error refreshing session", "error": err.Error()})
+		return
+	}
+
+	user, err := this.Users.FindByUsername(ctx, session.Username)
+	if err != nil {
+		ctx.JSON(401, gin.H{"error": "user not found"})
+		return
+	}
+
 	ctx.JSON(200, common.UserLoginResponse{
-		Jwt:  response,
-		User: *user,
+		Jwt:          access,
+		RefreshToken: refresh,
+		User:         *user,
 	})
 }
 
+func (this *Database) UserLogoutHandler(ctx *gin.Context, claims *Claims) {
+	err := RevokeSession(ctx, this.Sessions, claims)
+	if err != nil {
+		ctx.JSON(500, gin.H{"message": "Error logging out", "error": err.Error()})
+		return
+	}
+	this.Clients.disconnect(claims.Username, claims.SessionId)
+
+	ctx.JSON(200, gin.H{"message": "Logged out"})
+}
+
 // func (this *ControllerClass) UpdateUserData(ctx *gin.Context, userUpdateRequest *common.UserUpdateRequest) {
 // 	userCollection := this.UserCollection
 // 	err := UpdateUserData(userCollection, userUpdateRequest)
@@ -242,54 +501,6 @@ func (this *Database) UserLoginHandler(ctx *gin.Context, userModel *common.TUser
 // 	})
 // }
 
-// func (this *ControllerClass) Increase_Time(ctx *gin.Context, param string, username []string, time_to_increase int64) {
-// 	userCollection := this.UserCollection
-
-// 	if len(username) == 0 {
-// 		ctx.JSON(500, gin.H{
-// 			"message": "Empty username",
-// 		})
-// 		return
-// 	}
-
-// 	if len(username) > 1 {
-// 		param = "batch"
-// 	}
-
-// 	switch param {
-// 	case "user":
-// 		err := UpdateUserTestTime(userCollection, username[0], time_to_increase)
-// 		if err != nil {
-// 			ctx.JSON(500, gin.H{
-// 				"message": "Error in increasing time",
-// 				"error":   err,
-// 			})
-// 		}
-// 		ctx.JSON(200, gin.H{
-// 			"message": "Time increased successfully",
-// 		})
-
-// 	case "batch":
-
-// 		err := UpdateBatchTestTime(userCollection, username, time_to_increase)
-// 		if err != nil {
-// 			ctx.JSON(500, gin.H{
-// 				"message": "Error in increasing time",
-// 				"error":   err,
-// 			})
-// 		}
-// 		ctx.JSON(200, gin.H{
-// 			"message": "Time increased successfully",
-// 		})
-
-// 	default:
-// 		ctx.JSON(500, gin.H{
-// 			"message": "Invalid parameter",
-// 		})
-// 	}
-
-// }
-
 // func (this *ControllerClass) GetBatchWiseData(ctx *gin.Context, param string, BatchNumber string, Ranges []int) {
 // 	userCollection := this.UserCollection
 
@@ -393,14 +604,364 @@ func (this *Database) UserLoginHandler(ctx *gin.Context, userModel *common.TUser
 // 	return nil
 // }
 
-func (self *Database) DeleteUser(ctx *gin.Context, userId string) error {
-	userCollection := self.UserCollection
+// moves submitted files out of the submission document into blob storage
+func (this *Database) storeSubmissionFiles(ctx context.Context, submission *common.TestSubmission) error {
+	for _, info := range []*common.AppTestInfo{
+		submission.TestInfo.DocxTestInfo,
+		submission.TestInfo.ExcelTestInfo,
+		submission.TestInfo.PptTestInfo,
+	} {
+		if info == nil || info.FileData == "" {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(info.FileData)
+		if err != nil {
+			return fmt.Errorf("error decoding submitted file: %v", err)
+		}
+		hash, err := this.Storage.Put(ctx, bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("error storing submitted file: %v", err)
+		}
+		info.FileHash = hash
+		info.FileData = ""
+	}
+	return nil
+}
 
-	err := Delete_Model_By_ID(userCollection, userId)
+// checks and stores a submission of the candidate with the username from their token, closes
+// its attempt and grades it. the UserId the app sent is replaced with the candidate's. a
+// submission the server already has under its ClientSubmissionId is not stored again; it is
+// copied into submission and replayed is set
+func (this *Database) SubmitTest(ctx context.Context, username string, submission *common.TestSubmission) (replayed bool, err error) {
+	user, err := this.submittingCandidate(ctx, username, submission.TestId)
+	if err != nil {
+		return false, err
+	}
 
+	submission.Id = primitive.NewObjectID()
+	submission.Superseded = false
+
+	test, err := this.Tests.FindById(ctx, submission.TestId)
+	if err == ErrNotFound {
+		return false, ErrTestNotStarted
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	if test.Type == common.MCQTest && submission.TestInfo.McqTestInfo != nil {
+		err = canonicalMcqAnswers(user.Username, test, submission.TestInfo.McqTestInfo)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	replayed, err = this.acceptSubmission(ctx, user, test, submission)
+	if err != nil || replayed {
+		return replayed, err
+	}
+
+	err = this.Attempts.SetSubmitted(ctx, submission.AttemptId, submission.SubmittedAt, submission.Late)
+	if err != nil {
+		log.Printf("could not close attempt %s: %v", submission.AttemptId.Hex(), err)
+	}
+
+	// the submission is already stored at this point. grading failures must not reject it
+	attempt, err := this.Attempts.FindLatest(ctx, user.Username, submission.TestId)
+	if err != nil || attempt.Id != submission.AttemptId {
+		log.Printf("could not find attempt %s for grading: %v", submission.AttemptId.Hex(), err)
+		attempt = nil
+	}
+	result, err := GradeSubmission(this.Storage, test, attempt, submission)
+	if err != nil {
+		log.Printf("could not grade submission %s: %v", submission.Id.Hex(), err)
+		return false, nil
+	}
+	if result == nil {
+		return false, nil
+	}
+
+	err = this.Results.Add(ctx, result)
+	if err != nil {
+		log.Printf("could not store result of submission %s: %v", submission.Id.Hex(), err)
+	}
+	return false, nil
+}
+
+// the ways a submission is refused. apps tell them apart by code
+func submitErrorStatus(err error) (int, string) {
+	switch err {
+	case ErrUnknownCandidate:
+		return 403, "unknown_candidate"
+	case ErrNotInBatch:
+		return 403, "not_in_batch"
+	case ErrSubmissionClosed:
+		return 403, "submission_closed"
+	case ErrTestNotStarted:
+		return 409, "not_started"
+	case ErrAlreadySubmitted:
+		return 409, "already_submitted"
+	case ErrClientIdTaken:
+		return 409, "id_taken"
+	}
+	return 500, "internal"
+}
+
+func (this *Database) SubmitTestHandler(ctx *gin.Context, username string) {
+	var submission common.TestSubmission
+	if err := ctx.ShouldBindJSON(&submission); err != nil || submission.TestId.IsZero() {
+		ctx.JSON(400, gin.H{"error": "Invalid request body", "code": "invalid_request"})
+		return
+	}
+
+	replayed, err := this.SubmitTest(ctx, username, &submission)
+	if err != nil {
+		status, code := submitErrorStatus(err)
+		if status == 500 {
+			ctx.JSON(status, gin.H{"message": "Error while inserting submission data", "error": err.Error(), "code": code})
+			return
+		}
+		ctx.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	if !replayed {
+		this.Presence.submitted(username, submission.TestId)
+	}
+
+	// replayed is set for an upload the app retried because the answer to it got lost
+	ctx.JSON(200, gin.H{
+		"replayed":           replayed,
+		"clientSubmissionId": submission.ClientSubmissionId,
+		"attemptNumber":      submission.AttemptNumber,
+	})
+}
+
+func (this *Database) AddExamSessionHandler(ctx *gin.Context, session *common.ExamSession) {
+	err := ValidateExamSession(ctx, this.Tests, session)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = this.Exams.Add(ctx, session)
+	if err != nil {
+		ctx.JSON(500, gin.H{"message": "Error adding exam session", "error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"message": "Exam session added successfully", "session": session})
+}
+
+func (this *Database) StartTestHandler(ctx *gin.Context, username string, testId string) {
+	objectID, err := primitive.ObjectIDFromHex(testId)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid test ID format"})
+		return
+	}
+
+	status, err := this.StartAttempt(ctx, username, objectID)
+	switch err {
+	case nil:
+		ctx.JSON(200, status)
+	case ErrNoActiveSession, ErrNoAttemptsLeft:
+		ctx.JSON(403, gin.H{"error": err.Error()})
+	case ErrAlreadySubmitted:
+		ctx.JSON(409, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(500, gin.H{"message": "Error starting test", "error": err.Error()})
+	}
+}
+
+// the clock of the candidate's latest attempt at a test. changes nothing, unlike starting
+func (this *Database) AttemptStatusHandler(ctx *gin.Context, username string, testId string) {
+	objectID, err := primitive.ObjectIDFromHex(testId)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid test ID format"})
+		return
+	}
+
+	attempt, err := this.Attempts.FindLatest(ctx, username, objectID)
+	switch err {
+	case nil:
+		ctx.JSON(200, attemptStatus(attempt, time.Now()))
+	case ErrNotFound:
+		ctx.JSON(404, gin.H{"error": ErrTestNotStarted.Error()})
+	default:
+		ctx.JSON(500, gin.H{"message": "Error finding attempt", "error": err.Error()})
+	}
+}
+
+// a candidate's app fetches the latest snapshot of their running attempt, e.g. when a
+// proctor restored it on a replacement machine
+func (this *Database) LatestSnapshotHandler(ctx *gin.Context, username string, testId string) {
+	objectID, err := primitive.ObjectIDFromHex(testId)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid test ID format"})
+		return
+	}
+
+	snapshot, err := this.LatestSnapshot(ctx, username, objectID)
+	switch err {
+	case nil:
+	case ErrTestNotStarted, ErrNoSnapshot:
+		ctx.JSON(404, gin.H{"error": err.Error()})
+		return
+	case ErrAlreadySubmitted, ErrSubmissionClosed:
+		ctx.JSON(409, gin.H{"error": err.Error()})
+		return
+	default:
+		ctx.JSON(500, gin.H{"message": "Error finding snapshot", "error": err.Error()})
+		return
+	}
+
+	this.BlobHandler(ctx, snapshot.FileHash)
+}
+
+// a candidate's app uploads the document of an office test
+func (this *Database) SnapshotHandler(ctx *gin.Context, username string, testId string) {
+	objectID, err := primitive.ObjectIDFromHex(testId)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid test ID format"})
+		return
+	}
+
+	body := http.MaxBytesReader(ctx.Writer, ctx.Request.Body, snapshotSizeLimit)
+	snapshot, err := this.SaveSnapshot(ctx, username, objectID, body)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		ctx.JSON(200, snapshot)
+	case errors.As(err, &tooLarge):
+		ctx.JSON(413, gin.H{"error": "Document too large"})
+	case err == ErrTestNotStarted, err == ErrAlreadySubmitted:
+		ctx.JSON(409, gin.H{"error": err.Error()})
+	case err == ErrSubmissionClosed:
+		ctx.JSON(403, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(500, gin.H{"message": "Error saving snapshot", "error": err.Error()})
+	}
+}
+
+// whether a file of blob storage is one of the candidate's: a file of a test of their batch
+// or a snapshot of their work
+func (this *Database) CandidateMayRead(ctx context.Context, username string, hash string) (bool, error) {
+	_, err := this.Snapshots.FindByHash(ctx, username, hash)
+	if err == nil {
+		return true, nil
+	}
+	if err != ErrNotFound {
+		return false, err
+	}
+
+	user, err := this.Users.FindByUsername(ctx, username)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	batch, err := this.Batches.FindByName(ctx, user.Batch)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	tests, err := this.Tests.FindByIds(ctx, batch.Tests)
+	if err != nil {
+		return false, err
+	}
+
+	for _, test := range tests {
+		if test.FileHash == hash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sends a file of blob storage. the caller checks who may see it
+func (this *Database) BlobHandler(ctx *gin.Context, hash string) {
+	info, err := this.Storage.Stat(ctx, hash)
+	if err == ErrBlobNotFound {
+		ctx.JSON(404, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	reader, err := this.Storage.Get(ctx, hash)
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	buffered := bufio.NewReader(reader)
+	head, _ := buffered.Peek(512)
+	// blobs never change, but they are not for shared caches
+	ctx.Header("Cache-Control", "private, max-age=31536000, immutable")
+	ctx.DataFromReader(200, info.Size, http.DetectContentType(head), buffered, nil)
+}
+
+func (this *Database) SubmissionsHandler(ctx *gin.Context, username string, testId common.ID) {
+	submissions, err := this.Submissions.FindByUser(ctx, username, testId)
+	if err != nil {
+		ctx.JSON(500, gin.H{"message": "Error fetching submissions", "error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"submissions": submissions})
+}
+
+func (this *Database) SnapshotsHandler(ctx *gin.Context, username string, testId common.ID) {
+	snapshots, err := this.Snapshots.FindByUser(ctx, username, testId)
+	if err != nil {
+		ctx.JSON(500, gin.H{"message": "Error fetching snapshots", "error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"snapshots": snapshots})
+}
+
+func (this *Database) RestoreSnapshotHandler(ctx *gin.Context, username string, testId common.ID) {
+	snapshot, status, err := this.RestoreSnapshot(ctx, username, testId)
+	switch err {
+	case nil:
+	case ErrTestNotStarted, ErrNoSnapshot:
+		ctx.JSON(404, gin.H{"error": err.Error()})
+		return
+	case ErrAlreadySubmitted, ErrSubmissionClosed:
+		ctx.JSON(409, gin.H{"error": err.Error()})
+		return
+	default:
+		ctx.JSON(500, gin.H{"message": "Error restoring snapshot", "error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"message":  fmt.Sprintf("Version %d of the document restored for %s (%s)", snapshot.Version, username, status),
+		"snapshot": snapshot,
+		"status":   status,
+	})
+}
+
+func (this *Database) GetResultsByTest(ctx *gin.Context, testId string) ([]common.Result, error) {
+	objectID, err := primitive.ObjectIDFromHex(testId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID format: %v", err)
+	}
+
+	return this.Results.FindByTest(ctx, objectID)
+}
+
+func (self *Database) DeleteUser(ctx *gin.Context, userId string) error {
+	objectID, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid ID format: %v", err)
+	}
+
+	return self.Users.Delete(ctx, objectID)
 }
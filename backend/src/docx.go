@@ -0,0 +1,306 @@
+package main
+
+import (
+	"common"
+	"fmt"
+	"strings"
+)
+
+type docxRunProps struct {
+	Bold   *ooxmlOnOff `xml:"b"`
+	RStyle *ooxmlVal   `xml:"rStyle"`
+}
+
+type docxRun struct {
+	RPr   *docxRunProps `xml:"rPr"`
+	Texts []string      `xml:"t"`
+}
+
+type docxSectPr struct {
+	PgSz *struct {
+		Orient string `xml:"orient,attr"`
+		W      int    `xml:"w,attr"`
+		H      int    `xml:"h,attr"`
+	} `xml:"pgSz"`
+}
+
+type docxParagraph struct {
+	PPr *struct {
+		PStyle *ooxmlVal   `xml:"pStyle"`
+		SectPr *docxSectPr `xml:"sectPr"`
+	} `xml:"pPr"`
+	Runs       []docxRun `xml:"r"`
+	Hyperlinks []struct {
+		Runs []docxRun `xml:"r"`
+	} `xml:"hyperlink"`
+}
+
+type docxTable struct {
+	GridCols []struct{} `xml:"tblGrid>gridCol"`
+	Rows     []struct {
+		Cells []struct{} `xml:"tc"`
+	} `xml:"tr"`
+}
+
+type docxDocument struct {
+	Body struct {
+		Paragraphs []docxParagraph `xml:"p"`
+		Tables     []docxTable     `xml:"tbl"`
+		SectPr     *docxSectPr     `xml:"sectPr"`
+	} `xml:"body"`
+}
+
+type docxStyles struct {
+	Styles []struct {
+		Id      string        `xml:"styleId,attr"`
+		Name    *ooxmlVal     `xml:"name"`
+		BasedOn *ooxmlVal     `xml:"basedOn"`
+		RPr     *docxRunProps `xml:"rPr"`
+	} `xml:"style"`
+}
+
+type docxFile struct {
+	pkg      *ooxmlPackage
+	document docxDocument
+	// style id -> style name
+	styleNames map[string]string
+	// style id -> style id it is based on
+	styleBase map[string]string
+	// style id -> bold setting of the style itself
+	styleBold map[string]*ooxmlOnOff
+}
+
+func openDocx(data []byte) (*docxFile, error) {
+	pkg, err := openOoxml(data)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &docxFile{
+		pkg:        pkg,
+		styleNames: make(map[string]string),
+		styleBase:  make(map[string]string),
+		styleBold:  make(map[string]*ooxmlOnOff),
+	}
+
+	err = pkg.decode("word/document.xml", &self.document)
+	if err != nil {
+		return nil, err
+	}
+
+	if pkg.has("word/styles.xml") {
+		var styles docxStyles
+		err = pkg.decode("word/styles.xml", &styles)
+		if err != nil {
+			return nil, err
+		}
+		for _, style := range styles.Styles {
+			if style.Name != nil {
+				self.styleNames[style.Id] = style.Name.Val
+			}
+			if style.BasedOn != nil {
+				self.styleBase[style.Id] = style.BasedOn.Val
+			}
+			if style.RPr != nil && style.RPr.Bold != nil {
+				self.styleBold[style.Id] = style.RPr.Bold
+			}
+		}
+	}
+
+	return self, nil
+}
+
+// bold setting inherited from a style and the styles it is based on
+func (self *docxFile) styleIsBold(id string) bool {
+	// guard against cycles in broken documents
+	for i := 0; i < 20 && id != ""; i++ {
+		if bold, ok := self.styleBold[id]; ok {
+			return bold.on()
+		}
+		id = self.styleBase[id]
+	}
+	return false
+}
+
+func (self *docxFile) paragraphStyle(paragraph *docxParagraph) string {
+	if paragraph.PPr == nil || paragraph.PPr.PStyle == nil {
+		return ""
+	}
+	return paragraph.PPr.PStyle.Val
+}
+
+func (self *docxFile) runIsBold(paragraph *docxParagraph, run *docxRun) bool {
+	if run.RPr != nil {
+		if run.RPr.Bold != nil {
+			return run.RPr.Bold.on()
+		}
+		if run.RPr.RStyle != nil && self.styleIsBold(run.RPr.RStyle.Val) {
+			return true
+		}
+	}
+	return self.styleIsBold(self.paragraphStyle(paragraph))
+}
+
+func (self *docxFile) runs(paragraph *docxParagraph) []docxRun {
+	runs := paragraph.Runs
+	for _, link := range paragraph.Hyperlinks {
+		runs = append(runs, link.Runs...)
+	}
+	return runs
+}
+
+func (self *docxFile) paragraphText(paragraph *docxParagraph) string {
+	var text strings.Builder
+	for _, run := range self.runs(paragraph) {
+		for _, t := range run.Texts {
+			text.WriteString(t)
+		}
+	}
+	return text.String()
+}
+
+// body paragraphs that have some text in them
+func (self *docxFile) textParagraphs() []*docxParagraph {
+	paragraphs := []*docxParagraph{}
+	for i := range self.document.Body.Paragraphs {
+		paragraph := &self.document.Body.Paragraphs[i]
+		if strings.TrimSpace(self.paragraphText(paragraph)) != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return paragraphs
+}
+
+func (self *docxFile) sections() []*docxSectPr {
+	sections := []*docxSectPr{}
+	for _, paragraph := range self.document.Body.Paragraphs {
+		if paragraph.PPr != nil && paragraph.PPr.SectPr != nil {
+			sections = append(sections, paragraph.PPr.SectPr)
+		}
+	}
+	if self.document.Body.SectPr != nil {
+		sections = append(sections, self.document.Body.SectPr)
+	}
+	return sections
+}
+
+func normalizeStyleName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, " ", ""))
+}
+
+// the parameters a docx rule needs, checked when the rubric is saved
+func validateDocxRule(rule *common.RubricRule) error {
+	switch rule.Kind {
+	case common.DocxParagraphBold:
+		if rule.Index < 1 {
+			return fmt.Errorf("needs a paragraph number in Index")
+		}
+	case common.DocxHeadingStyle, common.DocxHeaderContains:
+		if strings.TrimSpace(rule.Text) == "" {
+			return fmt.Errorf("needs Text")
+		}
+	case common.DocxTableColumns:
+		if rule.Count < 1 {
+			return fmt.Errorf("needs a number of columns in Count")
+		}
+	case common.DocxOrientation:
+		switch strings.ToLower(strings.TrimSpace(rule.Text)) {
+		case "portrait", "landscape":
+		default:
+			return fmt.Errorf("Text must be 'portrait' or 'landscape'")
+		}
+	}
+	return nil
+}
+
+func (self *docxFile) check(rule *common.RubricRule) (bool, string, error) {
+	switch rule.Kind {
+	case common.DocxParagraphBold:
+		paragraphs := self.textParagraphs()
+		if rule.Index < 1 || rule.Index > len(paragraphs) {
+			return false, fmt.Sprintf("document has %d paragraphs", len(paragraphs)), nil
+		}
+		paragraph := paragraphs[rule.Index-1]
+		for _, run := range self.runs(paragraph) {
+			if strings.TrimSpace(strings.Join(run.Texts, "")) == "" {
+				continue
+			}
+			if !self.runIsBold(paragraph, &run) {
+				return false, fmt.Sprintf("paragraph %d is not bold", rule.Index), nil
+			}
+		}
+		return true, "", nil
+
+	case common.DocxHeadingStyle:
+		want := normalizeStyleName(rule.Text)
+		for _, paragraph := range self.textParagraphs() {
+			id := self.paragraphStyle(paragraph)
+			if id == "" {
+				continue
+			}
+			if normalizeStyleName(id) == want || normalizeStyleName(self.styleNames[id]) == want {
+				return true, "", nil
+			}
+		}
+		return false, fmt.Sprintf("style '%s' is not used", rule.Text), nil
+
+	case common.DocxTableColumns:
+		for _, table := range self.document.Body.Tables {
+			columns := len(table.GridCols)
+			if columns == 0 && len(table.Rows) > 0 {
+				columns = len(table.Rows[0].Cells)
+			}
+			if columns == rule.Count {
+				return true, "", nil
+			}
+		}
+		return false, fmt.Sprintf("no table with %d columns", rule.Count), nil
+
+	case common.DocxOrientation:
+		want := strings.ToLower(strings.TrimSpace(rule.Text))
+		sections := self.sections()
+		if len(sections) == 0 {
+			return want == "portrait", "document has no page setup", nil
+		}
+		for _, section := range sections {
+			orientation := "portrait"
+			if section.PgSz != nil {
+				if section.PgSz.Orient != "" {
+					orientation = strings.ToLower(section.PgSz.Orient)
+				} else if section.PgSz.W > section.PgSz.H {
+					orientation = "landscape"
+				}
+			}
+			if orientation != want {
+				return false, fmt.Sprintf("page orientation is %s", orientation), nil
+			}
+		}
+		return true, "", nil
+
+	case common.DocxHeaderContains:
+		want := strings.ToLower(rule.Text)
+		for _, name := range self.pkg.parts("word", "header") {
+			text, err := self.pkg.text(name, "t")
+			if err != nil {
+				return false, "", err
+			}
+			if strings.Contains(strings.ToLower(text), want) {
+				return true, "", nil
+			}
+		}
+		return false, fmt.Sprintf("no header contains '%s'", rule.Text), nil
+
+	default:
+		return false, "", fmt.Errorf("rule '%s' can not be used for docx tests", rule.Kind)
+	}
+}
+
+func GradeDocx(test *common.Test, data []byte, result *common.Result) error {
+	docx, err := openDocx(data)
+	if err != nil {
+		return err
+	}
+
+	GradeRubric(test.Rubric, docx.check, result)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"common"
+	"testing"
+)
+
+const docxNamespace = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+
+var docxFixture = map[string]string{
+	"word/document.xml": `<w:document ` + docxNamespace + `><w:body>
+		<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Report</w:t></w:r></w:p>
+		<w:p/>
+		<w:p><w:r><w:rPr><w:b/></w:rPr><w:t>bold</w:t></w:r><w:r><w:t xml:space="preserve"> </w:t></w:r></w:p>
+		<w:p><w:r><w:rPr><w:b/></w:rPr><w:t>half</w:t></w:r><w:r><w:rPr><w:b w:val="0"/></w:rPr><w:t>bold</w:t></w:r></w:p>
+		<w:tbl><w:tblGrid><w:gridCol/><w:gridCol/><w:gridCol/></w:tblGrid><w:tr><w:tc/><w:tc/><w:tc/></w:tr></w:tbl>
+		<w:sectPr><w:pgSz w:w="16838" w:h="11906" w:orient="landscape"/></w:sectPr>
+	</w:body></w:document>`,
+	"word/styles.xml": `<w:styles ` + docxNamespace + `>
+		<w:style w:styleId="Heading1"><w:name w:val="heading 1"/><w:rPr><w:b/></w:rPr></w:style>
+	</w:styles>`,
+	"word/header1.xml": `<w:hdr ` + docxNamespace + `><w:p><w:r><w:t>Company </w:t></w:r><w:r><w:t>Confidential</w:t></w:r></w:p></w:hdr>`,
+}
+
+func TestGradeDocx(t *testing.T) {
+	checkRubric(t, GradeDocx, ooxmlFile(t, docxFixture), []rubricCase{
+		{name: "bold from the style", rule: common.RubricRule{Kind: common.DocxParagraphBold, Index: 1}, passed: true},
+		{name: "bold runs", rule: common.RubricRule{Kind: common.DocxParagraphBold, Index: 2}, passed: true},
+		{name: "partly bold", rule: common.RubricRule{Kind: common.DocxParagraphBold, Index: 3}, passed: false, detail: "paragraph 3 is not bold"},
+		{name: "paragraph past the end", rule: common.RubricRule{Kind: common.DocxParagraphBold, Index: 4}, passed: false, detail: "document has 3 paragraphs"},
+
+		{name: "style by name", rule: common.RubricRule{Kind: common.DocxHeadingStyle, Text: "Heading 1"}, passed: true},
+		{name: "style by id", rule: common.RubricRule{Kind: common.DocxHeadingStyle, Text: "heading1"}, passed: true},
+		{name: "unused style", rule: common.RubricRule{Kind: common.DocxHeadingStyle, Text: "Heading 2"}, passed: false},
+
+		{name: "table columns", rule: common.RubricRule{Kind: common.DocxTableColumns, Count: 3}, passed: true},
+		{name: "wrong table columns", rule: common.RubricRule{Kind: common.DocxTableColumns, Count: 2}, passed: false},
+
+		{name: "orientation", rule: common.RubricRule{Kind: common.DocxOrientation, Text: "Landscape"}, passed: true},
+		{name: "wrong orientation", rule: common.RubricRule{Kind: common.DocxOrientation, Text: "portrait"}, passed: false, detail: "page orientation is landscape"},
+
+		{name: "header text across runs", rule: common.RubricRule{Kind: common.DocxHeaderContains, Text: "company confidential"}, passed: true},
+		{name: "missing header text", rule: common.RubricRule{Kind: common.DocxHeaderContains, Text: "draft"}, passed: false},
+	})
+}
+
+func TestGradeDocxPageSize(t *testing.T) {
+	// without orient the page is landscape when it is wider than high
+	data := ooxmlFile(t, map[string]string{
+		"word/document.xml": `<w:document ` + docxNamespace + `><w:body>
+			<w:sectPr><w:pgSz w:w="11906" w:h="16838"/></w:sectPr>
+		</w:body></w:document>`,
+	})
+	checkRubric(t, GradeDocx, data, []rubricCase{
+		{name: "portrait", rule: common.RubricRule{Kind: common.DocxOrientation, Text: "portrait"}, passed: true},
+		{name: "landscape", rule: common.RubricRule{Kind: common.DocxOrientation, Text: "landscape"}, passed: false},
+		{name: "no header", rule: common.RubricRule{Kind: common.DocxHeaderContains, Text: "x"}, passed: false},
+	})
+}
+
+func TestGradeDocxBrokenDocument(t *testing.T) {
+	data := ooxmlFile(t, map[string]string{"word/styles.xml": "<w:styles/>"})
+	if err := GradeDocx(&common.Test{}, data, &common.Result{}); err == nil {
+		t.Fatal("want an error for a document without word/document.xml")
+	}
+}
+
+func TestValidateRubricDocx(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  common.RubricRule
+		valid bool
+	}{
+		{"bold paragraph", common.RubricRule{Kind: common.DocxParagraphBold, Index: 1}, true},
+		{"bold without paragraph", common.RubricRule{Kind: common.DocxParagraphBold}, false},
+		{"heading style", common.RubricRule{Kind: common.DocxHeadingStyle, Text: "Heading 1"}, true},
+		{"heading without style", common.RubricRule{Kind: common.DocxHeadingStyle, Text: " "}, false},
+		{"table columns", common.RubricRule{Kind: common.DocxTableColumns, Count: 2}, true},
+		{"table without columns", common.RubricRule{Kind: common.DocxTableColumns}, false},
+		{"orientation", common.RubricRule{Kind: common.DocxOrientation, Text: "Portrait"}, true},
+		{"unknown orientation", common.RubricRule{Kind: common.DocxOrientation, Text: "sideways"}, false},
+		{"header text", common.RubricRule{Kind: common.DocxHeaderContains, Text: "Confidential"}, true},
+		{"header without text", common.RubricRule{Kind: common.DocxHeaderContains}, false},
+		{"negative marks", common.RubricRule{Kind: common.DocxTableColumns, Count: 2, Marks: -1}, false},
+		{"unknown kind", common.RubricRule{Kind: "docx_font"}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateRubric(common.DocxTest, []common.RubricRule{c.rule})
+			if (err == nil) != c.valid {
+				t.Fatalf("got %v, want valid %v", err, c.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"common"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoActiveSession  = errors.New("no exam session is running for this test")
+	ErrTestNotStarted   = errors.New("test was not started")
+	ErrAlreadySubmitted = errors.New("test was already submitted")
+	ErrSubmissionClosed = errors.New("the time for this test is over")
+	ErrNoAttemptsLeft   = errors.New("no attempts left for this test")
+	ErrClientIdTaken    = errors.New("submission id is used by another candidate")
+	ErrUnknownCandidate = errors.New("candidate does not exist")
+	ErrNotInBatch       = errors.New("test is not part of your batch")
+)
+
+// starting the same test twice at once must not create two attempts
+var attemptMutex sync.Mutex
+
+// the same submission arriving twice at once must be stored once
+var submitMutex sync.Mutex
+
+// how often ended sessions are checked for candidates to finish
+const sessionWatchInterval = 5 * time.Second
+
+// candidates already told that a session is over. "<session id>/<username>" -> true
+var finishedCandidates sync.Map
+
+// SUBMIT_GRACE_PERIOD (default 2m) covers the time a submission takes to reach the server.
+// submissions within it are accepted but flagged late
+func submitGracePeriod() time.Duration {
+	return getEnvDuration("SUBMIT_GRACE_PERIOD", 2*time.Minute)
+}
+
+func attemptStatus(attempt *common.Attempt, now time.Time) *common.AttemptStatus {
+	return &common.AttemptStatus{
+		AttemptId: attempt.Id,
+		TestId:    attempt.TestId,
+		Deadline:  attempt.Deadline,
+		Remaining: max(int64(attempt.Deadline.Sub(now).Seconds()), 0),
+	}
+}
+
+// whether an attempt still takes submissions (and snapshots of the work on it): until its
+// deadline plus the grace period, and once submitted only with SubmitLastWins, where the
+// candidate may submit again
+func checkAttemptOpen(attempt *common.Attempt, policy common.SubmissionPolicy, now time.Time) error {
+	if !attempt.SubmittedAt.IsZero() && policy != common.SubmitLastWins {
+		return ErrAlreadySubmitted
+	}
+	if now.After(attempt.Deadline.Add(submitGracePeriod())) {
+		return ErrSubmissionClosed
+	}
+	return nil
+}
+
+func ValidateExamSession(ctx context.Context, tests TestRepository, session *common.ExamSession) error {
+	if session.Name == "" || session.Batch == "" {
+		return fmt.Errorf("name and batch are required")
+	}
+	if !session.EndsAt.After(session.StartsAt) {
+		return fmt.Errorf("session must end after it starts")
+	}
+	if len(session.Tests) == 0 {
+		return fmt.Errorf("session has no tests")
+	}
+	for _, st := range session.Tests {
+		if st.Duration < 0 {
+			return fmt.Errorf("negative duration for test %s", st.TestId.Hex())
+		}
+		_, err := tests.FindById(ctx, st.TestId)
+		if err != nil {
+			return fmt.Errorf("unknown test %s", st.TestId.Hex())
+		}
+	}
+	return nil
+}
+
+// starts the clock for a candidate at a test of a session that is running right now.
+// starting again (e.g. after the app restarted) returns the running attempt, so the
+// candidate does not get a fresh clock. so does starting a submitted SubmitLastWins test
+// before its deadline. a submitted SubmitMultiple test gets a new attempt
+func (this *Database) StartAttempt(ctx context.Context, username string, testId common.ID) (*common.AttemptStatus, error) {
+	now := time.Now()
+
+	user, err := this.Users.FindByUsername(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	sessions, err := this.Exams.FindActive(ctx, user.Batch, now)
+	if err != nil {
+		return nil, err
+	}
+	var session *common.ExamSession
+	var sessionTest common.SessionTest
+	for i := range sessions {
+		for _, st := range sessions[i].Tests {
+			if st.TestId == testId {
+				session = &sessions[i]
+				sessionTest = st
+			}
+		}
+	}
+	if session == nil {
+		return nil, ErrNoActiveSession
+	}
+
+	test, err := this.Tests.FindById(ctx, testId)
+	if err != nil {
+		return nil, fmt.Errorf("error finding test: %v", err)
+	}
+
+	attemptMutex.Lock()
+	defer attemptMutex.Unlock()
+
+	number := 1
+	latest, err := this.Attempts.FindLatest(ctx, username, testId)
+	switch err {
+	case nil:
+		number = max(latest.Number, 1) + 1
+		if latest.SessionId != session.Id {
+			break
+		}
+		switch {
+		case latest.SubmittedAt.IsZero():
+			return attemptStatus(latest, now), nil
+		case test.SubmissionPolicy == common.SubmitLastWins && now.Before(latest.Deadline):
+			return attemptStatus(latest, now), nil
+		case test.SubmissionPolicy != common.SubmitMultiple:
+			return nil, ErrAlreadySubmitted
+		}
+		if test.MaxAttempts > 0 {
+			attempts, err := this.Attempts.FindBySession(ctx, session.Id)
+			if err != nil {
+				return nil, err
+			}
+			taken := 0
+			for _, attempt := range attempts {
+				if attempt.Username == username && attempt.TestId == testId {
+					taken++
+				}
+			}
+			if taken >= test.MaxAttempts {
+				return nil, ErrNoAttemptsLeft
+			}
+		}
+	case ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	duration := sessionTest.Duration
+	if duration == 0 {
+		duration = test.Duration
+	}
+
+	deadline := now.Add(time.Duration(duration) * time.Minute)
+	if deadline.After(session.EndsAt) {
+		deadline = session.EndsAt
+	}
+
+	attempt := &common.Attempt{
+		SessionId: session.Id,
+		Username:  username,
+		TestId:    testId,
+		Number:    number,
+		StartedAt: now,
+		Deadline:  deadline,
+	}
+	err = this.Attempts.Add(ctx, attempt)
+	if err != nil {
+		return nil, err
+	}
+	return attemptStatus(attempt, now), nil
+}
+
+// the candidate a submission comes from, as told by their token. the test has to be one of
+// their batch's tests
+func (this *Database) submittingCandidate(ctx context.Context, username string, testId common.ID) (*common.User, error) {
+	user, err := this.Users.FindByUsername(ctx, username)
+	if err == ErrNotFound {
+		return nil, ErrUnknownCandidate
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := this.Batches.FindByName(ctx, user.Batch)
+	if err == ErrNotFound {
+		return nil, ErrNotInBatch
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range batch.Tests {
+		if id == testId {
+			return user, nil
+		}
+	}
+	return nil, ErrNotInBatch
+}
+
+// checks a submission against the candidate's attempt at the test and ties it to the
+// attempt. the attempt has to belong to a session of the candidate's batch. late
+// submissions within the grace period are flagged, later ones are refused. SubmitTest
+// closes the attempt once the submission is stored
+func (this *Database) CheckAttempt(ctx context.Context, user *common.User, test *common.Test, submission *common.TestSubmission) error {
+	now := time.Now()
+
+	attempt, err := this.Attempts.FindLatest(ctx, user.Username, submission.TestId)
+	if err == ErrNotFound {
+		return ErrTestNotStarted
+	}
+	if err != nil {
+		return err
+	}
+	if !attempt.SubmittedAt.IsZero() && test.SubmissionPolicy != common.SubmitLastWins {
+		return ErrAlreadySubmitted
+	}
+
+	// the candidate may have been moved to another batch since they started
+	session, err := this.Exams.FindById(ctx, attempt.SessionId)
+	if err != nil {
+		return fmt.Errorf("error finding session of attempt: %v", err)
+	}
+	if session.Batch != user.Batch || !slices.ContainsFunc(session.Tests, func(st common.SessionTest) bool {
+		return st.TestId == submission.TestId
+	}) {
+		return ErrNotInBatch
+	}
+
+	late := now.After(attempt.Deadline)
+	if late && now.After(attempt.Deadline.Add(submitGracePeriod())) {
+		return ErrSubmissionClosed
+	}
+
+	submission.UserId = user.Id
+	submission.Username = user.Username
+	submission.AttemptId = attempt.Id
+	submission.AttemptNumber = max(attempt.Number, 1)
+	submission.SubmittedAt = now
+	submission.Late = late
+	return nil
+}
+
+// ties a submission to the candidate's attempt and stores it, unless the server already has
+// it under its ClientSubmissionId. then the stored one is copied into submission and
+// replayed is set
+func (this *Database) acceptSubmission(ctx context.Context, user *common.User, test *common.Test, submission *common.TestSubmission) (replayed bool, err error) {
+	submitMutex.Lock()
+	defer submitMutex.Unlock()
+
+	received, err := this.receivedSubmission(ctx, user.Username, submission.ClientSubmissionId)
+	if err != nil {
+		return false, err
+	}
+	if received != nil {
+		*submission = *received
+		return true, nil
+	}
+
+	err = this.CheckAttempt(ctx, user, test, submission)
+	if err != nil {
+		return false, err
+	}
+	return false, this.storeSubmission(ctx, test.SubmissionPolicy, submission)
+}
+
+// the submission stored under the id the app made up for it, nil if there is none. apps
+// upload again when the answer to an upload got lost
+func (this *Database) receivedSubmission(ctx context.Context, username string, clientSubmissionId string) (*common.TestSubmission, error) {
+	if clientSubmissionId == "" {
+		return nil, nil
+	}
+	submission, err := this.Submissions.FindByClientId(ctx, clientSubmissionId)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if submission.Username != username {
+		return nil, ErrClientIdTaken
+	}
+	return submission, nil
+}
+
+// stores a checked submission as the one of its attempt that counts. with SubmitLastWins
+// the submission it replaces is marked superseded, otherwise an attempt that already has a
+// submission gets ErrAlreadySubmitted
+func (this *Database) storeSubmission(ctx context.Context, policy common.SubmissionPolicy, submission *common.TestSubmission) error {
+	previous, err := this.Submissions.FindCurrent(ctx, submission.AttemptId)
+	switch {
+	case err == ErrNotFound:
+		previous = nil
+	case err != nil:
+		return err
+	case policy != common.SubmitLastWins:
+		return ErrAlreadySubmitted
+	}
+
+	// files go to blob storage only once the submission is taken, refused ones would be
+	// left behind there
+	err = this.storeSubmissionFiles(ctx, submission)
+	if err != nil {
+		return err
+	}
+
+	if previous != nil {
+		err = this.Submissions.SetSuperseded(ctx, previous.Id, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = this.Submissions.Add(ctx, submission)
+	if err != nil {
+		if previous != nil {
+			if err := this.Submissions.SetSuperseded(ctx, previous.Id, false); err != nil {
+				log.Printf("could not restore submission %s: %v", previous.Id.Hex(), err)
+			}
+		}
+		if err == ErrDuplicate {
+			return ErrAlreadySubmitted
+		}
+		return err
+	}
+
+	if previous != nil {
+		err = this.Results.SetSuperseded(ctx, previous.Id, true)
+		if err != nil {
+			log.Printf("could not mark result of submission %s superseded: %v", previous.Id.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// gives extra minutes to the running attempts of the users, at one test or at all of them
+// (zero testId), and pushes the new deadlines to the candidates' apps. submitted attempts,
+// attempts past their deadline and grace period and those of finished sessions are left alone
+func (this *Database) ExtendTime(ctx context.Context, usernames []string, testId common.ID, minutes int) ([]common.Attempt, error) {
+	if minutes <= 0 {
+		return nil, fmt.Errorf("minutes must be positive")
+	}
+
+	attemptMutex.Lock()
+	defer attemptMutex.Unlock()
+
+	now := time.Now()
+	// session id -> whether it is running
+	running := map[common.ID]bool{}
+	extended := []common.Attempt{}
+	for _, username := range usernames {
+		attempts, err := this.Attempts.FindOpen(ctx, username)
+		if err != nil {
+			return extended, err
+		}
+
+		for _, attempt := range attempts {
+			if !testId.IsZero() && attempt.TestId != testId {
+				continue
+			}
+			if !attempt.Deadline.Add(submitGracePeriod()).After(now) {
+				continue
+			}
+			isRunning, known := running[attempt.SessionId]
+			if !known {
+				session, err := this.Exams.FindById(ctx, attempt.SessionId)
+				if err != nil && err != ErrNotFound {
+					return extended, err
+				}
+				// sessions stay unfinished past their end while candidates have extra time left
+				isRunning = err == nil && !session.Finished && !session.StartsAt.After(now)
+				running[attempt.SessionId] = isRunning
+			}
+			if !isRunning {
+				continue
+			}
+
+			attempt.Deadline = attempt.Deadline.Add(time.Duration(minutes) * time.Minute)
+			attempt.ExtraMinutes += minutes
+			err = this.Attempts.SetDeadline(ctx, attempt.Id, attempt.Deadline, attempt.ExtraMinutes)
+			if err != nil {
+				return extended, err
+			}
+			extended = append(extended, attempt)
+
+			this.Clients.notify(username, common.NewMessage(common.TDeadlineChanged{
+				TestId:    attempt.TestId,
+				Remaining: attemptStatus(&attempt, now).Remaining,
+				Minutes:   minutes,
+			}))
+		}
+	}
+	return extended, nil
+}
+
+// tells the candidates of a session that it is over, so their apps submit what they have.
+// candidates whose extra time runs past the end of the session are left for later, unless
+// force is set, which also ends their attempts right away. the session is marked finished
+// once nobody is left. returns the deliveries and how many candidates are left
+func (this *Database) FinishSession(ctx context.Context, session *common.ExamSession, force bool) ([]Delivery, int, error) {
+	now := time.Now()
+
+	users, err := this.Users.FindByBatch(ctx, session.Batch)
+	if err != nil {
+		return nil, 0, err
+	}
+	attempts, err := this.Attempts.FindBySession(ctx, session.Id)
+	if err != nil {
+		return nil, 0, err
+	}
+	running := map[string][]common.Attempt{}
+	for _, attempt := range attempts {
+		if attempt.SubmittedAt.IsZero() && attempt.Deadline.After(now) {
+			running[attempt.Username] = append(running[attempt.Username], attempt)
+		}
+	}
+
+	msg := common.NewMessage(common.TTestFinished{})
+	deliveries := []Delivery{}
+	pending := 0
+	for _, user := range users {
+		if len(running[user.Username]) > 0 {
+			if !force {
+				pending++
+				continue
+			}
+			err = this.endAttempts(ctx, running[user.Username], now)
+			if err != nil {
+				return deliveries, 0, err
+			}
+		}
+
+		_, told := finishedCandidates.LoadOrStore(session.Id.Hex()+"/"+user.Username, true)
+		if told && !force {
+			continue
+		}
+		deliveries = append(deliveries, Delivery{
+			Username: user.Username,
+			Status:   this.Clients.notify(user.Username, msg),
+		})
+	}
+
+	if pending == 0 {
+		err = this.Exams.SetFinished(ctx, session.Id)
+		if err != nil {
+			return deliveries, 0, err
+		}
+		log.Printf("exam session '%s' finished", session.Name)
+	}
+	return deliveries, pending, nil
+}
+
+// moves the deadlines of running attempts to now. the app's automatic submission lands in
+// the grace period
+func (this *Database) endAttempts(ctx context.Context, attempts []common.Attempt, now time.Time) error {
+	attemptMutex.Lock()
+	defer attemptMutex.Unlock()
+
+	for _, attempt := range attempts {
+		err := this.Attempts.SetDeadline(ctx, attempt.Id, now, attempt.ExtraMinutes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishes sessions as they end. runs until ctx is done
+func (this *Database) WatchSessions(ctx context.Context) {
+	ticker := time.NewTicker(sessionWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sessions, err := this.Exams.FindEnded(ctx, time.Now())
+		if err != nil {
+			log.Println("error finding ended sessions:", err)
+			continue
+		}
+		for i := range sessions {
+			_, _, err := this.FinishSession(ctx, &sessions[i], false)
+			if err != nil {
+				log.Printf("error finishing session '%s': %v", sessions[i].Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"common"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testDatabase(t *testing.T) *Database {
+	t.Helper()
+	repos, err := NewBoltRepositories(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Database{Repositories: repos, Clients: &ClientsCtx{}}
+}
+
+func TestExtendTime(t *testing.T) {
+	ctx := context.Background()
+	db := testDatabase(t)
+	// bson keeps milliseconds only
+	now := time.Now().Truncate(time.Second)
+
+	running := &common.ExamSession{Name: "running", Batch: "b1", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}
+	// over, with a candidate still in their extra time
+	overtime := &common.ExamSession{Name: "overtime", Batch: "b1", StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Minute)}
+	finished := &common.ExamSession{Name: "finished", Batch: "b1", StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour), Finished: true}
+	for _, session := range []*common.ExamSession{running, overtime, finished} {
+		if err := db.Exams.Add(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testId := primitive.NewObjectID()
+	attempts := []struct {
+		name     string
+		attempt  common.Attempt
+		extended bool
+	}{
+		{"running", common.Attempt{SessionId: running.Id, Deadline: now.Add(10 * time.Minute)}, true},
+		{"in the grace period", common.Attempt{SessionId: running.Id, Deadline: now.Add(-submitGracePeriod() / 2)}, true},
+		{"extra time past the session", common.Attempt{SessionId: overtime.Id, Deadline: now.Add(10 * time.Minute)}, true},
+		{"past the grace period", common.Attempt{SessionId: running.Id, Deadline: now.Add(-submitGracePeriod() - time.Minute)}, false},
+		{"finished session", common.Attempt{SessionId: finished.Id, Deadline: now.Add(10 * time.Minute)}, false},
+		{"unknown session", common.Attempt{SessionId: primitive.NewObjectID(), Deadline: now.Add(10 * time.Minute)}, false},
+		{"submitted", common.Attempt{SessionId: running.Id, Deadline: now.Add(10 * time.Minute), SubmittedAt: now}, false},
+	}
+	for i := range attempts {
+		attempts[i].attempt.Username = "alice"
+		attempts[i].attempt.TestId = testId
+		if err := db.Attempts.Add(ctx, &attempts[i].attempt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	extended, err := db.ExtendTime(ctx, []string{"alice"}, testId, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[common.ID]common.Attempt{}
+	for _, attempt := range extended {
+		got[attempt.Id] = attempt
+	}
+	for _, c := range attempts {
+		attempt, ok := got[c.attempt.Id]
+		if ok != c.extended {
+			t.Errorf("%s: extended %v, want %v", c.name, ok, c.extended)
+			continue
+		}
+		if ok && (!attempt.Deadline.Equal(c.attempt.Deadline.Add(5*time.Minute)) || attempt.ExtraMinutes != 5) {
+			t.Errorf("%s: deadline %v with %d extra minutes", c.name, attempt.Deadline, attempt.ExtraMinutes)
+		}
+	}
+
+	// only the extended attempts were told about their new deadline
+	client := db.Clients.addClient("alice")
+	if len(client.send) != len(extended) {
+		t.Errorf("%d deadline messages for %d extended attempts", len(client.send), len(extended))
+	}
+}
+
+func TestCheckAttemptOpen(t *testing.T) {
+	now := time.Now()
+	running := common.Attempt{Deadline: now.Add(time.Minute)}
+	inGrace := common.Attempt{Deadline: now.Add(-submitGracePeriod() / 2)}
+	over := common.Attempt{Deadline: now.Add(-submitGracePeriod() - time.Second)}
+	submitted := common.Attempt{Deadline: now.Add(time.Minute), SubmittedAt: now}
+	submittedOver := common.Attempt{Deadline: now.Add(-submitGracePeriod() - time.Second), SubmittedAt: now}
+
+	cases := []struct {
+		name    string
+		attempt common.Attempt
+		policy  common.SubmissionPolicy
+		want    error
+	}{
+		{"running", running, common.SubmitOnce, nil},
+		{"in the grace period", inGrace, common.SubmitOnce, nil},
+		{"past the grace period", over, common.SubmitOnce, ErrSubmissionClosed},
+		{"submitted", submitted, common.SubmitOnce, ErrAlreadySubmitted},
+		{"submitted, multiple", submitted, common.SubmitMultiple, ErrAlreadySubmitted},
+		{"submitted, last wins", submitted, common.SubmitLastWins, nil},
+		{"submitted, last wins, past the grace period", submittedOver, common.SubmitLastWins, ErrSubmissionClosed},
+	}
+	for _, c := range cases {
+		if got := checkAttemptOpen(&c.attempt, c.policy, now); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
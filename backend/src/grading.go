@@ -0,0 +1,252 @@
+package main
+
+import (
+	"common"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// grades a submission against the test it was submitted for. attempt is the one the
+// submission closed, nil if it is not known.
+// returns nil if this type of test is not graded automatically
+func GradeSubmission(store Storage, test *common.Test, attempt *common.Attempt, submission *common.TestSubmission) (*common.Result, error) {
+	result := &common.Result{
+		SubmissionId: submission.Id,
+		UserId:       submission.UserId,
+		TestId:       submission.TestId,
+	}
+
+	switch test.Type {
+	case common.MCQTest:
+		if submission.TestInfo.McqTestInfo == nil {
+			return nil, fmt.Errorf("submission has no mcq answers")
+		}
+		err := GradeMcq(test, submission.TestInfo.McqTestInfo, result)
+		if err != nil {
+			return nil, err
+		}
+	case common.TypingTest:
+		if submission.TestInfo.TypingTestInfo == nil {
+			return nil, fmt.Errorf("submission has no typing test info")
+		}
+		typing := ScoreTyping(test, submission.TestInfo.TypingTestInfo, attempt, submission.SubmittedAt)
+		result.Typing = typing
+		result.Score = typing.NetWPM
+	case common.DocxTest:
+		if len(test.Rubric) == 0 {
+			return nil, nil
+		}
+		data, err := appTestFileData(store, submission.TestInfo.DocxTestInfo)
+		if err != nil {
+			return nil, err
+		}
+		err = GradeDocx(test, data, result)
+		if err != nil {
+			return nil, err
+		}
+	case common.ExcelTest:
+		if len(test.Rubric) == 0 {
+			return nil, nil
+		}
+		data, err := appTestFileData(store, submission.TestInfo.ExcelTestInfo)
+		if err != nil {
+			return nil, err
+		}
+		err = GradeXlsx(test, data, result)
+		if err != nil {
+			return nil, err
+		}
+	case common.PptTest:
+		if len(test.Rubric) == 0 {
+			return nil, nil
+		}
+		data, err := appTestFileData(store, submission.TestInfo.PptTestInfo)
+		if err != nil {
+			return nil, err
+		}
+		err = GradePptx(test, data, result)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	return result, nil
+}
+
+func appTestFileData(store Storage, info *common.AppTestInfo) ([]byte, error) {
+	if info == nil {
+		return nil, fmt.Errorf("submission has no file")
+	}
+	if info.FileHash != "" {
+		reader, err := store.Get(context.TODO(), info.FileHash)
+		if err != nil {
+			return nil, fmt.Errorf("error reading submitted file: %v", err)
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(info.FileData)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding submitted file: %v", err)
+	}
+	return data, nil
+}
+
+// test type each kind of rubric rule can be used with
+var rubricRuleTestTypes = map[common.RuleKind]common.TestType{
+	common.DocxParagraphBold:  common.DocxTest,
+	common.DocxHeadingStyle:   common.DocxTest,
+	common.DocxTableColumns:   common.DocxTest,
+	common.DocxOrientation:    common.DocxTest,
+	common.DocxHeaderContains: common.DocxTest,
+
+	common.XlsxCellEquals:            common.ExcelTest,
+	common.XlsxCellFormula:           common.ExcelTest,
+	common.XlsxNumberFormat:          common.ExcelTest,
+	common.XlsxConditionalFormatting: common.ExcelTest,
+	common.XlsxChartExists:           common.ExcelTest,
+	common.XlsxSortedRange:           common.ExcelTest,
+	common.XlsxNamedRange:            common.ExcelTest,
+
+	common.PptxSlideCount:    common.PptTest,
+	common.PptxSlideTitle:    common.PptTest,
+	common.PptxLayoutUsed:    common.PptTest,
+	common.PptxImageInserted: common.PptTest,
+	common.PptxTransition:    common.PptTest,
+	common.PptxAnimation:     common.PptTest,
+	common.PptxSpeakerNotes:  common.PptTest,
+	common.PptxThemeApplied:  common.PptTest,
+}
+
+func ValidateRubric(testType common.TestType, rubric []common.RubricRule) error {
+	for i, rule := range rubric {
+		typ, ok := rubricRuleTestTypes[rule.Kind]
+		if !ok {
+			return fmt.Errorf("rule %d: unknown rule kind '%s'", i+1, rule.Kind)
+		}
+		if typ != testType {
+			return fmt.Errorf("rule %d: '%s' can not be used for %s tests", i+1, rule.Kind, testType)
+		}
+		if rule.Marks < 0 {
+			return fmt.Errorf("rule %d: marks can not be negative", i+1)
+		}
+
+		var err error
+		switch testType {
+		case common.DocxTest:
+			err = validateDocxRule(&rule)
+		case common.ExcelTest:
+			err = validateXlsxRule(&rule)
+		case common.PptTest:
+			err = validatePptxRule(&rule)
+		}
+		if err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// evaluates every rule of a rubric and records the per rule results. a rule that can not
+// be evaluated counts as failed
+func GradeRubric(rubric []common.RubricRule, check func(rule *common.RubricRule) (bool, string, error), result *common.Result) {
+	result.Rules = make([]common.RuleResult, len(rubric))
+	for i := range rubric {
+		rule := &rubric[i]
+		marks := rule.Marks
+		if marks == 0 {
+			marks = 1
+		}
+		result.MaxScore += marks
+
+		passed, detail, err := check(rule)
+		if err != nil {
+			passed = false
+			detail = err.Error()
+		}
+
+		result.Rules[i] = common.RuleResult{
+			Kind:        rule.Kind,
+			Description: rule.Description,
+			Passed:      passed,
+			Detail:      detail,
+		}
+		if passed {
+			result.Rules[i].Marks = marks
+			result.Score += marks
+		}
+	}
+}
+
+func GradeMcq(test *common.Test, info *common.McqTestInfo, result *common.Result) error {
+	questions, err := test.GetMCQQuestions()
+	if err != nil {
+		return fmt.Errorf("error decoding mcq questions: %v", err)
+	}
+
+	result.Questions = make([]common.QuestionResult, len(questions))
+	for i, question := range questions {
+		marks := question.Marks
+		if marks == 0 {
+			marks = 1
+		}
+		result.MaxScore += marks
+
+		var answer *int
+		if i < len(info.Answers) {
+			answer = info.Answers[i]
+		}
+		result.Questions[i].Answer = answer
+		if answer == nil {
+			continue
+		}
+
+		correct, err := McqAnswerIndex(&question)
+		if err != nil {
+			return fmt.Errorf("question %d: %v", i+1, err)
+		}
+
+		if *answer == correct {
+			result.Questions[i].Correct = true
+			result.Questions[i].Marks = marks
+		} else {
+			result.Questions[i].Marks = -test.NegativeMarks
+		}
+		result.Score += result.Questions[i].Marks
+	}
+
+	return nil
+}
+
+// resolves the answer key of a question to the index of the correct option.
+// the key is matched against the option text first, then as an option letter (A, B, ..)
+// and finally as a 1 based option number.
+func McqAnswerIndex(question *common.MCQ) (int, error) {
+	answer := strings.TrimSpace(question.Answer)
+
+	for i, option := range question.Options {
+		if strings.EqualFold(strings.TrimSpace(option), answer) {
+			return i, nil
+		}
+	}
+
+	if len(answer) == 1 {
+		letter := strings.ToUpper(answer)[0]
+		if letter >= 'A' && int(letter-'A') < len(question.Options) {
+			return int(letter - 'A'), nil
+		}
+	}
+
+	if num, err := strconv.Atoi(answer); err == nil && num >= 1 && num <= len(question.Options) {
+		return num - 1, nil
+	}
+
+	return 0, fmt.Errorf("answer '%s' does not match any option", question.Answer)
+}
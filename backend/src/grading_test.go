@@ -0,0 +1,163 @@
+package main
+
+import (
+	"common"
+	"encoding/json"
+	"testing"
+)
+
+func mcqTest(t *testing.T, negativeMarks float64, questions ...common.MCQ) *common.Test {
+	t.Helper()
+	data, err := json.Marshal(questions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &common.Test{Type: common.MCQTest, McqJson: string(data), NegativeMarks: negativeMarks}
+}
+
+func answer(i int) *int {
+	return &i
+}
+
+func TestMcqAnswerIndex(t *testing.T) {
+	options := []string{"Paris", "London", "Berlin", "Rome"}
+	cases := []struct {
+		name   string
+		answer string
+		want   int
+		err    bool
+	}{
+		{"option text", "Berlin", 2, false},
+		{"option text ignores case and spaces", "  london ", 1, false},
+		{"letter", "D", 3, false},
+		{"lower case letter", "a", 0, false},
+		{"number", "2", 1, false},
+		{"letter past the options", "E", 0, true},
+		{"number past the options", "5", 0, true},
+		{"number zero", "0", 0, true},
+		{"unknown text", "Madrid", 0, true},
+		{"empty", "", 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := McqAnswerIndex(&common.MCQ{Options: options, Answer: c.answer})
+			if c.err {
+				if err == nil {
+					t.Fatalf("got %d, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Fatalf("got %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMcqAnswerIndexPrefersOptionText(t *testing.T) {
+	// "B" is the text of the first option, not the letter of the second
+	got, err := McqAnswerIndex(&common.MCQ{Options: []string{"B", "A"}, Answer: "B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 0 {
+		t.Fatalf("got %d, want 0", got)
+	}
+}
+
+func TestGradeMcq(t *testing.T) {
+	questions := []common.MCQ{
+		{Question: "1 + 1", Options: []string{"1", "2", "3"}, Answer: "B"},
+		{Question: "capital of france", Options: []string{"Paris", "Rome"}, Answer: "Paris"},
+		{Question: "3 * 3", Options: []string{"6", "9"}, Answer: "2", Marks: 4},
+	}
+	cases := []struct {
+		name          string
+		negativeMarks float64
+		answers       []*int
+		score         float64
+		correct       []bool
+		marks         []float64
+	}{
+		{
+			name:    "all correct",
+			answers: []*int{answer(1), answer(0), answer(1)},
+			score:   6,
+			correct: []bool{true, true, true},
+			marks:   []float64{1, 1, 4},
+		},
+		{
+			name:    "all wrong",
+			answers: []*int{answer(0), answer(1), answer(0)},
+			score:   0,
+			correct: []bool{false, false, false},
+			marks:   []float64{0, 0, 0},
+		},
+		{
+			name:          "wrong answers lose the negative marks",
+			negativeMarks: 0.25,
+			answers:       []*int{answer(2), answer(0), answer(0)},
+			score:         0.5,
+			correct:       []bool{false, true, false},
+			marks:         []float64{-0.25, 1, -0.25},
+		},
+		{
+			name:          "unanswered questions are not penalised",
+			negativeMarks: 1,
+			answers:       []*int{nil, answer(0)},
+			score:         1,
+			correct:       []bool{false, true, false},
+			marks:         []float64{0, 1, 0},
+		},
+		{
+			name:          "an index that is not an option is wrong",
+			negativeMarks: 0.5,
+			answers:       []*int{answer(7), answer(-1), answer(1)},
+			score:         3,
+			correct:       []bool{false, false, true},
+			marks:         []float64{-0.5, -0.5, 4},
+		},
+		{
+			name:    "no answers",
+			answers: nil,
+			score:   0,
+			correct: []bool{false, false, false},
+			marks:   []float64{0, 0, 0},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			test := mcqTest(t, c.negativeMarks, questions...)
+			result := &common.Result{}
+			err := GradeMcq(test, &common.McqTestInfo{Answers: c.answers}, result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.MaxScore != 6 {
+				t.Errorf("max score %v, want 6", result.MaxScore)
+			}
+			if result.Score != c.score {
+				t.Errorf("score %v, want %v", result.Score, c.score)
+			}
+			if len(result.Questions) != len(questions) {
+				t.Fatalf("%d question results, want %d", len(result.Questions), len(questions))
+			}
+			for i, question := range result.Questions {
+				if question.Correct != c.correct[i] || question.Marks != c.marks[i] {
+					t.Errorf("question %d: correct %v with %v marks, want %v with %v", i+1, question.Correct, question.Marks, c.correct[i], c.marks[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGradeMcqBrokenAnswerKey(t *testing.T) {
+	test := mcqTest(t, 0, common.MCQ{Question: "?", Options: []string{"yes", "no"}, Answer: "maybe"})
+	err := GradeMcq(test, &common.McqTestInfo{Answers: []*int{answer(0)}}, &common.Result{})
+	if err == nil {
+		t.Fatal("want an error for an answer key that matches no option")
+	}
+}
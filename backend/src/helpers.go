@@ -6,57 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"reflect"
+	"runtime"
+	"sync"
 	// "strconv"
 	// "strings"
-	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// func UpdateUserTestTime(Collection *mongo.Collection, Username string, TimeToIncrease int64) error {
-// 	var user common.User
-
-// 	err := Collection.FindOne(context.TODO(), bson.M{"name": Username}).Decode(&user)
-
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	userTest := user.Tests
-// 	prevTimeElapsedUser := userTest.ElapsedTime
-// 	userTest.ElapsedTime = prevTimeElapsedUser - 60*TimeToIncrease
-
-// 	if userTest.ElapsedTime < 0 {
-// 		userTest.ElapsedTime = 0
-// 	}
-
-// 	if userTest.ElapsedTime > 1797 {
-// 		userTest.ElapsedTime = 1797
-// 	}
-
-// 	user.Tests = userTest
-
-// 	Collection.ReplaceOne(context.TODO(), bson.M{"name": Username}, user)
-
-// 	return nil
-// }
-
-// func UpdateBatchTestTime(Collection *mongo.Collection, Usernames []string, TimeToIncrease int64) error {
-// 	for _, username := range Usernames {
-// 		err := UpdateUserTestTime(Collection, username, TimeToIncrease)
-// 		if err != nil {
-// 			return err
-// 		}
-// 	}
-
-// 	return nil
-// }
-
 // func UpdateUserData(Collection *mongo.Collection, Model *common.UserUpdateRequest) error {
 
 // 	var user common.User
@@ -138,39 +95,6 @@ import (
 // 		user.Tests = userTest
 // 		Collection.ReplaceOne(context.TODO(), bson.M{"name": Model.Username}, user)
 
-// 	case "user_test_time":
-// 		username := Model.Value[0]
-// 		timeToIncrease, err := time.Parse(time.RFC3339, Model.Value[1])
-// 		if err != nil {
-// 			return err
-// 		}
-// 		err = UpdateUserTestTime(Collection, username, timeToIncrease.Unix()) // Convert timeToIncrease to int64
-// 		if err != nil {
-// 			return err
-// 		}
-// 	case "batch_test_time":
-// 		batchNumber := Model.Value[0]
-// 		timeToIncrease, err := time.Parse(time.RFC3339, Model.Value[1])
-// 		if err != nil {
-// 			return err
-// 		}
-// 		user, err := GetModelByBatchId(Collection, batchNumber, &common.User{})
-// 		if err != nil {
-// 			return err
-// 		}
-
-// 		var usernames []string
-// 		for _, user := range user {
-// 			usernames = append(usernames, user.(*common.User).Username)
-// 		}
-
-// 		err = UpdateBatchTestTime(Collection, usernames, timeToIncrease.Unix())
-
-// 		if err != nil {
-// 			return err
-// 		}
-
-// 		fmt.Printf("Batch id: %s, Time to increase: %d\n", batchNumber, timeToIncrease.Unix())
 // 	default:
 // 		return errors.New("invalid property")
 // 	}
@@ -286,33 +210,103 @@ import (
 // 	return result, nil
 // }
 
-func UserLogin(Collection *mongo.Collection, userRequest *common.TUserLoginRequest) (string, error) {
-	user, err := common.FindByUsername(Collection, userRequest.Username)
-
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return "", err
 	}
+	return string(hash), nil
+}
+
+func IsPasswordHash(password string) bool {
+	_, err := bcrypt.Cost([]byte(password))
+	return err == nil
+}
 
-	if user == nil {
-		return "", errors.New("user not found")
+// hashes the passwords of many users at once. bcrypt is slow on purpose, so this spreads
+// the work over all cpus for large csv imports
+func HashUserPasswords(users []common.User) error {
+	errs := make([]error, len(users))
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for i := range users {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(user *common.User, err *error) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			user.Password, *err = HashPassword(user.Password)
+		}(&users[i], &errs[i])
 	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
 
-	if user.Password != userRequest.Password {
-		return "", errors.New("invalid password")
+// hashes plaintext passwords left over from before passwords were hashed. users that
+// already have a hashed password are skipped, so this is safe to run on every start
+func MigrateUserPasswords(ctx context.Context, users UserRepository) error {
+	all, err := users.All(ctx)
+	if err != nil {
+		return err
 	}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": userRequest.Username,
-		"exp":      time.Now().Add(48 * time.Hour).Unix(),
-	})
+	plaintext := []common.User{}
+	for _, user := range all {
+		if !IsPasswordHash(user.Password) {
+			plaintext = append(plaintext, user)
+		}
+	}
+	if len(plaintext) == 0 {
+		return nil
+	}
 
-	tokenString, err := token.SignedString([]byte("token"))
+	err = HashUserPasswords(plaintext)
 	if err != nil {
-		return "", err
+		return err
+	}
+	for _, user := range plaintext {
+		err = users.SetPassword(ctx, user.Id, user.Password)
+		if err != nil {
+			return fmt.Errorf("error updating password of user %s: %v", user.Username, err)
+		}
+	}
+
+	log.Printf("Hashed plaintext passwords of %d users", len(plaintext))
+	return nil
+}
+
+func UserLogin(ctx context.Context, users UserRepository, sessions SessionRepository, userRequest *common.TUserLoginRequest) (*common.UserLoginResponse, error) {
+	user, err := users.FindByUsername(ctx, userRequest.Username)
+	if err == ErrNotFound {
+		return nil, errors.New("user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !IsPasswordHash(user.Password) {
+		// plaintext password from before passwords were hashed. MigrateUserPasswords
+		// takes care of these on startup, this only covers records added in between
+		if user.Password != userRequest.Password {
+			return nil, errors.New("invalid password")
+		}
+		hash, err := HashPassword(userRequest.Password)
+		if err == nil {
+			err = users.SetPassword(ctx, user.Id, hash)
+		}
+		if err != nil {
+			log.Printf("could not hash password of user %s: %v", user.Username, err)
+		}
+	} else if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(userRequest.Password)) != nil {
+		return nil, errors.New("invalid password")
+	}
+
+	access, refresh, err := StartSession(ctx, sessions, userKeys, user.Username)
+	if err != nil {
+		return nil, err
 	}
 
-	return tokenString, nil
+	return &common.UserLoginResponse{Jwt: access, RefreshToken: refresh, User: *user}, nil
 }
 
 // func SetUserResultToDownloaded(Collection *mongo.Collection, request *common.UserBatchRequestData) error {
@@ -375,41 +369,6 @@ func UserLogin(Collection *mongo.Collection, userRequest *common.TUserLoginReque
 // 	return nil
 // }
 
-func GetTestsByBatch(batchCollection *mongo.Collection, testCollection *mongo.Collection, batchName string) ([]common.Test, error) {
-	var batchDoc common.Batch
-	err := batchCollection.FindOne(context.TODO(), bson.M{"name": batchName}).Decode(&batchDoc)
-	if err != nil {
-		return nil, fmt.Errorf("error finding batch: %v", err)
-	}
-
-	var tests []common.Test
-	cursor, err := testCollection.Find(context.TODO(), bson.M{"_id": bson.M{"$in": batchDoc.Tests}})
-	log.Println(batchDoc, tests)
-	if err != nil {
-		return nil, fmt.Errorf("error finding tests: %v", err)
-	}
-	defer cursor.Close(context.TODO())
-
-	err = cursor.All(context.TODO(), &tests)
-	if err != nil {
-		return nil, fmt.Errorf("error decoding tests: %v", err)
-	}
-
-	return tests, nil
-}
-
-// func GetTestByID(testCollection *mongo.Collection, testID primitive.ObjectID) (*common.Test, error) {
-// 	var testDoc common.Test
-// 	err := testCollection.FindOne(context.TODO(), bson.M{"_id": testID}).Decode(&testDoc)
-// 	if err != nil {
-// 		if err == mongo.ErrNoDocuments {
-// 			return nil, fmt.Errorf("test not found")
-// 		}
-// 		return nil, fmt.Errorf("error finding test: %v", err)
-// 	}
-// 	return &testDoc, nil
-// }
-
 // func GetBatchByBatchNumber(Collection *mongo.Collection, batchNumber string) (ModelInterface, error) {
 // 	var batch ModelInterface
 
@@ -423,186 +382,43 @@ func GetTestsByBatch(batchCollection *mongo.Collection, testCollection *mongo.Co
 
 // }
 
-func Add_Model_To_DB(Collection *mongo.Collection, Model ModelInterface) error {
-	_, err := Collection.InsertOne(context.TODO(), Model)
-
-	if err != nil {
-		fmt.Println("Error in adding Model to database: ", err)
-		return err
-	}
-
-	return nil
-}
-
-func Get_All_Models(collection *mongo.Collection, modelType ModelInterface) ([]ModelInterface, error) {
-	fmt.Println("Fetching all models from database...")
-	cursor, err := collection.Find(context.TODO(), bson.M{})
-	if err != nil {
-		fmt.Println("Error in fetching all models: ", err)
-		return nil, err
-	}
-	defer cursor.Close(context.TODO())
-
-	var results []ModelInterface
-
-	// Create a new slice of the concrete type
-	sliceType := reflect.SliceOf(reflect.TypeOf(modelType).Elem())
-	concreteSlice := reflect.MakeSlice(sliceType, 0, 0)
-	concreteSlicePtr := reflect.New(concreteSlice.Type())
-	concreteSlicePtr.Elem().Set(concreteSlice)
-
-	// Decode into the concrete slice
-	if err := cursor.All(context.TODO(), concreteSlicePtr.Interface()); err != nil {
-		fmt.Println("Error in decoding models: ", err)
-		return nil, err
+func RegisterAdmin(ctx context.Context, admins AdminRepository, admin *common.Admin) error {
+	if admin.Username == "" || admin.Password == "" {
+		return errors.New("username and password are required")
 	}
-
-	// Convert concrete slice to []ModelInterface
-	concreteSliceVal := concreteSlicePtr.Elem()
-	for i := 0; i < concreteSliceVal.Len(); i++ {
-		item := concreteSliceVal.Index(i).Addr().Interface().(ModelInterface)
-		results = append(results, item)
+	if !validRole(admin.Role) {
+		return fmt.Errorf("invalid role '%s'", admin.Role)
 	}
-
-	return results, nil
-}
-
-func GetModelById(collection *mongo.Collection, ID string, modelType ModelInterface) (ModelInterface, error) {
-	fmt.Println("Fetching model from database...")
-	objectID, err := primitive.ObjectIDFromHex(ID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid ID format: %v", err)
+	_, err := admins.FindByUsername(ctx, admin.Username)
+	if err == nil {
+		return fmt.Errorf("admin '%s' already exists", admin.Username)
 	}
-
-	var result ModelInterface
-	err = collection.FindOne(context.TODO(), bson.M{"_id": objectID}).Decode(&result)
-	if err != nil {
-		fmt.Println("Error in fetching model: ", err)
-		return nil, err
-	}
-
-	fmt.Println("Model in DB:", result)
-	return result, nil
-}
-
-func GetModelByBatchId(collection *mongo.Collection, batchNumber string, modelType ModelInterface) ([]ModelInterface, error) {
-	fmt.Println("Fetching model from database...")
-
-	var results []ModelInterface
-	cursor, err := collection.Find(context.TODO(), bson.M{"batch": batchNumber})
-	if err != nil {
-		fmt.Println("Error in fetching model: ", err)
-		return nil, err
-	}
-
-	sliceType := reflect.SliceOf(reflect.TypeOf(modelType).Elem())
-	concreteSlice := reflect.MakeSlice(sliceType, 0, 0)
-	concreteSlicePtr := reflect.New(concreteSlice.Type())
-	concreteSlicePtr.Elem().Set(concreteSlice)
-
-	// Decode into the concrete slice
-	if err := cursor.All(context.TODO(), concreteSlicePtr.Interface()); err != nil {
-		fmt.Println("Error in decoding models: ", err)
-		return nil, err
-	}
-
-	// Convert concrete slice to []ModelInterface
-	concreteSliceVal := concreteSlicePtr.Elem()
-	for i := 0; i < concreteSliceVal.Len(); i++ {
-		item := concreteSliceVal.Index(i).Addr().Interface().(ModelInterface)
-		results = append(results, item)
-	}
-
-	return results, nil
-}
-
-func Delete_Model_By_ID(Collection *mongo.Collection, ID string) error {
-
-	objectID, err := primitive.ObjectIDFromHex(ID)
-	if err != nil {
-		return fmt.Errorf("invalid ID format: %v", err)
-	}
-
-	result, err := Collection.DeleteOne(context.TODO(), bson.M{"_id": objectID})
-	if err != nil {
-		log.Printf("Error in deleting Model from database: %v", err)
+	if err != ErrNotFound {
 		return err
 	}
 
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("no document found with ID: %s", ID)
-	}
-
-	log.Printf("Model with ID %s deleted successfully", ID)
-	return nil
-}
-
-func Delete_ALL_Model(Collection *mongo.Collection) error {
-
-	_, err := Collection.DeleteMany(context.TODO(), bson.M{})
-	if err != nil {
-		fmt.Println("Error in deleting Model from database: ", err)
-		return err
-	}
-
-	log.Default().Println("Model deleted successfully")
-
-	return nil
-}
-
-func Update_Model_By_ID(Collection *mongo.Collection, ID string, Model ModelInterface) error {
-
-	objectID, err := primitive.ObjectIDFromHex(ID)
-	if err != nil {
-		return fmt.Errorf("invalid ID format: %v", err)
-	}
-
-	fmt.Println("Updating Model with ID: ", ID)
-
-	result, err := Collection.ReplaceOne(context.TODO(), bson.M{"_id": objectID}, Model)
-	if err != nil {
-		log.Printf("Error in updating Model from database: %v", err)
-		return err
-	}
-
-	fmt.Println("Model updated successfully")
-
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("no document found with ID: %s", ID)
-	}
-
-	log.Printf("Model with ID %s updated successfully", ID)
-	return nil
-}
-
-func RegisterAdmin(Collection *mongo.Collection, Admin ModelInterface) error {
-
-	password := Admin.(*common.Admin).Password
-
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := HashPassword(admin.Password)
 	if err != nil {
 		fmt.Println("Error hashing password:", err)
 		return err
 	}
 
-	Admin.(*common.Admin).Password = string(hashedPassword)
+	admin.Password = hashedPassword
 
-	Add_Model_To_DB(Collection, Admin)
-	return nil
+	return admins.Add(ctx, admin)
 }
 
-func AdminLogin(Collection *mongo.Collection, Admin ModelInterface) (string, error) {
-	username := Admin.(*common.Admin).Username
-	password := Admin.(*common.Admin).Password
-	secretKey := []byte("TODO:add-a-secret-key-from-env")
+// returns an access and a refresh token
+func AdminLogin(ctx context.Context, admins AdminRepository, sessions SessionRepository, admin *common.Admin) (string, string, error) {
+	username := admin.Username
+	password := admin.Password
 
-	var user common.Admin
-	err := Collection.FindOne(context.TODO(), bson.M{"username": username}).Decode(&user)
+	user, err := admins.FindByUsername(ctx, username)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return "", fmt.Errorf("admin not found")
+		if err == ErrNotFound {
+			return "", "", fmt.Errorf("admin not found")
 		}
-		return "", fmt.Errorf("error finding admin: %v", err)
+		return "", "", fmt.Errorf("error finding admin: %v", err)
 	}
 
 	log.Default().Printf("Provided username: %s and password: %s\nDatabase usernam: %s and password: %s", username, password, user.Username, user.Password)
@@ -610,58 +426,22 @@ func AdminLogin(Collection *mongo.Collection, Admin ModelInterface) (string, err
 	// Compare the hashed password with the plaintext password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		return "", fmt.Errorf("invalid credentials")
-	}
-
-	expirationTime := time.Now().Add(48 * time.Hour)
-
-	claims := &Claims{
-		Username: username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+		return "", "", fmt.Errorf("invalid credentials")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	tokenString, err := token.SignedString(secretKey)
+	access, refresh, err := StartSession(ctx, sessions, adminKeys, user.Username)
 	if err != nil {
-		return "", fmt.Errorf("error signing the token: %v", err)
+		return "", "", fmt.Errorf("error signing the token: %v", err)
 	}
 
-	return tokenString, nil
+	return access, refresh, nil
 }
 
 func ValidateAdminToken(tokenString string) (*Claims, error) {
-	secretKey := []byte("TODO:add-a-secret-key-from-env") // Use the same secret key as in AdminLogin
-
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return secretKey, nil
-	})
-
+	claims, err := adminKeys.Verify(tokenString)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing token: %v", err)
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
-	}
-
-	return nil, fmt.Errorf("invalid token")
-}
-
-func UpdateTypingTestText(collection *mongo.Collection, testID string, typingText string) error {
-	_, err := collection.UpdateOne(
-		context.TODO(),
-		bson.M{"_id": testID, "type": "typing"},
-		bson.M{"$set": bson.M{"typingText": typingText}},
-	)
-	if err != nil {
-		return fmt.Errorf("error updating typing test text: %v", err)
-	}
-
-	return nil
+	return claims, nil
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// candidate and admin tokens are signed with different keys and carry different
+// audiences, so a candidate token can never pass admin checks (and the other way around)
+const userAudience = "gravishken-user"
+const adminAudience = "gravishken-admin"
+
+// only used outside of PROD when no keys are configured
+const devUserSecret = "dev-user-secret"
+const devAdminSecret = "dev-admin-secret"
+
+// secrets that were hardcoded at some point. never accepted in PROD
+var knownSecrets = []string{devUserSecret, devAdminSecret, "token", "TODO:add-a-secret-key-from-env"}
+
+type signingKey struct {
+	id     string
+	secret []byte
+	// zero for the current key. retired keys are still accepted until they expire
+	expires time.Time
+}
+
+type KeySet struct {
+	audience string
+	// the first key signs new tokens
+	keys []signingKey
+}
+
+var userKeys *KeySet
+var adminKeys *KeySet
+
+// USER_JWT_KEYS and ADMIN_JWT_KEYS hold comma separated keys of the form
+// kid=secret[@expiry]. the first key is used to sign new tokens. keys with an
+// RFC3339 expiry are retired keys that are only accepted for verification until
+// then. e.g. to rotate keys:
+//
+//	USER_JWT_KEYS=k2=new-secret,k1=old-secret@2024-10-01T00:00:00Z
+func LoadJWTKeys() error {
+	var err error
+	userKeys, err = loadKeySet("USER_JWT_KEYS", userAudience, devUserSecret)
+	if err != nil {
+		return err
+	}
+	adminKeys, err = loadKeySet("ADMIN_JWT_KEYS", adminAudience, devAdminSecret)
+	if err != nil {
+		return err
+	}
+
+	for _, userKey := range userKeys.keys {
+		for _, adminKey := range adminKeys.keys {
+			if string(userKey.secret) == string(adminKey.secret) {
+				return fmt.Errorf("USER_JWT_KEYS and ADMIN_JWT_KEYS must not share secrets")
+			}
+		}
+	}
+	return nil
+}
+
+func loadKeySet(env string, audience string, devSecret string) (*KeySet, error) {
+	spec, ok := os.LookupEnv(env)
+	if !ok || strings.TrimSpace(spec) == "" {
+		if build_mode == "PROD" {
+			return nil, fmt.Errorf("%s must be set in PROD", env)
+		}
+		log.Printf("WARNING: %s not set. using an insecure development key", env)
+		spec = "dev=" + devSecret
+	}
+
+	keys, err := parseKeySet(audience, spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", env, err)
+	}
+
+	if build_mode == "PROD" {
+		for _, key := range keys.keys {
+			for _, known := range knownSecrets {
+				if string(key.secret) == known {
+					return nil, fmt.Errorf("%s: key '%s' uses a default secret", env, key.id)
+				}
+			}
+		}
+	}
+	return keys, nil
+}
+
+func parseKeySet(audience string, spec string) (*KeySet, error) {
+	keys := &KeySet{audience: audience}
+	ids := map[string]bool{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, secret, ok := strings.Cut(entry, "=")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("key '%s' is not of the form kid=secret[@expiry]", entry)
+		}
+		if ids[id] {
+			return nil, fmt.Errorf("duplicate key id '%s'", id)
+		}
+		ids[id] = true
+
+		key := signingKey{id: id, secret: []byte(secret)}
+		// secrets may contain '@'. only a trailing valid timestamp is an expiry
+		if i := strings.LastIndex(secret, "@"); i > 0 {
+			if expires, err := time.Parse(time.RFC3339, secret[i+1:]); err == nil {
+				key.secret = []byte(secret[:i])
+				key.expires = expires
+			}
+		}
+		keys.keys = append(keys.keys, key)
+	}
+
+	if len(keys.keys) == 0 {
+		return nil, fmt.Errorf("no keys")
+	}
+	if !keys.keys[0].expires.IsZero() {
+		return nil, fmt.Errorf("the first key signs new tokens and can not have an expiry")
+	}
+	return keys, nil
+}
+
+func (self *KeySet) Sign(claims *Claims, ttl time.Duration) (string, error) {
+	key := self.keys[0]
+	now := time.Now()
+	claims.Audience = jwt.ClaimStrings{self.audience}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.secret)
+}
+
+func (self *KeySet) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+		for _, key := range self.keys {
+			if key.id != id {
+				continue
+			}
+			if !key.expires.IsZero() && time.Now().After(key.expires) {
+				return nil, fmt.Errorf("signing key '%s' has been retired", id)
+			}
+			return key.secret, nil
+		}
+		return nil, fmt.Errorf("unknown signing key '%s'", id)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(self.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
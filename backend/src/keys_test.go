@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustKeySet(t *testing.T, audience string, spec string) *KeySet {
+	t.Helper()
+	keys, err := parseKeySet(audience, spec)
+	if err != nil {
+		t.Fatalf("parseKeySet(%q): %v", spec, err)
+	}
+	return keys
+}
+
+func mustSign(t *testing.T, keys *KeySet, username string, ttl time.Duration) string {
+	t.Helper()
+	token, err := keys.Sign(&Claims{Username: username}, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestParseKeySet(t *testing.T) {
+	cases := []struct {
+		spec string
+		// ids of the keys, "" if the spec is invalid
+		ids string
+	}{
+		{"k1=secret", "k1"},
+		{" k2=new , k1=old@2030-01-01T00:00:00Z ,", "k2,k1"},
+		{"k1=p@ssword", "k1"},
+		{"", ""},
+		{"k1", ""},
+		{"=secret", ""},
+		{"k1=", ""},
+		{"k1=a,k1=b", ""},
+		{"k1=old@2030-01-01T00:00:00Z,k2=new", ""},
+	}
+	for _, c := range cases {
+		keys, err := parseKeySet(userAudience, c.spec)
+		if c.ids == "" {
+			if err == nil {
+				t.Errorf("%q: want an error", c.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.spec, err)
+			continue
+		}
+		ids := []string{}
+		for _, key := range keys.keys {
+			ids = append(ids, key.id)
+		}
+		if got := strings.Join(ids, ","); got != c.ids {
+			t.Errorf("%q: keys %s, want %s", c.spec, got, c.ids)
+		}
+	}
+}
+
+func TestParseKeySetExpiry(t *testing.T) {
+	keys := mustKeySet(t, userAudience, "k2=new,k1=old@2030-01-01T00:00:00Z,k0=mail@example.com")
+	if string(keys.keys[1].secret) != "old" || !keys.keys[1].expires.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("k1: secret '%s' expiring %v", keys.keys[1].secret, keys.keys[1].expires)
+	}
+	// an '@' that is not followed by a timestamp is part of the secret
+	if string(keys.keys[2].secret) != "mail@example.com" || !keys.keys[2].expires.IsZero() {
+		t.Errorf("k0: secret '%s' expiring %v", keys.keys[2].secret, keys.keys[2].expires)
+	}
+}
+
+func TestKeySetVerify(t *testing.T) {
+	keys := mustKeySet(t, userAudience, "k1=secret")
+	claims, err := keys.Verify(mustSign(t, keys, "alice", time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Username != "alice" {
+		t.Errorf("username '%s', want alice", claims.Username)
+	}
+
+	if _, err := keys.Verify(mustSign(t, keys, "alice", -time.Minute)); err == nil {
+		t.Error("expired token was accepted")
+	}
+
+	token := mustSign(t, keys, "alice", time.Minute)
+	if _, err := keys.Verify(token[:len(token)-2] + "xx"); err == nil {
+		t.Error("token with a broken signature was accepted")
+	}
+
+	// same key id, other secret
+	other := mustKeySet(t, userAudience, "k1=other-secret")
+	if _, err := keys.Verify(mustSign(t, other, "alice", time.Minute)); err == nil {
+		t.Error("token signed with another secret was accepted")
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	old := mustKeySet(t, userAudience, "k1=old-secret")
+	token := mustSign(t, old, "alice", time.Hour)
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	cases := []struct {
+		name  string
+		spec  string
+		valid bool
+	}{
+		{"old key before its expiry", "k2=new-secret,k1=old-secret@" + future, true},
+		{"old key after its expiry", "k2=new-secret,k1=old-secret@" + past, false},
+		{"old key removed", "k2=new-secret", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rotated := mustKeySet(t, userAudience, c.spec)
+			_, err := rotated.Verify(token)
+			if (err == nil) != c.valid {
+				t.Fatalf("got %v, want valid %v", err, c.valid)
+			}
+
+			// new tokens are signed with the new key
+			if _, err := rotated.Verify(mustSign(t, rotated, "alice", time.Minute)); err != nil {
+				t.Fatalf("token of the new key: %v", err)
+			}
+			if _, err := old.Verify(mustSign(t, rotated, "alice", time.Minute)); err == nil {
+				t.Fatal("token of the new key was accepted by the old key set")
+			}
+		})
+	}
+}
+
+func TestKeySetAudience(t *testing.T) {
+	user := mustKeySet(t, userAudience, "u1=user-secret")
+	admin := mustKeySet(t, adminAudience, "a1=admin-secret")
+	if _, err := admin.Verify(mustSign(t, user, "alice", time.Minute)); err == nil {
+		t.Error("user token was accepted as an admin token")
+	}
+	if _, err := user.Verify(mustSign(t, admin, "root", time.Minute)); err == nil {
+		t.Error("admin token was accepted as a user token")
+	}
+
+	// the audience alone keeps them apart, even with a shared key
+	sharedUser := mustKeySet(t, userAudience, "k1=shared-secret")
+	sharedAdmin := mustKeySet(t, adminAudience, "k1=shared-secret")
+	if _, err := sharedAdmin.Verify(mustSign(t, sharedUser, "alice", time.Minute)); err == nil {
+		t.Error("user token was accepted for the admin audience")
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	// "common"
-	// "context"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/fs"
@@ -56,6 +56,11 @@ func main() {
 		types.DumpTypes(ts_dir)
 	}
 
+	err := LoadJWTKeys()
+	if err != nil {
+		log.Fatalln("Error loading JWT keys: ", err)
+	}
+
 	port, ok := os.LookupEnv("SERVER_PORT")
 	if !ok {
 		log.Fatalln("SERVER_PORT not set")
@@ -91,11 +96,23 @@ func SetupRouter() *gin.Engine {
 	// })
 
 	if err != nil {
-		log.Fatal("Error connecting to MongoDB: ", err)
+		log.Fatal("Error connecting to database: ", err)
 
 		return nil
 	}
 
+	err = MigrateUserPasswords(context.Background(), db.Users)
+	if err != nil {
+		log.Fatal("Error hashing user passwords: ", err)
+	}
+
+	db.Storage, err = NewStorageFromEnv()
+	if err != nil {
+		log.Fatal("Error setting up file storage: ", err)
+	}
+
+	go db.WatchSessions(context.Background())
+
 	router := gin.Default()
 
 	if build_mode == "DEV" {
@@ -135,12 +152,13 @@ func SetupRouter() *gin.Engine {
 	})
 
 	router.Use(helmet.Default())
-	router.Use(gzip.Gzip(gzip.BestCompression))
+	// the presence stream is flushed event by event, which the gzip writer can't do
+	router.Use(gzip.Gzip(gzip.BestCompression, gzip.WithExcludedPaths([]string{"/admin/presence/stream"})))
 
 	InitAuthRoutes(db, router)
 	// route.InitOtherRoutes(db, router)
 
-	AppRoutes(router)
+	AppRoutes(db, router)
 	WebsiteRoutes(router)
 
 	return router
@@ -266,3 +284,17 @@ func getEnvOrDefault(key, fallback string) string {
 	}
 	return value
 }
+
+// a go duration like 90s or 15m
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("invalid %s '%s'. using %s", key, value, fallback)
+		return fallback
+	}
+	return duration
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// largest part that is read, uncompressed. documents are small when packed, so a zip bomb
+// must not get to fill the server's memory during grading
+const ooxmlPartLimit = 32 << 20
+
+// office open xml files (docx, xlsx, pptx) are zip archives of xml parts.
+//
+// NOTE: xml structs in the graders leave out namespaces in their tags, so that
+// elements and attributes match by local name only (w:p, a:t, r:id, ...)
+type ooxmlPackage struct {
+	files map[string]*zip.File
+}
+
+func openOoxml(data []byte) (*ooxmlPackage, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a valid office document: %v", err)
+	}
+
+	pkg := &ooxmlPackage{files: make(map[string]*zip.File)}
+	for _, file := range reader.File {
+		pkg.files[file.Name] = file
+	}
+	return pkg, nil
+}
+
+func (self *ooxmlPackage) has(name string) bool {
+	_, ok := self.files[name]
+	return ok
+}
+
+func (self *ooxmlPackage) read(name string) ([]byte, error) {
+	file, ok := self.files[name]
+	if !ok {
+		return nil, fmt.Errorf("part '%s' not found in document", name)
+	}
+
+	if file.UncompressedSize64 > ooxmlPartLimit {
+		return nil, fmt.Errorf("part '%s' is too large", name)
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// the size in the header may lie
+	data, err := io.ReadAll(io.LimitReader(reader, ooxmlPartLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > ooxmlPartLimit {
+		return nil, fmt.Errorf("part '%s' is too large", name)
+	}
+	return data, nil
+}
+
+func (self *ooxmlPackage) decode(name string, val interface{}) error {
+	data, err := self.read(name)
+	if err != nil {
+		return err
+	}
+	err = xml.Unmarshal(data, val)
+	if err != nil {
+		return fmt.Errorf("error parsing '%s': %v", name, err)
+	}
+	return nil
+}
+
+// sorted names of parts in a directory with a name prefix. e.g. ("word", "header")
+func (self *ooxmlPackage) parts(dir string, prefix string) []string {
+	names := []string{}
+	for name := range self.files {
+		if path.Dir(name) == dir && strings.HasPrefix(path.Base(name), prefix) && strings.HasSuffix(name, ".xml") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// concatenated character data of all elements with the given local name
+func (self *ooxmlPackage) text(name string, element string) (string, error) {
+	data, err := self.read(name)
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error parsing '%s': %v", name, err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name.Local == element {
+				depth += 1
+			}
+		case xml.EndElement:
+			if token.Name.Local == element {
+				depth -= 1
+			}
+		case xml.CharData:
+			if depth > 0 {
+				text.Write(token)
+			}
+		}
+	}
+
+	return text.String(), nil
+}
+
+// number of elements with the given local name
+func (self *ooxmlPackage) count(name string, element string) (int, error) {
+	data, err := self.read(name)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error parsing '%s': %v", name, err)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == element {
+			count += 1
+		}
+	}
+
+	return count, nil
+}
+
+type ooxmlRel struct {
+	Type string
+	// part name the relationship points to
+	Target string
+}
+
+// relationships of a part. relationship id -> relationship
+func (self *ooxmlPackage) rels(part string) (map[string]ooxmlRel, error) {
+	name := path.Join(path.Dir(part), "_rels", path.Base(part)+".rels")
+	rels := make(map[string]ooxmlRel)
+	if !self.has(name) {
+		return rels, nil
+	}
+
+	var relationships struct {
+		Rels []struct {
+			Id         string `xml:"Id,attr"`
+			Type       string `xml:"Type,attr"`
+			Target     string `xml:"Target,attr"`
+			TargetMode string `xml:"TargetMode,attr"`
+		} `xml:"Relationship"`
+	}
+	err := self.decode(name, &relationships)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rel := range relationships.Rels {
+		target := rel.Target
+		if rel.TargetMode != "External" {
+			if strings.HasPrefix(target, "/") {
+				target = strings.TrimPrefix(target, "/")
+			} else {
+				target = path.Join(path.Dir(part), target)
+			}
+		}
+		rels[rel.Id] = ooxmlRel{Type: rel.Type, Target: target}
+	}
+	return rels, nil
+}
+
+// boolean properties like <w:b/>, <w:b w:val="0"/>
+type ooxmlOnOff struct {
+	Val string `xml:"val,attr"`
+}
+
+func (self *ooxmlOnOff) on() bool {
+	if self == nil {
+		return false
+	}
+	switch strings.ToLower(self.Val) {
+	case "0", "false", "off":
+		return false
+	default:
+		return true
+	}
+}
+
+type ooxmlVal struct {
+	Val string `xml:"val,attr"`
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"common"
+	"strings"
+	"testing"
+)
+
+// an office document with the given parts, built in memory
+func ooxmlFile(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range parts {
+		part, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type rubricCase struct {
+	name   string
+	rule   common.RubricRule
+	passed bool
+	// expected failure details, when they matter
+	detail string
+}
+
+// grades data against a rubric of all the rules and checks every rule on its own
+func checkRubric(t *testing.T, grade func(*common.Test, []byte, *common.Result) error, data []byte, cases []rubricCase) {
+	t.Helper()
+	test := &common.Test{}
+	for _, c := range cases {
+		test.Rubric = append(test.Rubric, c.rule)
+	}
+	result := &common.Result{}
+	if err := grade(test, data, result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rules) != len(cases) {
+		t.Fatalf("%d rule results, want %d", len(result.Rules), len(cases))
+	}
+
+	score := 0.0
+	for i, c := range cases {
+		got := result.Rules[i]
+		if got.Passed != c.passed {
+			t.Errorf("%s: passed %v (%s), want %v", c.name, got.Passed, got.Detail, c.passed)
+		}
+		if c.detail != "" && got.Detail != c.detail {
+			t.Errorf("%s: detail '%s', want '%s'", c.name, got.Detail, c.detail)
+		}
+		if c.passed {
+			score += 1
+		}
+	}
+	if result.Score != score || result.MaxScore != float64(len(cases)) {
+		t.Errorf("score %v of %v, want %v of %d", result.Score, result.MaxScore, score, len(cases))
+	}
+}
+
+func TestOoxmlPartLimit(t *testing.T) {
+	data := ooxmlFile(t, map[string]string{
+		"small.xml": "<a/>",
+		"large.xml": strings.Repeat(" ", ooxmlPartLimit+1),
+	})
+	pkg, err := openOoxml(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pkg.read("small.xml"); err != nil {
+		t.Errorf("small part: %v", err)
+	}
+	_, err = pkg.read("large.xml")
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("large part: got %v, want a too large error", err)
+	}
+}
+
+func TestOpenOoxmlNotAZip(t *testing.T) {
+	if _, err := openOoxml([]byte("not a document")); err == nil {
+		t.Fatal("want an error")
+	}
+}
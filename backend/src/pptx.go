@@ -0,0 +1,362 @@
+package main
+
+import (
+	"common"
+	"fmt"
+	"strings"
+)
+
+type pptxShape struct {
+	Placeholder *struct {
+		Type string `xml:"type,attr"`
+	} `xml:"nvSpPr>nvPr>ph"`
+	Paragraphs []struct {
+		Runs []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+		Fields []struct {
+			T string `xml:"t"`
+		} `xml:"fld"`
+	} `xml:"txBody>p"`
+}
+
+func (self *pptxShape) placeholderType() string {
+	if self.Placeholder == nil {
+		return ""
+	}
+	// placeholders without a type are body placeholders
+	if self.Placeholder.Type == "" {
+		return "body"
+	}
+	return self.Placeholder.Type
+}
+
+func (self *pptxShape) text() string {
+	lines := []string{}
+	for _, paragraph := range self.Paragraphs {
+		var line strings.Builder
+		for _, run := range paragraph.Runs {
+			line.WriteString(run.T)
+		}
+		for _, field := range paragraph.Fields {
+			line.WriteString(field.T)
+		}
+		lines = append(lines, line.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type pptxSlide struct {
+	Shapes []pptxShape `xml:"cSld>spTree>sp"`
+}
+
+type pptxFile struct {
+	pkg *ooxmlPackage
+	// slide part names in presentation order
+	slides  []string
+	masters []string
+}
+
+func openPptx(data []byte) (*pptxFile, error) {
+	pkg, err := openOoxml(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var presentation struct {
+		Masters []struct {
+			Id string `xml:"id,attr"`
+		} `xml:"sldMasterIdLst>sldMasterId"`
+		Slides []struct {
+			Id string `xml:"id,attr"`
+		} `xml:"sldIdLst>sldId"`
+	}
+	err = pkg.decode("ppt/presentation.xml", &presentation)
+	if err != nil {
+		return nil, err
+	}
+
+	rels, err := pkg.rels("ppt/presentation.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	self := &pptxFile{pkg: pkg}
+	for _, slide := range presentation.Slides {
+		if rel, ok := rels[slide.Id]; ok {
+			self.slides = append(self.slides, rel.Target)
+		}
+	}
+	for _, master := range presentation.Masters {
+		if rel, ok := rels[master.Id]; ok {
+			self.masters = append(self.masters, rel.Target)
+		}
+	}
+
+	return self, nil
+}
+
+// slide parts a rule applies to. Index 0 means every slide
+func (self *pptxFile) ruleSlides(rule *common.RubricRule) ([]string, error) {
+	if rule.Index == 0 {
+		if len(self.slides) == 0 {
+			return nil, fmt.Errorf("presentation has no slides")
+		}
+		return self.slides, nil
+	}
+	if rule.Index < 0 || rule.Index > len(self.slides) {
+		return nil, fmt.Errorf("presentation has %d slides", len(self.slides))
+	}
+	return self.slides[rule.Index-1 : rule.Index], nil
+}
+
+func (self *pptxFile) relOfType(part string, typ string) (string, bool, error) {
+	rels, err := self.pkg.rels(part)
+	if err != nil {
+		return "", false, err
+	}
+	for _, rel := range rels {
+		if strings.HasSuffix(rel.Type, "/"+typ) {
+			return rel.Target, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (self *pptxFile) slideTitle(part string) (string, error) {
+	var slide pptxSlide
+	err := self.pkg.decode(part, &slide)
+	if err != nil {
+		return "", err
+	}
+	for _, shape := range slide.Shapes {
+		typ := shape.placeholderType()
+		if typ == "title" || typ == "ctrTitle" {
+			return strings.TrimSpace(shape.text()), nil
+		}
+	}
+	return "", nil
+}
+
+func (self *pptxFile) layoutName(slidePart string) (string, error) {
+	layout, ok, err := self.relOfType(slidePart, "slideLayout")
+	if err != nil || !ok {
+		return "", err
+	}
+	var sldLayout struct {
+		CSld struct {
+			Name string `xml:"name,attr"`
+		} `xml:"cSld"`
+	}
+	err = self.pkg.decode(layout, &sldLayout)
+	return sldLayout.CSld.Name, err
+}
+
+func (self *pptxFile) speakerNotes(slidePart string) (string, error) {
+	notes, ok, err := self.relOfType(slidePart, "notesSlide")
+	if err != nil || !ok {
+		return "", err
+	}
+	var notesSlide pptxSlide
+	err = self.pkg.decode(notes, &notesSlide)
+	if err != nil {
+		return "", err
+	}
+	text := ""
+	for _, shape := range notesSlide.Shapes {
+		if shape.placeholderType() == "body" {
+			text += shape.text()
+		}
+	}
+	return strings.TrimSpace(text), nil
+}
+
+func (self *pptxFile) themeNames() ([]string, error) {
+	names := []string{}
+	for _, master := range self.masters {
+		theme, ok, err := self.relOfType(master, "theme")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		var themeDoc struct {
+			Name string `xml:"name,attr"`
+		}
+		err = self.pkg.decode(theme, &themeDoc)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, themeDoc.Name)
+	}
+	return names, nil
+}
+
+// passes if any slide the rule applies to passes the check
+func (self *pptxFile) anySlide(rule *common.RubricRule, check func(part string) (bool, error)) (bool, error) {
+	slides, err := self.ruleSlides(rule)
+	if err != nil {
+		return false, err
+	}
+	for _, slide := range slides {
+		ok, err := check(slide)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// failure details of a rule about one slide, or about any slide when Index is 0. e.g.
+// "no slide has speaker notes" and "slide 2 does not have speaker notes"
+func slideFailure(rule *common.RubricRule, verb string, baseVerb string, object string) string {
+	if rule.Index == 0 {
+		return fmt.Sprintf("no slide %s %s", verb, object)
+	}
+	return fmt.Sprintf("slide %d does not %s %s", rule.Index, baseVerb, object)
+}
+
+// the parameters a pptx rule needs, checked when the rubric is saved
+func validatePptxRule(rule *common.RubricRule) error {
+	if rule.Index < 0 {
+		return fmt.Errorf("Index must be a slide number, or 0 for any slide")
+	}
+
+	switch rule.Kind {
+	case common.PptxSlideCount:
+		if rule.Count < 1 {
+			return fmt.Errorf("needs a number of slides in Count")
+		}
+	case common.PptxSlideTitle, common.PptxLayoutUsed:
+		if strings.TrimSpace(rule.Text) == "" {
+			return fmt.Errorf("needs Text")
+		}
+	case common.PptxImageInserted:
+		if rule.Count < 0 {
+			return fmt.Errorf("Count can not be negative")
+		}
+	}
+	return nil
+}
+
+func (self *pptxFile) check(rule *common.RubricRule) (bool, string, error) {
+	switch rule.Kind {
+	case common.PptxSlideCount:
+		if len(self.slides) == rule.Count {
+			return true, "", nil
+		}
+		return false, fmt.Sprintf("presentation has %d slides", len(self.slides)), nil
+
+	case common.PptxSlideTitle:
+		passed, err := self.anySlide(rule, func(part string) (bool, error) {
+			title, err := self.slideTitle(part)
+			return strings.EqualFold(title, strings.TrimSpace(rule.Text)), err
+		})
+		if err != nil || passed {
+			return passed, "", err
+		}
+		return false, slideFailure(rule, "has", "have", fmt.Sprintf("the title '%s'", rule.Text)), nil
+
+	case common.PptxLayoutUsed:
+		passed, err := self.anySlide(rule, func(part string) (bool, error) {
+			name, err := self.layoutName(part)
+			return strings.EqualFold(name, strings.TrimSpace(rule.Text)), err
+		})
+		if err != nil || passed {
+			return passed, "", err
+		}
+		return false, slideFailure(rule, "uses", "use", fmt.Sprintf("the layout '%s'", rule.Text)), nil
+
+	case common.PptxImageInserted:
+		want := rule.Count
+		if want == 0 {
+			want = 1
+		}
+		found := 0
+		slides, err := self.ruleSlides(rule)
+		if err != nil {
+			return false, "", err
+		}
+		for _, slide := range slides {
+			count, err := self.pkg.count(slide, "pic")
+			if err != nil {
+				return false, "", err
+			}
+			found += count
+		}
+		if found >= want {
+			return true, "", nil
+		}
+		return false, fmt.Sprintf("found %d images", found), nil
+
+	case common.PptxTransition, common.PptxAnimation:
+		element, name := "transition", "a transition"
+		if rule.Kind == common.PptxAnimation {
+			// animations are stored as time nodes in the slide's timing tree
+			element, name = "anim", "an animation"
+		}
+		passed, err := self.anySlide(rule, func(part string) (bool, error) {
+			count, err := self.pkg.count(part, element)
+			if err != nil {
+				return false, err
+			}
+			if element == "anim" && count == 0 {
+				// entrance / exit effects use animEffect or set instead of anim
+				for _, other := range []string{"animEffect", "animMotion", "animScale", "animRot", "set"} {
+					more, err := self.pkg.count(part, other)
+					if err != nil {
+						return false, err
+					}
+					count += more
+				}
+			}
+			return count > 0, nil
+		})
+		if err != nil || passed {
+			return passed, "", err
+		}
+		return false, slideFailure(rule, "has", "have", name), nil
+
+	case common.PptxSpeakerNotes:
+		passed, err := self.anySlide(rule, func(part string) (bool, error) {
+			notes, err := self.speakerNotes(part)
+			return notes != "", err
+		})
+		if err != nil || passed {
+			return passed, "", err
+		}
+		return false, slideFailure(rule, "has", "have", "speaker notes"), nil
+
+	case common.PptxThemeApplied:
+		names, err := self.themeNames()
+		if err != nil {
+			return false, "", err
+		}
+		for _, name := range names {
+			if rule.Text == "" && name != "" && !strings.EqualFold(name, "Office Theme") {
+				return true, "", nil
+			}
+			if rule.Text != "" && strings.EqualFold(name, strings.TrimSpace(rule.Text)) {
+				return true, "", nil
+			}
+		}
+		return false, fmt.Sprintf("themes used: %s", strings.Join(names, ", ")), nil
+
+	default:
+		return false, "", fmt.Errorf("rule '%s' can not be used for pptx tests", rule.Kind)
+	}
+}
+
+func GradePptx(test *common.Test, data []byte, result *common.Result) error {
+	pptx, err := openPptx(data)
+	if err != nil {
+		return err
+	}
+
+	GradeRubric(test.Rubric, pptx.check, result)
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"common"
+	"testing"
+)
+
+const pptxNamespaces = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"`
+
+const pptxRelType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/"
+
+// slide 1: title "Welcome", a picture, a transition and speaker notes, "Title Slide" layout
+// slide 2: title "Agenda" in a centered title, an animation, "Title and Content" layout
+var pptxFixture = map[string]string{
+	"ppt/presentation.xml": `<p:presentation ` + pptxNamespaces + `>
+		<p:sldMasterIdLst><p:sldMasterId id="2147483648" r:id="rId1"/></p:sldMasterIdLst>
+		<p:sldIdLst><p:sldId id="256" r:id="rId2"/><p:sldId id="257" r:id="rId3"/></p:sldIdLst>
+	</p:presentation>`,
+	"ppt/_rels/presentation.xml.rels": ooxmlRelsHeader + `
+		<Relationship Id="rId1" Type="` + pptxRelType + `slideMaster" Target="slideMasters/slideMaster1.xml"/>
+		<Relationship Id="rId2" Type="` + pptxRelType + `slide" Target="slides/slide1.xml"/>
+		<Relationship Id="rId3" Type="` + pptxRelType + `slide" Target="slides/slide2.xml"/>
+	</Relationships>`,
+
+	"ppt/slides/slide1.xml": `<p:sld ` + pptxNamespaces + `>
+		<p:cSld><p:spTree>
+			<p:sp><p:nvSpPr><p:nvPr><p:ph type="title"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>Wel</a:t></a:r><a:r><a:t>come</a:t></a:r></a:p></p:txBody></p:sp>
+			<p:pic><p:blipFill><a:blip r:embed="rId3"/></p:blipFill></p:pic>
+		</p:spTree></p:cSld>
+		<p:transition spd="slow"><p:fade/></p:transition>
+	</p:sld>`,
+	"ppt/slides/_rels/slide1.xml.rels": ooxmlRelsHeader + `
+		<Relationship Id="rId1" Type="` + pptxRelType + `slideLayout" Target="../slideLayouts/slideLayout1.xml"/>
+		<Relationship Id="rId2" Type="` + pptxRelType + `notesSlide" Target="../notesSlides/notesSlide1.xml"/>
+		<Relationship Id="rId3" Type="` + pptxRelType + `image" Target="../media/image1.png"/>
+	</Relationships>`,
+	"ppt/notesSlides/notesSlide1.xml": `<p:notes ` + pptxNamespaces + `>
+		<p:cSld><p:spTree>
+			<p:sp><p:nvSpPr><p:nvPr><p:ph type="sldImg"/></p:nvPr></p:nvSpPr></p:sp>
+			<p:sp><p:nvSpPr><p:nvPr><p:ph idx="1"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>Say hello</a:t></a:r></a:p></p:txBody></p:sp>
+		</p:spTree></p:cSld>
+	</p:notes>`,
+
+	"ppt/slides/slide2.xml": `<p:sld ` + pptxNamespaces + `>
+		<p:cSld><p:spTree>
+			<p:sp><p:nvSpPr><p:nvPr><p:ph type="ctrTitle"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t> Agenda </a:t></a:r></a:p></p:txBody></p:sp>
+			<p:sp><p:nvSpPr><p:nvPr><p:ph idx="1"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>Welcome</a:t></a:r></a:p></p:txBody></p:sp>
+		</p:spTree></p:cSld>
+		<p:timing><p:tnLst><p:par><p:cTn id="1"><p:childTnLst><p:set/></p:childTnLst></p:cTn></p:par></p:tnLst></p:timing>
+	</p:sld>`,
+	"ppt/slides/_rels/slide2.xml.rels": ooxmlRelsHeader + `
+		<Relationship Id="rId1" Type="` + pptxRelType + `slideLayout" Target="../slideLayouts/slideLayout2.xml"/>
+	</Relationships>`,
+
+	"ppt/slideLayouts/slideLayout1.xml": `<p:sldLayout ` + pptxNamespaces + `><p:cSld name="Title Slide"/></p:sldLayout>`,
+	"ppt/slideLayouts/slideLayout2.xml": `<p:sldLayout ` + pptxNamespaces + `><p:cSld name="Title and Content"/></p:sldLayout>`,
+
+	"ppt/slideMasters/slideMaster1.xml": `<p:sldMaster ` + pptxNamespaces + `><p:cSld/></p:sldMaster>`,
+	"ppt/slideMasters/_rels/slideMaster1.xml.rels": ooxmlRelsHeader + `
+		<Relationship Id="rId1" Type="` + pptxRelType + `theme" Target="../theme/theme1.xml"/>
+	</Relationships>`,
+	"ppt/theme/theme1.xml": `<a:theme ` + pptxNamespaces + ` name="Facet"/>`,
+}
+
+func TestGradePptx(t *testing.T) {
+	checkRubric(t, GradePptx, ooxmlFile(t, pptxFixture), []rubricCase{
+		{name: "slide count", rule: common.RubricRule{Kind: common.PptxSlideCount, Count: 2}, passed: true},
+		{name: "wrong slide count", rule: common.RubricRule{Kind: common.PptxSlideCount, Count: 3}, passed: false, detail: "presentation has 2 slides"},
+
+		{name: "title across runs", rule: common.RubricRule{Kind: common.PptxSlideTitle, Index: 1, Text: "Welcome"}, passed: true},
+		{name: "centered title", rule: common.RubricRule{Kind: common.PptxSlideTitle, Index: 2, Text: "agenda"}, passed: true},
+		{name: "title of any slide", rule: common.RubricRule{Kind: common.PptxSlideTitle, Text: "Agenda"}, passed: true},
+		{name: "title of another slide", rule: common.RubricRule{Kind: common.PptxSlideTitle, Index: 2, Text: "Welcome"}, passed: false, detail: "slide 2 does not have the title 'Welcome'"},
+		{name: "title of no slide", rule: common.RubricRule{Kind: common.PptxSlideTitle, Text: "Summary"}, passed: false, detail: "no slide has the title 'Summary'"},
+		{name: "slide past the end", rule: common.RubricRule{Kind: common.PptxSlideTitle, Index: 3, Text: "Welcome"}, passed: false, detail: "presentation has 2 slides"},
+
+		{name: "layout", rule: common.RubricRule{Kind: common.PptxLayoutUsed, Index: 2, Text: "title and content"}, passed: true},
+		{name: "layout of another slide", rule: common.RubricRule{Kind: common.PptxLayoutUsed, Index: 2, Text: "Title Slide"}, passed: false, detail: "slide 2 does not use the layout 'Title Slide'"},
+		{name: "layout of no slide", rule: common.RubricRule{Kind: common.PptxLayoutUsed, Text: "Blank"}, passed: false, detail: "no slide uses the layout 'Blank'"},
+
+		{name: "image", rule: common.RubricRule{Kind: common.PptxImageInserted, Index: 1}, passed: true},
+		{name: "image on any slide", rule: common.RubricRule{Kind: common.PptxImageInserted}, passed: true},
+		{name: "no image", rule: common.RubricRule{Kind: common.PptxImageInserted, Index: 2}, passed: false, detail: "found 0 images"},
+		{name: "too few images", rule: common.RubricRule{Kind: common.PptxImageInserted, Count: 2}, passed: false, detail: "found 1 images"},
+
+		{name: "transition", rule: common.RubricRule{Kind: common.PptxTransition, Index: 1}, passed: true},
+		{name: "no transition", rule: common.RubricRule{Kind: common.PptxTransition, Index: 2}, passed: false, detail: "slide 2 does not have a transition"},
+
+		{name: "animation", rule: common.RubricRule{Kind: common.PptxAnimation, Index: 2}, passed: true},
+		{name: "animation on any slide", rule: common.RubricRule{Kind: common.PptxAnimation}, passed: true},
+		{name: "no animation", rule: common.RubricRule{Kind: common.PptxAnimation, Index: 1}, passed: false, detail: "slide 1 does not have an animation"},
+
+		{name: "speaker notes", rule: common.RubricRule{Kind: common.PptxSpeakerNotes, Index: 1}, passed: true},
+		{name: "no speaker notes", rule: common.RubricRule{Kind: common.PptxSpeakerNotes, Index: 2}, passed: false, detail: "slide 2 does not have speaker notes"},
+
+		{name: "any theme", rule: common.RubricRule{Kind: common.PptxThemeApplied}, passed: true},
+		{name: "named theme", rule: common.RubricRule{Kind: common.PptxThemeApplied, Text: "facet"}, passed: true},
+		{name: "other theme", rule: common.RubricRule{Kind: common.PptxThemeApplied, Text: "Office Theme"}, passed: false, detail: "themes used: Facet"},
+	})
+}
+
+func TestGradePptxDefaultTheme(t *testing.T) {
+	fixture := make(map[string]string)
+	for name, content := range pptxFixture {
+		fixture[name] = content
+	}
+	fixture["ppt/theme/theme1.xml"] = `<a:theme ` + pptxNamespaces + ` name="Office Theme"/>`
+	delete(fixture, "ppt/notesSlides/notesSlide1.xml")
+
+	checkRubric(t, GradePptx, ooxmlFile(t, fixture), []rubricCase{
+		{name: "default theme", rule: common.RubricRule{Kind: common.PptxThemeApplied}, passed: false},
+		{name: "missing notes part", rule: common.RubricRule{Kind: common.PptxSpeakerNotes}, passed: false},
+	})
+}
+
+func TestValidateRubricPptx(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  common.RubricRule
+		valid bool
+	}{
+		{"slide count", common.RubricRule{Kind: common.PptxSlideCount, Count: 5}, true},
+		{"slide count without a count", common.RubricRule{Kind: common.PptxSlideCount}, false},
+		{"title", common.RubricRule{Kind: common.PptxSlideTitle, Index: 1, Text: "Welcome"}, true},
+		{"title of any slide", common.RubricRule{Kind: common.PptxSlideTitle, Text: "Welcome"}, true},
+		{"title without text", common.RubricRule{Kind: common.PptxSlideTitle, Index: 1}, false},
+		{"layout without a name", common.RubricRule{Kind: common.PptxLayoutUsed, Index: 1}, false},
+		{"images", common.RubricRule{Kind: common.PptxImageInserted, Index: 2, Count: 2}, true},
+		{"negative image count", common.RubricRule{Kind: common.PptxImageInserted, Count: -1}, false},
+		{"negative slide", common.RubricRule{Kind: common.PptxTransition, Index: -1}, false},
+		{"animation", common.RubricRule{Kind: common.PptxAnimation, Index: 3}, true},
+		{"default theme", common.RubricRule{Kind: common.PptxThemeApplied}, true},
+		{"rule of another test type", common.RubricRule{Kind: common.XlsxChartExists, Sheet: "Data"}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateRubric(common.PptTest, []common.RubricRule{c.rule})
+			if (err == nil) != c.valid {
+				t.Fatalf("got %v, want valid %v", err, c.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"common"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// updates queued for an admin stream. a stream that falls this far behind is closed, the
+// admin panel reconnects and starts over from a snapshot
+const presenceStreamBuffer = 64
+
+// keeps the presence of every candidate that connected since the server started and
+// streams changes to subscribers
+type PresenceHub struct {
+	mutex       sync.Mutex
+	states      map[string]*common.CandidatePresence
+	subscribers map[chan common.CandidatePresence]struct{}
+}
+
+func NewPresenceHub() *PresenceHub {
+	return &PresenceHub{
+		states:      make(map[string]*common.CandidatePresence),
+		subscribers: make(map[chan common.CandidatePresence]struct{}),
+	}
+}
+
+// applies a change to a candidate's presence and sends the new state to subscribers
+func (self *PresenceHub) update(username string, change func(presence *common.CandidatePresence)) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	state, ok := self.states[username]
+	if !ok {
+		state = &common.CandidatePresence{Username: username}
+		self.states[username] = state
+	}
+	change(state)
+
+	update := *state
+	update.Submitted = slices.Clone(state.Submitted)
+	for sub := range self.subscribers {
+		select {
+		case sub <- update:
+		default:
+			log.Println("presence stream fell behind, closing it")
+			delete(self.subscribers, sub)
+			close(sub)
+		}
+	}
+}
+
+func (self *PresenceHub) connected(username string, batch string) {
+	now := time.Now()
+	self.update(username, func(presence *common.CandidatePresence) {
+		presence.Batch = batch
+		presence.Connected = true
+		presence.ConnectedSince = now
+		presence.LastSeen = now
+	})
+}
+
+func (self *PresenceHub) disconnected(username string) {
+	self.update(username, func(presence *common.CandidatePresence) {
+		presence.Connected = false
+		presence.OpenApp = ""
+	})
+}
+
+func (self *PresenceHub) seen(username string, machine *common.TPresence) {
+	now := time.Now()
+	self.update(username, func(presence *common.CandidatePresence) {
+		presence.LastSeen = now
+		if machine != nil {
+			presence.Hostname = machine.Hostname
+			presence.OS = machine.OS
+			presence.Route = machine.Route
+			presence.OpenApp = machine.OpenApp
+		}
+	})
+}
+
+func (self *PresenceHub) submitted(username string, testId common.ID) {
+	self.update(username, func(presence *common.CandidatePresence) {
+		if !slices.Contains(presence.Submitted, testId) {
+			presence.Submitted = append(presence.Submitted, testId)
+		}
+	})
+}
+
+// every known candidate, sorted by username
+func (self *PresenceHub) Snapshot() []common.CandidatePresence {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	snapshot := make([]common.CandidatePresence, 0, len(self.states))
+	for _, state := range self.states {
+		presence := *state
+		presence.Submitted = slices.Clone(state.Submitted)
+		snapshot = append(snapshot, presence)
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].Username < snapshot[j].Username
+	})
+	return snapshot
+}
+
+// returns a channel with every change from now on and a func to stop them. the channel is
+// closed when the subscriber falls behind or unsubscribes
+func (self *PresenceHub) Subscribe() (<-chan common.CandidatePresence, func()) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	sub := make(chan common.CandidatePresence, presenceStreamBuffer)
+	self.subscribers[sub] = struct{}{}
+
+	unsubscribe := func() {
+		self.mutex.Lock()
+		defer self.mutex.Unlock()
+
+		if _, ok := self.subscribers[sub]; ok {
+			delete(self.subscribers, sub)
+			close(sub)
+		}
+	}
+	return sub, unsubscribe
+}
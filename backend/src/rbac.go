@@ -0,0 +1,171 @@
+package main
+
+import (
+	"common"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Permission string
+
+const (
+	PermManageAdmins  Permission = "manage_admins"
+	PermManageTests   Permission = "manage_tests"
+	PermManageBatches Permission = "manage_batches"
+	PermManageUsers   Permission = "manage_users"
+	PermViewUsers     Permission = "view_users"
+	PermViewBatches   Permission = "view_batches"
+	PermViewSessions  Permission = "view_sessions"
+	PermViewTests     Permission = "view_tests"
+	PermViewResults   Permission = "view_results"
+	// rubrics and grading
+	PermGrade Permission = "grade"
+	// live exam actions, e.g. kicking a candidate's old machine
+	PermProctor Permission = "proctor"
+)
+
+var rolePermissions = map[common.AdminRole][]Permission{
+	common.SuperAdmin: {
+		PermManageAdmins, PermManageTests, PermManageBatches, PermManageUsers,
+		PermViewUsers, PermViewBatches, PermViewSessions, PermViewTests, PermViewResults, PermGrade, PermProctor,
+	},
+	common.ExamManager: {
+		PermManageTests, PermManageBatches, PermManageUsers,
+		PermViewUsers, PermViewBatches, PermViewSessions, PermViewTests, PermViewResults, PermGrade, PermProctor,
+	},
+	common.Proctor: {PermViewUsers, PermViewBatches, PermViewSessions, PermProctor},
+	common.Grader:  {PermViewTests, PermViewResults, PermGrade},
+	common.Auditor: {PermViewUsers, PermViewBatches, PermViewSessions, PermViewTests, PermViewResults},
+}
+
+func validRole(role common.AdminRole) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func effectiveRole(admin *common.Admin) common.AdminRole {
+	if validRole(admin.Role) {
+		return admin.Role
+	}
+	return common.Auditor
+}
+
+func RolePermissions(role common.AdminRole) []Permission {
+	return rolePermissions[role]
+}
+
+func HasPermission(admin *common.Admin, permission Permission) bool {
+	for _, p := range rolePermissions[effectiveRole(admin)] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// admin behind the claims AdminJWTAuthMiddleware put in the context. looked up once per request
+func currentAdmin(c *gin.Context, admins AdminRepository) (*common.Admin, error) {
+	if val, ok := c.Get("admin"); ok {
+		return val.(*common.Admin), nil
+	}
+
+	val, ok := c.Get("claims")
+	if !ok {
+		return nil, errors.New("not authenticated")
+	}
+	admin, err := admins.FindByUsername(c, val.(*Claims).Username)
+	if err != nil {
+		return nil, err
+	}
+	c.Set("admin", admin)
+	return admin, nil
+}
+
+// must run after AdminJWTAuthMiddleware
+func RequirePermission(admins AdminRepository, permission Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admin, err := currentAdmin(c, admins)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Admin not found"})
+			c.Abort()
+			return
+		}
+
+		if !HasPermission(admin, permission) {
+			c.JSON(403, gin.H{
+				"error":   "Forbidden",
+				"message": fmt.Sprintf("role '%s' does not have the '%s' permission", effectiveRole(admin), permission),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// like RequirePermission, for routes any of several roles need. must run after
+// AdminJWTAuthMiddleware
+func RequireAnyPermission(admins AdminRepository, permissions ...Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admin, err := currentAdmin(c, admins)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Admin not found"})
+			c.Abort()
+			return
+		}
+
+		for _, permission := range permissions {
+			if HasPermission(admin, permission) {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(403, gin.H{
+			"error":   "Forbidden",
+			"message": fmt.Sprintf("role '%s' does not have any of the %v permissions", effectiveRole(admin), permissions),
+		})
+		c.Abort()
+	}
+}
+
+var ErrBootstrapClosed = errors.New("admin bootstrap is not available")
+
+var bootstrapMutex sync.Mutex
+
+// ADMIN_BOOTSTRAP_TOKEN lets the first super admin be created on a fresh install. it stops
+// working as soon as a super admin exists, after that only super admins can add admins
+func BootstrapAdmin(ctx context.Context, admins AdminRepository, token string, admin *common.Admin) error {
+	expected := os.Getenv("ADMIN_BOOTSTRAP_TOKEN")
+	if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		return ErrBootstrapClosed
+	}
+
+	bootstrapMutex.Lock()
+	defer bootstrapMutex.Unlock()
+
+	all, err := admins.All(ctx)
+	if err != nil {
+		return err
+	}
+	for _, existing := range all {
+		if existing.Role == common.SuperAdmin {
+			return ErrBootstrapClosed
+		}
+	}
+
+	admin.Role = common.SuperAdmin
+	err = RegisterAdmin(ctx, admins, admin)
+	if err != nil {
+		return err
+	}
+	log.Printf("bootstrapped super admin '%s'", admin.Username)
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"common"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// storing the document would break a unique constraint
+var ErrDuplicate = errors.New("duplicate")
+
+type AdminRepository interface {
+	Add(ctx context.Context, admin *common.Admin) error
+	FindByUsername(ctx context.Context, username string) (*common.Admin, error)
+	All(ctx context.Context) ([]common.Admin, error)
+	SetRole(ctx context.Context, username string, role common.AdminRole) error
+}
+
+type UserRepository interface {
+	Add(ctx context.Context, user *common.User) error
+	AddMany(ctx context.Context, users []common.User) (int, error)
+	FindByUsername(ctx context.Context, username string) (*common.User, error)
+	FindByBatch(ctx context.Context, batch string) ([]common.User, error)
+	All(ctx context.Context) ([]common.User, error)
+	SetPassword(ctx context.Context, id common.ID, password string) error
+	// number of users whose username or batch contains search (case insensitive)
+	Count(ctx context.Context, search string) (int64, error)
+	// users whose username or batch contains search (case insensitive), sorted by username
+	Search(ctx context.Context, search string, skip int, limit int) ([]common.User, error)
+	Delete(ctx context.Context, id common.ID) error
+}
+
+type BatchRepository interface {
+	Add(ctx context.Context, batch *common.Batch) error
+	FindByName(ctx context.Context, name string) (*common.Batch, error)
+	All(ctx context.Context) ([]common.Batch, error)
+}
+
+type TestRepository interface {
+	Add(ctx context.Context, test *common.Test) error
+	FindById(ctx context.Context, id common.ID) (*common.Test, error)
+	FindByIds(ctx context.Context, ids []common.ID) ([]common.Test, error)
+	All(ctx context.Context) ([]common.Test, error)
+	SetTypingText(ctx context.Context, id common.ID, typingText string) error
+	SetRubric(ctx context.Context, id common.ID, rubric []common.RubricRule) error
+}
+
+type SubmissionRepository interface {
+	// ErrDuplicate if there is a submission with the same ClientSubmissionId, or one of the
+	// same attempt that is not superseded
+	Add(ctx context.Context, submission *common.TestSubmission) error
+	FindByClientId(ctx context.Context, clientSubmissionId string) (*common.TestSubmission, error)
+	// the submission of an attempt that counts
+	FindCurrent(ctx context.Context, attemptId common.ID) (*common.TestSubmission, error)
+	// submissions of a user at a test, or at every test (zero testId), oldest first
+	FindByUser(ctx context.Context, username string, testId common.ID) ([]common.TestSubmission, error)
+	SetSuperseded(ctx context.Context, id common.ID, superseded bool) error
+}
+
+type ResultRepository interface {
+	Add(ctx context.Context, result *common.Result) error
+	// results of the submissions that count
+	FindByTest(ctx context.Context, testId common.ID) ([]common.Result, error)
+	SetSuperseded(ctx context.Context, submissionId common.ID, superseded bool) error
+}
+
+type ExamSessionRepository interface {
+	Add(ctx context.Context, session *common.ExamSession) error
+	FindById(ctx context.Context, id common.ID) (*common.ExamSession, error)
+	All(ctx context.Context) ([]common.ExamSession, error)
+	// sessions of a batch that are running at the given time and were not finished early
+	FindActive(ctx context.Context, batch string, at time.Time) ([]common.ExamSession, error)
+	// sessions that ended at or before the given time and are not marked finished
+	FindEnded(ctx context.Context, at time.Time) ([]common.ExamSession, error)
+	SetFinished(ctx context.Context, id common.ID) error
+}
+
+type AttemptRepository interface {
+	Add(ctx context.Context, attempt *common.Attempt) error
+	// the most recently started attempt of a user at a test
+	FindLatest(ctx context.Context, username string, testId common.ID) (*common.Attempt, error)
+	FindBySession(ctx context.Context, sessionId common.ID) ([]common.Attempt, error)
+	// attempts of a user that were started but not submitted yet
+	FindOpen(ctx context.Context, username string) ([]common.Attempt, error)
+	SetSubmitted(ctx context.Context, id common.ID, at time.Time, late bool) error
+	SetDeadline(ctx context.Context, id common.ID, deadline time.Time, extraMinutes int) error
+}
+
+// zero fields match anything
+type ActivityFilter struct {
+	Username  string
+	TestId    common.ID
+	AttemptId common.ID
+	Kind      common.ActivityKind
+	// bounds on ActivityEvent.At. Until is exclusive
+	Since time.Time
+	Until time.Time
+	// 0 for no limit
+	Limit int
+}
+
+type ActivityRepository interface {
+	Add(ctx context.Context, event *common.ActivityEvent) error
+	// events that match the filter, oldest first
+	Find(ctx context.Context, filter ActivityFilter) ([]common.ActivityEvent, error)
+}
+
+type SnapshotRepository interface {
+	Add(ctx context.Context, snapshot *common.Snapshot) error
+	// the highest version of an attempt
+	FindLatest(ctx context.Context, attemptId common.ID) (*common.Snapshot, error)
+	// every version of a user's attempts at a test, oldest first
+	FindByUser(ctx context.Context, username string, testId common.ID) ([]common.Snapshot, error)
+	// a snapshot of the user with the file, any of them if there are more
+	FindByHash(ctx context.Context, username string, hash string) (*common.Snapshot, error)
+}
+
+type SessionRepository interface {
+	Add(ctx context.Context, session *Session) error
+	FindById(ctx context.Context, id common.ID) (*Session, error)
+	FindByRefreshHash(ctx context.Context, hash string) (*Session, error)
+	// replaces the refresh token of a session, only if it is still oldHash and the session is
+	// not revoked. ErrSessionRevoked otherwise, so a refresh token is only ever traded once
+	Rotate(ctx context.Context, id common.ID, oldHash string, newHash string, expires time.Time) error
+	Revoke(ctx context.Context, id common.ID) error
+	// revokes every live session of a user with the given audience. returns how many were revoked
+	RevokeByUsername(ctx context.Context, audience string, username string) (int, error)
+}
+
+type Repositories struct {
+	Admins      AdminRepository
+	Users       UserRepository
+	Batches     BatchRepository
+	Tests       TestRepository
+	Submissions SubmissionRepository
+	Results     ResultRepository
+	Sessions    SessionRepository
+	Exams       ExamSessionRepository
+	Attempts    AttemptRepository
+	Activity    ActivityRepository
+	Snapshots   SnapshotRepository
+}
+
+// DB_BACKEND selects the implementation:
+//   - mongo (default): MongoDB at MONGODB_URI
+//   - bolt: embedded database in the file BOLT_PATH (default ./gravishken.db). no database
+//     server needed
+func NewRepositoriesFromEnv() (*Repositories, error) {
+	switch backend := getEnvOrDefault("DB_BACKEND", "mongo"); backend {
+	case "mongo":
+		return NewMongoRepositories()
+	case "bolt":
+		return NewBoltRepositories(getEnvOrDefault("BOLT_PATH", "gravishken.db"))
+	default:
+		return nil, fmt.Errorf("unknown DB_BACKEND '%s'", backend)
+	}
+}
@@ -0,0 +1,691 @@
+package main
+
+import (
+	"common"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// embedded single file database for small exam centres that don't run a database server.
+// every model gets a bucket of bson encoded documents keyed by their object id. lookups
+// by anything else scan the bucket, which is fine for the size of data a centre has
+const (
+	boltAdmins      = "admins"
+	boltUsers       = "users"
+	boltBatches     = "batches"
+	boltTests       = "tests"
+	boltSubmissions = "submissions"
+	boltResults     = "results"
+	boltSessions    = "sessions"
+	boltExams       = "exam_sessions"
+	boltAttempts    = "attempts"
+	boltActivity    = "activity"
+	boltSnapshots   = "snapshots"
+)
+
+func NewBoltRepositories(path string) (*Repositories, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database '%s': %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range []string{boltAdmins, boltUsers, boltBatches, boltTests, boltSubmissions, boltResults, boltSessions, boltExams, boltAttempts, boltActivity, boltSnapshots} {
+			_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to set up database '%s': %v", path, err)
+	}
+
+	log.Printf("Using embedded database at %s", path)
+
+	return &Repositories{
+		Admins:      &boltAdminRepo{db: db},
+		Users:       &boltUserRepo{db: db},
+		Batches:     &boltBatchRepo{db: db},
+		Tests:       &boltTestRepo{db: db},
+		Submissions: &boltSubmissionRepo{db: db},
+		Results:     &boltResultRepo{db: db},
+		Sessions:    &boltSessionRepo{db: db},
+		Exams:       &boltExamSessionRepo{db: db},
+		Attempts:    &boltAttemptRepo{db: db},
+		Activity:    &boltActivityRepo{db: db},
+		Snapshots:   &boltSnapshotRepo{db: db},
+	}, nil
+}
+
+func boltInsert(db *bolt.DB, bucket string, id *common.ID, doc interface{}) error {
+	if id.IsZero() {
+		*id = primitive.NewObjectID()
+	}
+	return boltPut(db, bucket, *id, doc)
+}
+
+func boltPut(db *bolt.DB, bucket string, id common.ID, doc interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Put(id[:], data)
+	})
+}
+
+func boltGet[T any](db *bolt.DB, bucket string, id common.ID) (*T, error) {
+	var doc *T
+	err := db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(bucket)).Get(id[:])
+		if data == nil {
+			return ErrNotFound
+		}
+		doc = new(T)
+		return bson.Unmarshal(data, doc)
+	})
+	return doc, err
+}
+
+// documents in a bucket (in insertion order) that match. match may be nil
+func boltScan[T any](db *bolt.DB, bucket string, match func(doc *T) bool) ([]T, error) {
+	docs := []T{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(key []byte, data []byte) error {
+			var doc T
+			err := bson.Unmarshal(data, &doc)
+			if err != nil {
+				return err
+			}
+			if match == nil || match(&doc) {
+				docs = append(docs, doc)
+			}
+			return nil
+		})
+	})
+	return docs, err
+}
+
+func boltFindOne[T any](db *bolt.DB, bucket string, match func(doc *T) bool) (*T, error) {
+	docs, err := boltScan(db, bucket, match)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &docs[0], nil
+}
+
+func boltDelete(db *bolt.DB, bucket string, id common.ID) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b.Get(id[:]) == nil {
+			return ErrNotFound
+		}
+		return b.Delete(id[:])
+	})
+}
+
+// read modify write of a single document
+func boltModify[T any](db *bolt.DB, bucket string, id common.ID, modify func(doc *T) error) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		data := b.Get(id[:])
+		if data == nil {
+			return ErrNotFound
+		}
+		var doc T
+		err := bson.Unmarshal(data, &doc)
+		if err != nil {
+			return err
+		}
+		err = modify(&doc)
+		if err != nil {
+			return err
+		}
+		data, err = bson.Marshal(&doc)
+		if err != nil {
+			return err
+		}
+		return b.Put(id[:], data)
+	})
+}
+
+type boltAdminRepo struct {
+	db *bolt.DB
+}
+
+func (self *boltAdminRepo) Add(ctx context.Context, admin *common.Admin) error {
+	return boltInsert(self.db, boltAdmins, &admin.Id, admin)
+}
+
+func (self *boltAdminRepo) FindByUsername(ctx context.Context, username string) (*common.Admin, error) {
+	return boltFindOne(self.db, boltAdmins, func(admin *common.Admin) bool {
+		return admin.Username == username
+	})
+}
+
+func (self *boltAdminRepo) All(ctx context.Context) ([]common.Admin, error) {
+	return boltScan[common.Admin](self.db, boltAdmins, nil)
+}
+
+func (self *boltAdminRepo) SetRole(ctx context.Context, username string, role common.AdminRole) error {
+	admin, err := self.FindByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+	return boltModify(self.db, boltAdmins, admin.Id, func(admin *common.Admin) error {
+		admin.Role = role
+		return nil
+	})
+}
+
+type boltUserRepo struct {
+	db *bolt.DB
+}
+
+func (self *boltUserRepo) Add(ctx context.Context, user *common.User) error {
+	return boltInsert(self.db, boltUsers, &user.Id, user)
+}
+
+func (self *boltUserRepo) AddMany(ctx context.Context, users []common.User) (int, error) {
+	err := self.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(boltUsers))
+		for i := range users {
+			if users[i].Id.IsZero() {
+				users[i].Id = primitive.NewObjectID()
+			}
+			data, err := bson.Marshal(&users[i])
+			if err != nil {
+				return err
+			}
+			err = b.Put(users[i].Id[:], data)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(users), nil
+}
+
+func (self *boltUserRepo) FindByUsername(ctx context.Context, username string) (*common.User, error) {
+	return boltFindOne(self.db, boltUsers, func(user *common.User) bool {
+		return user.Username == username
+	})
+}
+
+func (self *boltUserRepo) FindByBatch(ctx context.Context, batch string) ([]common.User, error) {
+	return boltScan(self.db, boltUsers, func(user *common.User) bool {
+		return user.Batch == batch
+	})
+}
+
+func (self *boltUserRepo) All(ctx context.Context) ([]common.User, error) {
+	return boltScan[common.User](self.db, boltUsers, nil)
+}
+
+func (self *boltUserRepo) SetPassword(ctx context.Context, id common.ID, password string) error {
+	return boltModify(self.db, boltUsers, id, func(user *common.User) error {
+		user.Password = password
+		return nil
+	})
+}
+
+func (self *boltUserRepo) search(search string) ([]common.User, error) {
+	search = strings.ToLower(search)
+	return boltScan(self.db, boltUsers, func(user *common.User) bool {
+		return strings.Contains(strings.ToLower(user.Username), search) ||
+			strings.Contains(strings.ToLower(user.Batch), search)
+	})
+}
+
+func (self *boltUserRepo) Count(ctx context.Context, search string) (int64, error) {
+	users, err := self.search(search)
+	return int64(len(users)), err
+}
+
+func (self *boltUserRepo) Search(ctx context.Context, search string, skip int, limit int) ([]common.User, error) {
+	users, err := self.search(search)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	skip = min(max(skip, 0), len(users))
+	users = users[skip:]
+	if limit > 0 && limit < len(users) {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (self *boltUserRepo) Delete(ctx context.Context, id common.ID) error {
+	return boltDelete(self.db, boltUsers, id)
+}
+
+type boltBatchRepo struct {
+	db *bolt.DB
+}
+
+func (self *boltBatchRepo) Add(ctx context.Context, batch *common.Batch) error {
+	return boltInsert(self.db, boltBatches, &batch.Id, batch)
+}
+
+func (self *boltBatchRepo) FindByName(ctx context.Context, name string) (*common.Batch, error) {
+	return boltFindOne(self.db, boltBatches, func(batch *common.Batch) bool {
+		return batch.Name == name
+	})
+}
+
+func (self *boltBatchRepo) All(ctx context.Context) ([]common.Batch, error) {
+	return boltScan[common.Batch](self.db, boltBatches, nil)
+}
+
+type boltTestRepo struct {
+	db *bolt.DB
+}
+
+func (self *boltTestRepo) Add(ctx context.Context, test *common.Test) error {
+	return boltInsert(self.db, boltTests, &test.Id, test)
+}
+
+func (self *boltTestRepo) FindById(ctx context.Context, id common.ID) (*common.Test, error) {
+	return boltGet[common.Test](self.db, boltTests, id)
+}
+
+func (self *boltTestRepo) FindByIds(ctx context.Context, ids []common.ID) ([]common.Test, error) {
+	tests := []common.Test{}
+	for _, id := range ids {
+		test, err := boltGet[common.Test](self.db, boltTests, id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, *test)
+	}
+	return tests, nil
+}
+
+func (self *boltTestRepo) All(ctx context.Context) ([]common.Test, error) {
+	return boltScan[common.Test](self.db, boltTests, nil)
+}
+
+func (self *boltTestRepo) SetTypingText(ctx context.Context, id common.ID, typingText string) error {
+	return boltModify(self.db, boltTests, id, func(test *common.Test) error {
+		if test.Type != common.TypingTest {
+			return ErrNotFound
+		}
+		test.TypingText = typingText
+		return nil
+	})
+}
+
+func (self *boltTestRepo) SetRubric(ctx context.Context, id common.ID, rubric []common.RubricRule) error {
+	return boltModify(self.db, boltTests, id, func(test *common.Test) error {
+		test.Rubric = rubric
+		return nil
+	})
+}
+
+type boltSubmissionRepo struct {
+	db *bolt.DB
+}
+
+// checks the same constraints as the unique indexes of the mongo backend, in the
+// transaction that stores the submission
+func (self *boltSubmissionRepo) Add(ctx context.Context, submission *common.TestSubmission) error {
+	if submission.Id.IsZero() {
+		submission.Id = primitive.NewObjectID()
+	}
+	data, err := bson.Marshal(submission)
+	if err != nil {
+		return err
+	}
+
+	return self.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(boltSubmissions))
+		err := b.ForEach(func(key []byte, data []byte) error {
+			var other common.TestSubmission
+			err := bson.Unmarshal(data, &other)
+			if err != nil {
+				return err
+			}
+			if submission.ClientSubmissionId != "" && other.ClientSubmissionId == submission.ClientSubmissionId {
+				return ErrDuplicate
+			}
+			if !submission.AttemptId.IsZero() && other.AttemptId == submission.AttemptId && !other.Superseded && !submission.Superseded {
+				return ErrDuplicate
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return b.Put(submission.Id[:], data)
+	})
+}
+
+func (self *boltSubmissionRepo) FindByClientId(ctx context.Context, clientSubmissionId string) (*common.TestSubmission, error) {
+	return boltFindOne(self.db, boltSubmissions, func(submission *common.TestSubmission) bool {
+		return submission.ClientSubmissionId == clientSubmissionId
+	})
+}
+
+func (self *boltSubmissionRepo) FindCurrent(ctx context.Context, attemptId common.ID) (*common.TestSubmission, error) {
+	return boltFindOne(self.db, boltSubmissions, func(submission *common.TestSubmission) bool {
+		return submission.AttemptId == attemptId && !submission.Superseded
+	})
+}
+
+func (self *boltSubmissionRepo) FindByUser(ctx context.Context, username string, testId common.ID) ([]common.TestSubmission, error) {
+	submissions, err := boltScan(self.db, boltSubmissions, func(submission *common.TestSubmission) bool {
+		return submission.Username == username && (testId.IsZero() || submission.TestId == testId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(submissions, func(i, j int) bool {
+		return submissions[i].SubmittedAt.Before(submissions[j].SubmittedAt)
+	})
+	return submissions, nil
+}
+
+func (self *boltSubmissionRepo) SetSuperseded(ctx context.Context, id common.ID, superseded bool) error {
+	return boltModify(self.db, boltSubmissions, id, func(submission *common.TestSubmission) error {
+		submission.Superseded = superseded
+		return nil
+	})
+}
+
+type boltResultRepo struct {
+	db *bolt.DB
+}
+
+func (self *boltResultRepo) Add(ctx context.Context, result *common.Result) error {
+	return boltInsert(self.db, boltResults, &result.Id, result)
+}
+
+func (self *boltResultRepo) FindByTest(ctx context.Context, testId common.ID) ([]common.Result, error) {
+	return boltScan(self.db, boltResults, func(result *common.Result) bool {
+		return result.TestId == testId && !result.Superseded
+	})
+}
+
+func (self *boltResultRepo) SetSuperseded(ctx context.Context, submissionId common.ID, superseded bool) error {
+	results, err := boltScan(self.db, boltResults, func(result *common.Result) bool {
+		return result.SubmissionId == submissionId
+	})
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		err = boltModify(self.db, boltResults, result.Id, func(result *common.Result) error {
+			result.Superseded = superseded
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type boltSessionRepo struct {
+	db *bolt.DB
+}
+
+func (self *boltSessionRepo) Add(ctx context.Context, session *Session) error {
+	return boltInsert(self.db, boltSessions, &session.Id, session)
+}
+
+func (self *boltSessionRepo) FindById(ctx context.Context, id common.ID) (*Session, error) {
+	return boltGet[Session](self.db, boltSessions, id)
+}
+
+func (self *boltSessionRepo) FindByRefreshHash(ctx context.Context, hash string) (*Session, error) {
+	return boltFindOne(self.db, boltSessions, func(session *Session) bool {
+		return session.RefreshHash == hash
+	})
+}
+
+func (self *boltSessionRepo) Rotate(ctx context.Context, id common.ID, oldHash string, newHash string, expires time.Time) error {
+	err := boltModify(self.db, boltSessions, id, func(session *Session) error {
+		if session.RefreshHash != oldHash || session.Revoked {
+			return ErrSessionRevoked
+		}
+		session.RefreshHash = newHash
+		session.ExpiresAt = expires
+		return nil
+	})
+	if err == ErrNotFound {
+		return ErrSessionRevoked
+	}
+	return err
+}
+
+func (self *boltSessionRepo) Revoke(ctx context.Context, id common.ID) error {
+	return boltModify(self.db, boltSessions, id, func(session *Session) error {
+		session.Revoked = true
+		return nil
+	})
+}
+
+func (self *boltSessionRepo) RevokeByUsername(ctx context.Context, audience string, username string) (int, error) {
+	revoked := 0
+	err := self.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(boltSessions))
+		return b.ForEach(func(key []byte, data []byte) error {
+			var session Session
+			err := bson.Unmarshal(data, &session)
+			if err != nil {
+				return err
+			}
+			if session.Revoked || session.Audience != audience || session.Username != username {
+				return nil
+			}
+			session.Revoked = true
+			data, err = bson.Marshal(&session)
+			if err != nil {
+				return err
+			}
+			revoked++
+			// overwriting the value of the current key is allowed during ForEach
+			return b.Put(key, data)
+		})
+	})
+	return revoked, err
+}
+
+type boltExamSessionRepo struct {
+	db *bolt.DB
+}
+
+func (self *boltExamSessionRepo) Add(ctx context.Context, session *common.ExamSession) error {
+	return boltInsert(self.db, boltExams, &session.Id, session)
+}
+
+func (self *boltExamSessionRepo) FindById(ctx context.Context, id common.ID) (*common.ExamSession, error) {
+	return boltGet[common.ExamSession](self.db, boltExams, id)
+}
+
+func (self *boltExamSessionRepo) All(ctx context.Context) ([]common.ExamSession, error) {
+	sessions, err := boltScan[common.ExamSession](self.db, boltExams, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].StartsAt.Before(sessions[j].StartsAt)
+	})
+	return sessions, nil
+}
+
+func (self *boltExamSessionRepo) FindActive(ctx context.Context, batch string, at time.Time) ([]common.ExamSession, error) {
+	return boltScan(self.db, boltExams, func(session *common.ExamSession) bool {
+		return session.Batch == batch && !session.StartsAt.After(at) && session.EndsAt.After(at) && !session.Finished
+	})
+}
+
+func (self *boltExamSessionRepo) FindEnded(ctx context.Context, at time.Time) ([]common.ExamSession, error) {
+	return boltScan(self.db, boltExams, func(session *common.ExamSession) bool {
+		return !session.EndsAt.After(at) && !session.Finished
+	})
+}
+
+func (self *boltExamSessionRepo) SetFinished(ctx context.Context, id common.ID) error {
+	return boltModify(self.db, boltExams, id, func(session *common.ExamSession) error {
+		session.Finished = true
+		return nil
+	})
+}
+
+type boltAttemptRepo struct {
+	db *bolt.DB
+}
+
+func (self *boltAttemptRepo) Add(ctx context.Context, attempt *common.Attempt) error {
+	return boltInsert(self.db, boltAttempts, &attempt.Id, attempt)
+}
+
+func (self *boltAttemptRepo) FindLatest(ctx context.Context, username string, testId common.ID) (*common.Attempt, error) {
+	attempts, err := boltScan(self.db, boltAttempts, func(attempt *common.Attempt) bool {
+		return attempt.Username == username && attempt.TestId == testId
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(attempts) == 0 {
+		return nil, ErrNotFound
+	}
+	latest := &attempts[0]
+	for i := range attempts {
+		if attempts[i].StartedAt.After(latest.StartedAt) {
+			latest = &attempts[i]
+		}
+	}
+	return latest, nil
+}
+
+func (self *boltAttemptRepo) FindBySession(ctx context.Context, sessionId common.ID) ([]common.Attempt, error) {
+	return boltScan(self.db, boltAttempts, func(attempt *common.Attempt) bool {
+		return attempt.SessionId == sessionId
+	})
+}
+
+func (self *boltAttemptRepo) FindOpen(ctx context.Context, username string) ([]common.Attempt, error) {
+	return boltScan(self.db, boltAttempts, func(attempt *common.Attempt) bool {
+		return attempt.Username == username && attempt.SubmittedAt.IsZero()
+	})
+}
+
+func (self *boltAttemptRepo) SetDeadline(ctx context.Context, id common.ID, deadline time.Time, extraMinutes int) error {
+	return boltModify(self.db, boltAttempts, id, func(attempt *common.Attempt) error {
+		attempt.Deadline = deadline
+		attempt.ExtraMinutes = extraMinutes
+		return nil
+	})
+}
+
+func (self *boltAttemptRepo) SetSubmitted(ctx context.Context, id common.ID, at time.Time, late bool) error {
+	return boltModify(self.db, boltAttempts, id, func(attempt *common.Attempt) error {
+		attempt.SubmittedAt = at
+		attempt.Late = late
+		return nil
+	})
+}
+
+type boltActivityRepo struct {
+	db *bolt.DB
+}
+
+func (self *boltActivityRepo) Add(ctx context.Context, event *common.ActivityEvent) error {
+	return boltInsert(self.db, boltActivity, &event.Id, event)
+}
+
+func (self *boltActivityRepo) Find(ctx context.Context, filter ActivityFilter) ([]common.ActivityEvent, error) {
+	events, err := boltScan(self.db, boltActivity, func(event *common.ActivityEvent) bool {
+		return (filter.Username == "" || event.Username == filter.Username) &&
+			(filter.TestId.IsZero() || event.TestId == filter.TestId) &&
+			(filter.AttemptId.IsZero() || event.AttemptId == filter.AttemptId) &&
+			(filter.Kind == "" || event.Kind == filter.Kind) &&
+			(filter.Since.IsZero() || !event.At.Before(filter.Since)) &&
+			(filter.Until.IsZero() || event.At.Before(filter.Until))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].At.Before(events[j].At)
+	})
+	if filter.Limit > 0 && filter.Limit < len(events) {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
+
+type boltSnapshotRepo struct {
+	db *bolt.DB
+}
+
+func (self *boltSnapshotRepo) Add(ctx context.Context, snapshot *common.Snapshot) error {
+	return boltInsert(self.db, boltSnapshots, &snapshot.Id, snapshot)
+}
+
+func (self *boltSnapshotRepo) FindLatest(ctx context.Context, attemptId common.ID) (*common.Snapshot, error) {
+	snapshots, err := boltScan(self.db, boltSnapshots, func(snapshot *common.Snapshot) bool {
+		return snapshot.AttemptId == attemptId
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, ErrNotFound
+	}
+	latest := &snapshots[0]
+	for i := range snapshots {
+		if snapshots[i].Version > latest.Version {
+			latest = &snapshots[i]
+		}
+	}
+	return latest, nil
+}
+
+func (self *boltSnapshotRepo) FindByUser(ctx context.Context, username string, testId common.ID) ([]common.Snapshot, error) {
+	snapshots, err := boltScan(self.db, boltSnapshots, func(snapshot *common.Snapshot) bool {
+		return snapshot.Username == username && snapshot.TestId == testId
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].TakenAt.Before(snapshots[j].TakenAt)
+	})
+	return snapshots, nil
+}
+
+func (self *boltSnapshotRepo) FindByHash(ctx context.Context, username string, hash string) (*common.Snapshot, error) {
+	return boltFindOne(self.db, boltSnapshots, func(snapshot *common.Snapshot) bool {
+		return snapshot.Username == username && snapshot.FileHash == hash
+	})
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"common"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func NewMongoRepositories() (*Repositories, error) {
+	uri, ok := os.LookupEnv("MONGODB_URI")
+	if !ok {
+		return nil, fmt.Errorf("MONGODB_URI not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %v", err)
+	}
+
+	log.Println("Successfully connected to MongoDB!")
+
+	db := client.Database("GRAVTEST")
+
+	err = createSubmissionIndexes(ctx, db.Collection("Submission"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create submission indexes: %v", err)
+	}
+
+	return &Repositories{
+		Admins:      &mongoAdminRepo{collection: db.Collection("Admin")},
+		Users:       &mongoUserRepo{collection: db.Collection("Users")},
+		Batches:     &mongoBatchRepo{collection: db.Collection("Batch")},
+		Tests:       &mongoTestRepo{collection: db.Collection("Tests")},
+		Submissions: &mongoSubmissionRepo{collection: db.Collection("Submission")},
+		Results:     &mongoResultRepo{collection: db.Collection("Result")},
+		Sessions:    &mongoSessionRepo{collection: db.Collection("Session")},
+		Exams:       &mongoExamSessionRepo{collection: db.Collection("ExamSession")},
+		Attempts:    &mongoAttemptRepo{collection: db.Collection("Attempt")},
+		Activity:    &mongoActivityRepo{collection: db.Collection("Activity")},
+		Snapshots:   &mongoSnapshotRepo{collection: db.Collection("Snapshot")},
+	}, nil
+}
+
+func mongoFindOne[T any](ctx context.Context, collection *mongo.Collection, filter interface{}) (*T, error) {
+	var doc T
+	err := collection.FindOne(ctx, filter).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func mongoFind[T any](ctx context.Context, collection *mongo.Collection, filter interface{}, opts ...*options.FindOptions) ([]T, error) {
+	cursor, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	docs := []T{}
+	err = cursor.All(ctx, &docs)
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+func mongoInsert(ctx context.Context, collection *mongo.Collection, id *common.ID, doc interface{}) error {
+	if id.IsZero() {
+		*id = primitive.NewObjectID()
+	}
+	_, err := collection.InsertOne(ctx, doc)
+	return err
+}
+
+type mongoAdminRepo struct {
+	collection *mongo.Collection
+}
+
+func (self *mongoAdminRepo) Add(ctx context.Context, admin *common.Admin) error {
+	return mongoInsert(ctx, self.collection, &admin.Id, admin)
+}
+
+func (self *mongoAdminRepo) FindByUsername(ctx context.Context, username string) (*common.Admin, error) {
+	return mongoFindOne[common.Admin](ctx, self.collection, bson.M{"username": username})
+}
+
+func (self *mongoAdminRepo) All(ctx context.Context) ([]common.Admin, error) {
+	return mongoFind[common.Admin](ctx, self.collection, bson.M{})
+}
+
+func (self *mongoAdminRepo) SetRole(ctx context.Context, username string, role common.AdminRole) error {
+	result, err := self.collection.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoUserRepo struct {
+	collection *mongo.Collection
+}
+
+func (self *mongoUserRepo) Add(ctx context.Context, user *common.User) error {
+	return mongoInsert(ctx, self.collection, &user.Id, user)
+}
+
+func (self *mongoUserRepo) AddMany(ctx context.Context, users []common.User) (int, error) {
+	docs := make([]interface{}, len(users))
+	for i := range users {
+		if users[i].Id.IsZero() {
+			users[i].Id = primitive.NewObjectID()
+		}
+		docs[i] = users[i]
+	}
+
+	result, err := self.collection.InsertMany(ctx, docs)
+	if err != nil {
+		return 0, err
+	}
+	return len(result.InsertedIDs), nil
+}
+
+func (self *mongoUserRepo) FindByUsername(ctx context.Context, username string) (*common.User, error) {
+	return mongoFindOne[common.User](ctx, self.collection, bson.M{"username": username})
+}
+
+func (self *mongoUserRepo) FindByBatch(ctx context.Context, batch string) ([]common.User, error) {
+	return mongoFind[common.User](ctx, self.collection, bson.M{"batch": batch})
+}
+
+func (self *mongoUserRepo) All(ctx context.Context) ([]common.User, error) {
+	return mongoFind[common.User](ctx, self.collection, bson.M{})
+}
+
+func (self *mongoUserRepo) SetPassword(ctx context.Context, id common.ID, password string) error {
+	result, err := self.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"password": password}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func userSearchFilter(search string) bson.M {
+	if search == "" {
+		return bson.M{}
+	}
+
+	// Escape special regex characters and use case-insensitive search
+	escapedSearch := regexp.QuoteMeta(search)
+	return bson.M{
+		"$or": []bson.M{
+			{"username": primitive.Regex{Pattern: escapedSearch, Options: "i"}},
+			{"batch": primitive.Regex{Pattern: escapedSearch, Options: "i"}},
+		},
+	}
+}
+
+func (self *mongoUserRepo) Count(ctx context.Context, search string) (int64, error) {
+	return self.collection.CountDocuments(ctx, userSearchFilter(search))
+}
+
+func (self *mongoUserRepo) Search(ctx context.Context, search string, skip int, limit int) ([]common.User, error) {
+	opts := options.Find().
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit)).
+		SetSort(bson.D{{Key: "username", Value: 1}})
+
+	return mongoFind[common.User](ctx, self.collection, userSearchFilter(search), opts)
+}
+
+func (self *mongoUserRepo) Delete(ctx context.Context, id common.ID) error {
+	result, err := self.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoBatchRepo struct {
+	collection *mongo.Collection
+}
+
+func (self *mongoBatchRepo) Add(ctx context.Context, batch *common.Batch) error {
+	return mongoInsert(ctx, self.collection, &batch.Id, batch)
+}
+
+func (self *mongoBatchRepo) FindByName(ctx context.Context, name string) (*common.Batch, error) {
+	return mongoFindOne[common.Batch](ctx, self.collection, bson.M{"name": name})
+}
+
+func (self *mongoBatchRepo) All(ctx context.Context) ([]common.Batch, error) {
+	return mongoFind[common.Batch](ctx, self.collection, bson.M{})
+}
+
+type mongoTestRepo struct {
+	collection *mongo.Collection
+}
+
+func (self *mongoTestRepo) Add(ctx context.Context, test *common.Test) error {
+	return mongoInsert(ctx, self.collection, &test.Id, test)
+}
+
+func (self *mongoTestRepo) FindById(ctx context.Context, id common.ID) (*common.Test, error) {
+	return mongoFindOne[common.Test](ctx, self.collection, bson.M{"_id": id})
+}
+
+func (self *mongoTestRepo) FindByIds(ctx context.Context, ids []common.ID) ([]common.Test, error) {
+	return mongoFind[common.Test](ctx, self.collection, bson.M{"_id": bson.M{"$in": ids}})
+}
+
+func (self *mongoTestRepo) All(ctx context.Context) ([]common.Test, error) {
+	return mongoFind[common.Test](ctx, self.collection, bson.M{})
+}
+
+func (self *mongoTestRepo) update(ctx context.Context, filter bson.M, set bson.M) error {
+	result, err := self.collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (self *mongoTestRepo) SetTypingText(ctx context.Context, id common.ID, typingText string) error {
+	return self.update(ctx, bson.M{"_id": id, "type": common.TypingTest}, bson.M{"typingtext": typingText})
+}
+
+func (self *mongoTestRepo) SetRubric(ctx context.Context, id common.ID, rubric []common.RubricRule) error {
+	return self.update(ctx, bson.M{"_id": id}, bson.M{"rubric": rubric})
+}
+
+type mongoSubmissionRepo struct {
+	collection *mongo.Collection
+}
+
+// a submission is stored once per ClientSubmissionId, and only one submission of an attempt
+// counts. submissions from before these fields existed are left out of the indexes
+func createSubmissionIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "clientsubmissionid", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"clientsubmissionid": bson.M{"$type": "string"}}),
+		},
+		{
+			Keys: bson.D{{Key: "username", Value: 1}, {Key: "testid", Value: 1}, {Key: "attemptid", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"superseded": false}),
+		},
+	})
+	return err
+}
+
+func (self *mongoSubmissionRepo) Add(ctx context.Context, submission *common.TestSubmission) error {
+	err := mongoInsert(ctx, self.collection, &submission.Id, submission)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (self *mongoSubmissionRepo) FindByClientId(ctx context.Context, clientSubmissionId string) (*common.TestSubmission, error) {
+	return mongoFindOne[common.TestSubmission](ctx, self.collection, bson.M{"clientsubmissionid": clientSubmissionId})
+}
+
+func (self *mongoSubmissionRepo) FindCurrent(ctx context.Context, attemptId common.ID) (*common.TestSubmission, error) {
+	return mongoFindOne[common.TestSubmission](ctx, self.collection, bson.M{"attemptid": attemptId, "superseded": bson.M{"$ne": true}})
+}
+
+func (self *mongoSubmissionRepo) FindByUser(ctx context.Context, username string, testId common.ID) ([]common.TestSubmission, error) {
+	filter := bson.M{"username": username}
+	if !testId.IsZero() {
+		filter["testid"] = testId
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "submittedat", Value: 1}})
+	return mongoFind[common.TestSubmission](ctx, self.collection, filter, opts)
+}
+
+func (self *mongoSubmissionRepo) SetSuperseded(ctx context.Context, id common.ID, superseded bool) error {
+	result, err := self.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"superseded": superseded}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoResultRepo struct {
+	collection *mongo.Collection
+}
+
+func (self *mongoResultRepo) Add(ctx context.Context, result *common.Result) error {
+	return mongoInsert(ctx, self.collection, &result.Id, result)
+}
+
+func (self *mongoResultRepo) FindByTest(ctx context.Context, testId common.ID) ([]common.Result, error) {
+	return mongoFind[common.Result](ctx, self.collection, bson.M{"testid": testId, "superseded": bson.M{"$ne": true}})
+}
+
+func (self *mongoResultRepo) SetSuperseded(ctx context.Context, submissionId common.ID, superseded bool) error {
+	_, err := self.collection.UpdateMany(ctx, bson.M{"submissionid": submissionId}, bson.M{"$set": bson.M{"superseded": superseded}})
+	return err
+}
+
+type mongoSessionRepo struct {
+	collection *mongo.Collection
+}
+
+func (self *mongoSessionRepo) Add(ctx context.Context, session *Session) error {
+	return mongoInsert(ctx, self.collection, &session.Id, session)
+}
+
+func (self *mongoSessionRepo) FindById(ctx context.Context, id common.ID) (*Session, error) {
+	return mongoFindOne[Session](ctx, self.collection, bson.M{"_id": id})
+}
+
+func (self *mongoSessionRepo) FindByRefreshHash(ctx context.Context, hash string) (*Session, error) {
+	return mongoFindOne[Session](ctx, self.collection, bson.M{"refreshhash": hash})
+}
+
+func (self *mongoSessionRepo) update(ctx context.Context, id common.ID, set bson.M) error {
+	result, err := self.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (self *mongoSessionRepo) Rotate(ctx context.Context, id common.ID, oldHash string, newHash string, expires time.Time) error {
+	filter := bson.M{"_id": id, "refreshhash": oldHash, "revoked": false}
+	result, err := self.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"refreshhash": newHash, "expiresat": expires}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+func (self *mongoSessionRepo) Revoke(ctx context.Context, id common.ID) error {
+	return self.update(ctx, id, bson.M{"revoked": true})
+}
+
+func (self *mongoSessionRepo) RevokeByUsername(ctx context.Context, audience string, username string) (int, error) {
+	filter := bson.M{"audience": audience, "username": username, "revoked": false}
+	result, err := self.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+type mongoExamSessionRepo struct {
+	collection *mongo.Collection
+}
+
+func (self *mongoExamSessionRepo) Add(ctx context.Context, session *common.ExamSession) error {
+	return mongoInsert(ctx, self.collection, &session.Id, session)
+}
+
+func (self *mongoExamSessionRepo) FindById(ctx context.Context, id common.ID) (*common.ExamSession, error) {
+	return mongoFindOne[common.ExamSession](ctx, self.collection, bson.M{"_id": id})
+}
+
+func (self *mongoExamSessionRepo) All(ctx context.Context) ([]common.ExamSession, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "startsat", Value: 1}})
+	return mongoFind[common.ExamSession](ctx, self.collection, bson.M{}, opts)
+}
+
+func (self *mongoExamSessionRepo) FindActive(ctx context.Context, batch string, at time.Time) ([]common.ExamSession, error) {
+	filter := bson.M{
+		"batch":    batch,
+		"startsat": bson.M{"$lte": at},
+		"endsat":   bson.M{"$gt": at},
+		"finished": bson.M{"$ne": true},
+	}
+	return mongoFind[common.ExamSession](ctx, self.collection, filter)
+}
+
+func (self *mongoExamSessionRepo) FindEnded(ctx context.Context, at time.Time) ([]common.ExamSession, error) {
+	filter := bson.M{
+		"endsat":   bson.M{"$lte": at},
+		"finished": bson.M{"$ne": true},
+	}
+	return mongoFind[common.ExamSession](ctx, self.collection, filter)
+}
+
+func (self *mongoExamSessionRepo) SetFinished(ctx context.Context, id common.ID) error {
+	result, err := self.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"finished": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoAttemptRepo struct {
+	collection *mongo.Collection
+}
+
+func (self *mongoAttemptRepo) Add(ctx context.Context, attempt *common.Attempt) error {
+	return mongoInsert(ctx, self.collection, &attempt.Id, attempt)
+}
+
+func (self *mongoAttemptRepo) FindLatest(ctx context.Context, username string, testId common.ID) (*common.Attempt, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "startedat", Value: -1}}).SetLimit(1)
+	attempts, err := mongoFind[common.Attempt](ctx, self.collection, bson.M{"username": username, "testid": testId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(attempts) == 0 {
+		return nil, ErrNotFound
+	}
+	return &attempts[0], nil
+}
+
+func (self *mongoAttemptRepo) FindBySession(ctx context.Context, sessionId common.ID) ([]common.Attempt, error) {
+	return mongoFind[common.Attempt](ctx, self.collection, bson.M{"sessionid": sessionId})
+}
+
+func (self *mongoAttemptRepo) FindOpen(ctx context.Context, username string) ([]common.Attempt, error) {
+	return mongoFind[common.Attempt](ctx, self.collection, bson.M{"username": username, "submittedat": time.Time{}})
+}
+
+func (self *mongoAttemptRepo) update(ctx context.Context, id common.ID, set bson.M) error {
+	result, err := self.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (self *mongoAttemptRepo) SetSubmitted(ctx context.Context, id common.ID, at time.Time, late bool) error {
+	return self.update(ctx, id, bson.M{"submittedat": at, "late": late})
+}
+
+func (self *mongoAttemptRepo) SetDeadline(ctx context.Context, id common.ID, deadline time.Time, extraMinutes int) error {
+	return self.update(ctx, id, bson.M{"deadline": deadline, "extraminutes": extraMinutes})
+}
+
+type mongoActivityRepo struct {
+	collection *mongo.Collection
+}
+
+func (self *mongoActivityRepo) Add(ctx context.Context, event *common.ActivityEvent) error {
+	return mongoInsert(ctx, self.collection, &event.Id, event)
+}
+
+func (self *mongoActivityRepo) Find(ctx context.Context, filter ActivityFilter) ([]common.ActivityEvent, error) {
+	query := bson.M{}
+	if filter.Username != "" {
+		query["username"] = filter.Username
+	}
+	if !filter.TestId.IsZero() {
+		query["testid"] = filter.TestId
+	}
+	if !filter.AttemptId.IsZero() {
+		query["attemptid"] = filter.AttemptId
+	}
+	if filter.Kind != "" {
+		query["kind"] = filter.Kind
+	}
+	at := bson.M{}
+	if !filter.Since.IsZero() {
+		at["$gte"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		at["$lt"] = filter.Until
+	}
+	if len(at) > 0 {
+		query["at"] = at
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: 1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	return mongoFind[common.ActivityEvent](ctx, self.collection, query, opts)
+}
+
+type mongoSnapshotRepo struct {
+	collection *mongo.Collection
+}
+
+func (self *mongoSnapshotRepo) Add(ctx context.Context, snapshot *common.Snapshot) error {
+	return mongoInsert(ctx, self.collection, &snapshot.Id, snapshot)
+}
+
+func (self *mongoSnapshotRepo) FindLatest(ctx context.Context, attemptId common.ID) (*common.Snapshot, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: -1}}).SetLimit(1)
+	snapshots, err := mongoFind[common.Snapshot](ctx, self.collection, bson.M{"attemptid": attemptId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, ErrNotFound
+	}
+	return &snapshots[0], nil
+}
+
+func (self *mongoSnapshotRepo) FindByUser(ctx context.Context, username string, testId common.ID) ([]common.Snapshot, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "takenat", Value: 1}})
+	return mongoFind[common.Snapshot](ctx, self.collection, bson.M{"username": username, "testid": testId}, opts)
+}
+
+func (self *mongoSnapshotRepo) FindByHash(ctx context.Context, username string, hash string) (*common.Snapshot, error) {
+	return mongoFindOne[common.Snapshot](ctx, self.collection, bson.M{"username": username, "filehash": hash})
+}
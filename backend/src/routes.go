@@ -2,11 +2,10 @@ package main
 
 import (
 	"common"
-	"context"
 	"encoding/csv"
+	"encoding/json"
 	"io"
 	"log"
-	"regexp"
 	"strings"
 
 	// "encoding/csv"
@@ -15,33 +14,25 @@ import (
 	// "log"
 	"math"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
-
 	"go.mongodb.org/mongo-driver/bson/primitive"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 func AdminRoutes(allControllers *Database, route *gin.Engine) {
 	unauthenticatedAdminRoutes := route.Group("/admin")
 
-	unauthenticatedAdminRoutes.POST("/register", func(ctx *gin.Context) {
+	// creates the first super admin. see BootstrapAdmin
+	unauthenticatedAdminRoutes.POST("/bootstrap", func(ctx *gin.Context) {
 		var adminModel common.Admin
 		if err := ctx.ShouldBindJSON(&adminModel); err != nil {
 			ctx.JSON(400, gin.H{"error": "Invalid request body"})
 			return
 		}
 
-		allControllers.AdminRegisterHandler(ctx, &adminModel)
+		allControllers.AdminBootstrapHandler(ctx, ctx.GetHeader("X-Bootstrap-Token"), &adminModel)
 	})
 
 	unauthenticatedAdminRoutes.POST("/login", func(ctx *gin.Context) {
@@ -55,8 +46,49 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 		allControllers.AdminLoginHandler(ctx, &adminModel)
 	})
 
+	unauthenticatedAdminRoutes.POST("/refresh", func(ctx *gin.Context) {
+		allControllers.AdminRefreshHandler(ctx)
+	})
+
+	unauthenticatedAdminRoutes.POST("/logout", func(ctx *gin.Context) {
+		allControllers.AdminLogoutHandler(ctx)
+	})
+
 	authenticatedAdminRoutes := route.Group("/admin")
-	authenticatedAdminRoutes.Use(AdminJWTAuthMiddleware(allControllers.AdminCollection))
+	authenticatedAdminRoutes.Use(AdminJWTAuthMiddleware(allControllers.Sessions))
+
+	adminManagerRoutes := authenticatedAdminRoutes.Group("", RequirePermission(allControllers.Admins, PermManageAdmins))
+	userManagerRoutes := authenticatedAdminRoutes.Group("", RequirePermission(allControllers.Admins, PermManageUsers))
+	batchManagerRoutes := authenticatedAdminRoutes.Group("", RequirePermission(allControllers.Admins, PermManageBatches))
+	testManagerRoutes := authenticatedAdminRoutes.Group("", RequirePermission(allControllers.Admins, PermManageTests))
+	graderRoutes := authenticatedAdminRoutes.Group("", RequirePermission(allControllers.Admins, PermGrade))
+	resultRoutes := authenticatedAdminRoutes.Group("", RequirePermission(allControllers.Admins, PermViewResults))
+	proctorRoutes := authenticatedAdminRoutes.Group("", RequirePermission(allControllers.Admins, PermProctor))
+	userViewerRoutes := authenticatedAdminRoutes.Group("", RequirePermission(allControllers.Admins, PermViewUsers))
+	sessionViewerRoutes := authenticatedAdminRoutes.Group("", RequirePermission(allControllers.Admins, PermViewSessions))
+
+	adminManagerRoutes.POST("/register", func(ctx *gin.Context) {
+		var adminModel common.Admin
+		if err := ctx.ShouldBindJSON(&adminModel); err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		allControllers.AdminRegisterHandler(ctx, &adminModel)
+	})
+
+	adminManagerRoutes.POST("/set_role", func(ctx *gin.Context) {
+		var request struct {
+			Username string           `json:"username"`
+			Role     common.AdminRole `json:"role"`
+		}
+		if err := ctx.ShouldBindJSON(&request); err != nil || request.Username == "" {
+			ctx.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		allControllers.SetAdminRoleHandler(ctx, request.Username, request.Role)
+	})
 
 	// If not authenticated, it will give 401 from the middleware
 	authenticatedAdminRoutes.GET("/auth-status", func(ctx *gin.Context) {
@@ -70,8 +102,7 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 		}
 		claims := anyclaims.(*Claims)
 
-		var adminInfo common.Admin
-		err := allControllers.AdminCollection.FindOne(context.TODO(), bson.M{"username": claims.Username}).Decode(&adminInfo)
+		adminInfo, err := allControllers.Admins.FindByUsername(ctx, claims.Username)
 		if err != nil {
 			ctx.JSON(200, gin.H{
 				"isAuthenticated": false,
@@ -81,14 +112,101 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 		}
 
 		adminInfo.Password = ""
+		adminInfo.Role = effectiveRole(adminInfo)
 
 		ctx.JSON(200, gin.H{
 			"isAuthenticated": true,
 			"adminInfo":       adminInfo,
+			"permissions":     RolePermissions(adminInfo.Role),
 		})
 	})
 
-	authenticatedAdminRoutes.POST("/add_users_from_csv", func(ctx *gin.Context) {
+	proctorRoutes.POST("/revoke_user_sessions", func(ctx *gin.Context) {
+		var request struct {
+			Username string `json:"username"`
+		}
+		if err := ctx.ShouldBindJSON(&request); err != nil || request.Username == "" {
+			ctx.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		allControllers.RevokeUserSessionsHandler(ctx, request.Username)
+	})
+
+	proctorRoutes.POST("/increase_test_time", func(ctx *gin.Context) {
+		var request struct {
+			Usernames []string `json:"usernames"`
+			Batch     string   `json:"batch"`
+			// empty for every test the candidates are taking
+			TestId  string `json:"test_id"`
+			Minutes int    `json:"minutes"`
+		}
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		var testId common.ID
+		if request.TestId != "" {
+			id, err := primitive.ObjectIDFromHex(request.TestId)
+			if err != nil {
+				ctx.JSON(400, gin.H{"error": "Invalid test id"})
+				return
+			}
+			testId = id
+		}
+
+		allControllers.IncreaseTestTimeHandler(ctx, request.Usernames, request.Batch, testId, request.Minutes)
+	})
+
+	proctorRoutes.GET("/presence", func(ctx *gin.Context) {
+		ctx.JSON(200, gin.H{"presence": allControllers.Presence.Snapshot()})
+	})
+
+	// server sent events. a "presence" event with the state of every known candidate first,
+	// then one whenever a candidate's state changes
+	proctorRoutes.GET("/presence/stream", func(ctx *gin.Context) {
+		updates, unsubscribe := allControllers.Presence.Subscribe()
+		defer unsubscribe()
+
+		ctx.Header("Cache-Control", "no-cache")
+		for _, presence := range allControllers.Presence.Snapshot() {
+			ctx.SSEvent("presence", presence)
+		}
+		ctx.Writer.Flush()
+
+		ctx.Stream(func(w io.Writer) bool {
+			select {
+			case <-ctx.Request.Context().Done():
+				return false
+			case presence, ok := <-updates:
+				if !ok {
+					return false
+				}
+				ctx.SSEvent("presence", presence)
+				return true
+			}
+		})
+	})
+
+	proctorRoutes.POST("/notify_users", func(ctx *gin.Context) {
+		var request struct {
+			Usernames []string `json:"usernames"`
+			Batch     string   `json:"batch"`
+			Everyone  bool     `json:"everyone"`
+			Message   string   `json:"message"`
+			// shown as a warning instead of a notification
+			Warn bool `json:"warn"`
+		}
+		if err := ctx.ShouldBindJSON(&request); err != nil || request.Message == "" {
+			ctx.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		allControllers.NotifyUsersHandler(ctx, request.Usernames, request.Batch, request.Everyone, request.Message, request.Warn)
+	})
+
+	userManagerRoutes.POST("/add_users_from_csv", func(ctx *gin.Context) {
 		file, _, err := ctx.Request.FormFile("file")
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "File upload failed"})
@@ -120,7 +238,6 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 			}
 
 			user := common.User{
-				Id:       primitive.NewObjectID(),
 				Username: record[0],
 				Password: record[1],
 				Batch:    record[3],
@@ -128,23 +245,144 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 			users = append(users, user)
 		}
 
-		userInterfaces := make([]interface{}, len(users))
-		for i, u := range users {
-			userInterfaces[i] = u
+		if err := HashUserPasswords(users); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash passwords"})
+			return
 		}
 
-		insertedResult, err := allControllers.UserCollection.InsertMany(context.Background(), userInterfaces)
+		inserted, err := allControllers.Users.AddMany(ctx, users)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert users"})
 			return
 		}
 
 		ctx.JSON(http.StatusOK, gin.H{
-			"message": fmt.Sprintf("Successfully added %d users", len(insertedResult.InsertedIDs)),
+			"message": fmt.Sprintf("Successfully added %d users", inserted),
 		})
 	})
 
-	authenticatedAdminRoutes.POST("/add_batch", func(ctx *gin.Context) {
+	batchManagerRoutes.POST("/add_session", func(ctx *gin.Context) {
+		var session common.ExamSession
+		if err := ctx.ShouldBindJSON(&session); err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		allControllers.AddExamSessionHandler(ctx, &session)
+	})
+
+	sessionViewerRoutes.GET("/sessions", func(ctx *gin.Context) {
+		sessions, err := allControllers.Exams.All(ctx)
+		if err != nil {
+			ctx.JSON(500, gin.H{"message": "Error fetching sessions", "error": err.Error()})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"sessions": sessions})
+	})
+
+	sessionViewerRoutes.GET("/sessions/:session_id/attempts", func(ctx *gin.Context) {
+		sessionId, err := primitive.ObjectIDFromHex(ctx.Param("session_id"))
+		if err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid session ID format"})
+			return
+		}
+
+		attempts, err := allControllers.Attempts.FindBySession(ctx, sessionId)
+		if err != nil {
+			ctx.JSON(500, gin.H{"message": "Error fetching attempts", "error": err.Error()})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"attempts": attempts})
+	})
+
+	proctorRoutes.POST("/sessions/:session_id/finish", func(ctx *gin.Context) {
+		sessionId, err := primitive.ObjectIDFromHex(ctx.Param("session_id"))
+		if err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid session ID format"})
+			return
+		}
+
+		allControllers.FinishSessionHandler(ctx, sessionId)
+	})
+
+	// every uploaded version of a candidate's document for a test, oldest first
+	proctorRoutes.GET("/snapshots", func(ctx *gin.Context) {
+		username := ctx.Query("username")
+		testId, err := primitive.ObjectIDFromHex(ctx.Query("test_id"))
+		if username == "" || err != nil {
+			ctx.JSON(400, gin.H{"error": "username and test_id are required"})
+			return
+		}
+
+		allControllers.SnapshotsHandler(ctx, username, testId)
+	})
+
+	// hands the latest snapshot of a running test to the candidate's app, e.g. after they
+	// moved to a replacement machine
+	proctorRoutes.POST("/restore_snapshot", func(ctx *gin.Context) {
+		var request struct {
+			Username string `json:"username"`
+			TestId   string `json:"test_id"`
+		}
+		if err := ctx.ShouldBindJSON(&request); err != nil || request.Username == "" {
+			ctx.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+		testId, err := primitive.ObjectIDFromHex(request.TestId)
+		if err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid test id"})
+			return
+		}
+
+		allControllers.RestoreSnapshotHandler(ctx, request.Username, testId)
+	})
+
+	// what candidates did during their exams, oldest first. every query parameter is optional:
+	// username, test_id, attempt_id, kind, since and until (RFC 3339) and limit
+	userViewerRoutes.GET("/activity", func(ctx *gin.Context) {
+		filter := ActivityFilter{
+			Username: ctx.Query("username"),
+			Kind:     common.ActivityKind(ctx.Query("kind")),
+		}
+
+		var err error
+		if id := ctx.Query("test_id"); id != "" {
+			if filter.TestId, err = primitive.ObjectIDFromHex(id); err != nil {
+				ctx.JSON(400, gin.H{"error": "Invalid test id"})
+				return
+			}
+		}
+		if id := ctx.Query("attempt_id"); id != "" {
+			if filter.AttemptId, err = primitive.ObjectIDFromHex(id); err != nil {
+				ctx.JSON(400, gin.H{"error": "Invalid attempt id"})
+				return
+			}
+		}
+		if since := ctx.Query("since"); since != "" {
+			if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+				ctx.JSON(400, gin.H{"error": "Invalid since time"})
+				return
+			}
+		}
+		if until := ctx.Query("until"); until != "" {
+			if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+				ctx.JSON(400, gin.H{"error": "Invalid until time"})
+				return
+			}
+		}
+		if limit := ctx.Query("limit"); limit != "" {
+			if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+				ctx.JSON(400, gin.H{"error": "Invalid limit"})
+				return
+			}
+		}
+
+		allControllers.ActivityHandler(ctx, filter)
+	})
+
+	batchManagerRoutes.POST("/add_batch", func(ctx *gin.Context) {
 		var batchData struct {
 			BatchName     string   `json:"batchName"`
 			SelectedTests []string `json:"selectedTests"`
@@ -176,7 +414,7 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 		ctx.JSON(200, gin.H{"message": "Batch added successfully", "batch": newBatch})
 	})
 
-	authenticatedAdminRoutes.POST("/add_test", func(ctx *gin.Context) {
+	testManagerRoutes.POST("/add_test", func(ctx *gin.Context) {
 
 		if err := ctx.Request.ParseMultipartForm(10 << 20); err != nil {
 			ctx.JSON(400, gin.H{"error": "File too large"})
@@ -210,10 +448,34 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 			Duration: durationInt,
 		}
 
+		switch policy := common.SubmissionPolicy(ctx.Request.FormValue("submissionPolicy")); policy {
+		case "", common.SubmitOnce, common.SubmitLastWins, common.SubmitMultiple:
+			testModel.SubmissionPolicy = policy
+		default:
+			ctx.JSON(400, gin.H{"error": "Invalid submission policy"})
+			return
+		}
+		if maxAttempts := ctx.Request.FormValue("maxAttempts"); maxAttempts != "" {
+			testModel.MaxAttempts, err = strconv.Atoi(maxAttempts)
+			if err != nil || testModel.MaxAttempts < 0 {
+				ctx.JSON(400, gin.H{"error": "Invalid max attempts"})
+				return
+			}
+		}
+
 		if testType == string(common.TypingTest) {
 			testModel.TypingText = typingText
 
 		} else if testType == string(common.MCQTest) {
+			negativeMarks := ctx.Request.FormValue("negativeMarks")
+			if negativeMarks != "" {
+				testModel.NegativeMarks, err = strconv.ParseFloat(negativeMarks, 64)
+				if err != nil {
+					ctx.JSON(400, gin.H{"error": "Invalid negative marks"})
+					return
+				}
+			}
+
 			file, _, err := ctx.Request.FormFile("file")
 			if err != nil {
 
@@ -235,7 +497,8 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 					return
 				}
 
-				if len(record) != 6 {
+				// question, 4 options, answer and optionally the marks for the question
+				if len(record) != 6 && len(record) != 7 {
 					ctx.JSON(400, gin.H{"error": "Invalid CSV format"})
 					return
 				}
@@ -245,6 +508,18 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 					Options:  record[1:5],
 					Answer:   record[5],
 				}
+				if len(record) == 7 && strings.TrimSpace(record[6]) != "" {
+					marks, err := strconv.ParseFloat(strings.TrimSpace(record[6]), 64)
+					if err != nil {
+						ctx.JSON(400, gin.H{"error": "Invalid marks in CSV file"})
+						return
+					}
+					mcq.Marks = marks
+				}
+				if _, err := McqAnswerIndex(&mcq); err != nil {
+					ctx.JSON(400, gin.H{"error": fmt.Sprintf("Invalid answer in CSV file: %v", err)})
+					return
+				}
 				mcqQuestions = append(mcqQuestions, mcq)
 			}
 
@@ -255,7 +530,19 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 			}
 
 		} else {
-			file, header, err := ctx.Request.FormFile("file")
+			rubric := ctx.Request.FormValue("rubric")
+			if rubric != "" {
+				if err := json.Unmarshal([]byte(rubric), &testModel.Rubric); err != nil {
+					ctx.JSON(400, gin.H{"error": "Invalid rubric"})
+					return
+				}
+				if err := ValidateRubric(testModel.Type, testModel.Rubric); err != nil {
+					ctx.JSON(400, gin.H{"error": err.Error()})
+					return
+				}
+			}
+
+			file, _, err := ctx.Request.FormFile("file")
 			if err != nil {
 				if err == http.ErrMissingFile {
 
@@ -268,34 +555,14 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 			if file != nil {
 				defer file.Close()
 
-				sess, err := session.NewSession(&aws.Config{
-					Region: aws.String("ap-south-1"),
-					Credentials: credentials.NewStaticCredentials(
-						os.Getenv("AWS_S3_ACCESS_KEY"),
-						os.Getenv("AWS_S3_ACCESS_KEY_SECRET"),
-						"",
-					),
-				})
+				hash, err := allControllers.Storage.Put(ctx, file)
 				if err != nil {
-					ctx.JSON(500, gin.H{"error": "Failed to create AWS session"})
+					log.Printf("error storing test file: %v", err)
+					ctx.JSON(500, gin.H{"error": "Failed to store file"})
 					return
 				}
 
-				uploader := s3manager.NewUploader(sess)
-
-				filename := filepath.Base(header.Filename)
-				result, err := uploader.Upload(&s3manager.UploadInput{
-					Bucket: aws.String("collegeprojectbucket"),
-					Key:    aws.String(filename),
-					Body:   file,
-				})
-
-				if err != nil {
-					ctx.JSON(500, gin.H{"error": "Failed to upload file to S3"})
-					return
-				}
-
-				testModel.FilePath = result.Location
+				testModel.FileHash = hash
 			}
 		}
 
@@ -304,6 +571,56 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 		ctx.JSON(200, gin.H{"message": "Test added successfully", "test": testModel})
 	})
 
+	graderRoutes.POST("/set_rubric", func(ctx *gin.Context) {
+		var rubricRequest struct {
+			TestId string              `json:"testId"`
+			Rubric []common.RubricRule `json:"rubric"`
+		}
+
+		if err := ctx.ShouldBindJSON(&rubricRequest); err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		allControllers.SetTestRubric(ctx, rubricRequest.TestId, rubricRequest.Rubric)
+	})
+
+	resultRoutes.GET("/results/:test_id", func(ctx *gin.Context) {
+		results, err := allControllers.GetResultsByTest(ctx, ctx.Param("test_id"))
+		if err != nil {
+			ctx.JSON(500, gin.H{
+				"message": "Error while fetching results",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(200, gin.H{
+			"message": "Results fetched successfully",
+			"results": results,
+		})
+	})
+
+	// every submission of a candidate, including the ones later ones replaced. test_id is optional
+	resultRoutes.GET("/submissions", func(ctx *gin.Context) {
+		username := ctx.Query("username")
+		if username == "" {
+			ctx.JSON(400, gin.H{"error": "username is required"})
+			return
+		}
+		var testId common.ID
+		if ctx.Query("test_id") != "" {
+			var err error
+			testId, err = primitive.ObjectIDFromHex(ctx.Query("test_id"))
+			if err != nil {
+				ctx.JSON(400, gin.H{"error": "Invalid test ID format"})
+				return
+			}
+		}
+
+		allControllers.SubmissionsHandler(ctx, username, testId)
+	})
+
 	// authenticatedAdminRoutes.POST("/update_user_data", func(ctx *gin.Context) {
 	// 	var userUpdateRequest common.UserUpdateRequest
 
@@ -316,26 +633,6 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 
 	// })
 
-	// authenticatedAdminRoutes.POST("/increase_test_time", func(ctx *gin.Context) {
-	// 	var requestData struct {
-	// 		Param          string   `json:"param"`
-	// 		Username       []string `json:"username"`
-	// 		TimeToIncrease int64    `json:"time_to_increase"`
-	// 	}
-
-	// 	// Bind JSON body to requestData struct
-	// 	if err := ctx.ShouldBindJSON(&requestData); err != nil {
-	// 		ctx.JSON(400, gin.H{
-	// 			"message": "Invalid request body",
-	// 			"error":   err.Error(),
-	// 		})
-	// 		return
-	// 	}
-
-	// 	allControllers.Increase_Time(ctx, requestData.Param, requestData.Username, requestData.TimeToIncrease)
-
-	// })
-
 	// authenticatedAdminRoutes.POST("/get_batchwise_data", func(ctx *gin.Context) {
 	// 	var batchData struct {
 	// 		Param       string `json:"param"`
@@ -373,7 +670,7 @@ func AdminRoutes(allControllers *Database, route *gin.Engine) {
 	// 	}, userRequest.Username)
 	// })
 
-	authenticatedAdminRoutes.POST("/update_typing_test_text", func(ctx *gin.Context) {
+	testManagerRoutes.POST("/update_typing_test_text", func(ctx *gin.Context) {
 		var UpdateTypingTestTextRequest struct {
 			TypingTestText string `json:"typingTestText"`
 			TestPassword   string `json:"testPassword"`
@@ -394,14 +691,48 @@ func InitAuthRoutes(db *Database, route *gin.Engine) {
 	UserRoutes(db, route)
 	BatchRoutes(db, route)
 	TestRoutes(db, route)
+	StorageRoutes(db, route)
+}
+
+func StorageRoutes(allControllers *Database, route *gin.Engine) {
+	// candidates can fetch the files of their batch's tests and their own snapshots
+	candidateStorageRoute := route.Group("/storage")
+	candidateStorageRoute.Use(UserJWTAuthMiddleware(allControllers.Users, allControllers.Sessions))
+
+	candidateStorageRoute.GET("/:hash", func(ctx *gin.Context) {
+		claims := ctx.MustGet("claims").(*Claims)
+		allowed, err := allControllers.CandidateMayRead(ctx, claims.Username, ctx.Param("hash"))
+		if err != nil {
+			ctx.JSON(500, gin.H{"message": "Error checking file access", "error": err.Error()})
+			return
+		}
+		if !allowed {
+			ctx.JSON(404, gin.H{"error": "File not found"})
+			return
+		}
+
+		allControllers.BlobHandler(ctx, ctx.Param("hash"))
+	})
+
+	// admins fetch submitted files and snapshots
+	adminStorageRoute := route.Group("/admin/storage")
+	adminStorageRoute.Use(AdminJWTAuthMiddleware(allControllers.Sessions))
+	adminStorageRoute.Use(RequireAnyPermission(allControllers.Admins, PermViewTests, PermViewResults, PermProctor))
+
+	adminStorageRoute.GET("/:hash", func(ctx *gin.Context) {
+		allControllers.BlobHandler(ctx, ctx.Param("hash"))
+	})
 }
 
 func BatchRoutes(allControllers *Database, route *gin.Engine) {
-	batchRoute := route.Group("/batch")
+	// the admin panel lists batches, e.g. to pick the candidates of a notification
+	adminBatchRoutes := route.Group("/batch")
+	adminBatchRoutes.Use(AdminJWTAuthMiddleware(allControllers.Sessions))
+	adminBatchRoutes.Use(RequirePermission(allControllers.Admins, PermViewBatches))
 	authenticatedBatchRoutes := route.Group("/batch")
-	authenticatedBatchRoutes.Use(UserJWTAuthMiddleware(allControllers.UserCollection))
+	authenticatedBatchRoutes.Use(UserJWTAuthMiddleware(allControllers.Users, allControllers.Sessions))
 
-	batchRoute.GET("/get_batches", func(ctx *gin.Context) {
+	adminBatchRoutes.GET("/get_batches", func(ctx *gin.Context) {
 		allControllers.GetBatches(ctx)
 	})
 
@@ -409,11 +740,16 @@ func BatchRoutes(allControllers *Database, route *gin.Engine) {
 		batch_name := ctx.Param("batch_name")
 		log.Println(batch_name)
 
-		tests, err := allControllers.GetQuestionPaperHandler(ctx, batch_name)
+		claims := ctx.MustGet("claims").(*Claims)
+		tests, err := allControllers.GetQuestionPaperHandler(ctx, claims.Username, batch_name)
 		if err != nil {
+			if err == ErrOtherBatch {
+				ctx.JSON(403, gin.H{"error": err.Error()})
+				return
+			}
 			ctx.JSON(500, gin.H{
 				"message": "Error while fetching question paper",
-				"error":   err,
+				"error":   err.Error(),
 			})
 			return
 		}
@@ -425,18 +761,23 @@ func BatchRoutes(allControllers *Database, route *gin.Engine) {
 func TestRoutes(allControllers *Database, route *gin.Engine) {
 	unauthenticatedTestRoute := route.Group("/test")
 	authenticatedTestRoute := route.Group("/test")
-	authenticatedTestRoute.Use(UserJWTAuthMiddleware(allControllers.UserCollection))
+	authenticatedTestRoute.Use(UserJWTAuthMiddleware(allControllers.Users, allControllers.Sessions))
 
 	authenticatedTestRoute.GET("/get_question_paper/:batch_name", func(ctx *gin.Context) {
 
 		batch_name := ctx.Param("batch_name")
 		log.Println(batch_name)
 
-		questionPaper, err := allControllers.GetQuestionPaperHandler(ctx, batch_name)
+		claims := ctx.MustGet("claims").(*Claims)
+		questionPaper, err := allControllers.GetQuestionPaperHandler(ctx, claims.Username, batch_name)
 		if err != nil {
+			if err == ErrOtherBatch {
+				ctx.JSON(403, gin.H{"error": err.Error()})
+				return
+			}
 			ctx.JSON(500, gin.H{
 				"message": "Error while fetching question paper",
-				"error":   err,
+				"error":   err.Error(),
 			})
 			return
 		}
@@ -446,23 +787,35 @@ func TestRoutes(allControllers *Database, route *gin.Engine) {
 			"questionPaper": questionPaper,
 		})
 	})
-	authenticatedTestRoute.POST("/submit", func(ctx *gin.Context) {
-		var submission common.TestSubmission
-		if err := ctx.ShouldBindJSON(&submission); err != nil {
-			ctx.JSON(500, gin.H{"error": "Invalid request body"})
-			return
-		}
+	// starts the server side clock for a test. the response says how much time is left
+	authenticatedTestRoute.POST("/start/:test_id", func(ctx *gin.Context) {
+		claims := ctx.MustGet("claims").(*Claims)
+		allControllers.StartTestHandler(ctx, claims.Username, ctx.Param("test_id"))
+	})
 
-		_, err := allControllers.SubmissionCollection.InsertOne(context.TODO(), submission)
-		if err != nil {
-			ctx.JSON(500, gin.H{
-				"message": "Error while inserting submission data",
-				"error":   err,
-			})
-			return
-		}
+	// how much time is left for a test, without starting it
+	authenticatedTestRoute.GET("/status/:test_id", func(ctx *gin.Context) {
+		claims := ctx.MustGet("claims").(*Claims)
+		allControllers.AttemptStatusHandler(ctx, claims.Username, ctx.Param("test_id"))
+	})
+
+	// the app uploads the document of an office test every now and then while it runs. the
+	// body is the file
+	authenticatedTestRoute.POST("/snapshot/:test_id", func(ctx *gin.Context) {
+		claims := ctx.MustGet("claims").(*Claims)
+		allControllers.SnapshotHandler(ctx, claims.Username, ctx.Param("test_id"))
+	})
+
+	// the latest snapshot of the candidate's running attempt, to continue with it
+	authenticatedTestRoute.GET("/snapshot/:test_id", func(ctx *gin.Context) {
+		claims := ctx.MustGet("claims").(*Claims)
+		allControllers.LatestSnapshotHandler(ctx, claims.Username, ctx.Param("test_id"))
+	})
 
-		ctx.Status(200)
+	// the candidate comes from the token, whatever UserId the body has
+	authenticatedTestRoute.POST("/submit", func(ctx *gin.Context) {
+		claims := ctx.MustGet("claims").(*Claims)
+		allControllers.SubmitTestHandler(ctx, claims.Username)
 	})
 
 	unauthenticatedTestRoute.GET("/test_types", func(ctx *gin.Context) {
@@ -480,7 +833,11 @@ func TestRoutes(allControllers *Database, route *gin.Engine) {
 		})
 	})
 
-	unauthenticatedTestRoute.GET("/get_all_tests", func(ctx *gin.Context) {
+	// full tests, answers included. admins only
+	adminTestRoute := route.Group("/test")
+	adminTestRoute.Use(AdminJWTAuthMiddleware(allControllers.Sessions), RequirePermission(allControllers.Admins, PermViewTests))
+
+	adminTestRoute.GET("/get_all_tests", func(ctx *gin.Context) {
 		tests, err := allControllers.GetAllTests(ctx)
 		if err != nil {
 			ctx.JSON(500, gin.H{
@@ -510,47 +867,46 @@ func UserRoutes(allControllers *Database, route *gin.Engine) {
 		allControllers.UserLoginHandler(ctx, &userModel)
 	})
 
+	userRoute.POST("/refresh", func(ctx *gin.Context) {
+		var request common.UserRefreshRequest
+		if err := ctx.ShouldBindJSON(&request); err != nil || request.RefreshToken == "" {
+			ctx.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		allControllers.UserRefreshHandler(ctx, &request)
+	})
+
+	userRoute.POST("/logout", UserJWTAuthMiddleware(allControllers.Users, allControllers.Sessions), func(ctx *gin.Context) {
+		claims := ctx.MustGet("claims").(*Claims)
+		allControllers.UserLogoutHandler(ctx, claims)
+	})
+
 	authenticated := userRoute.Group("/")
 
-	authenticated.Use(AdminJWTAuthMiddleware(allControllers.UserCollection))
+	authenticated.Use(AdminJWTAuthMiddleware(allControllers.Sessions))
 
-	authenticated.GET("/get_all_users", func(ctx *gin.Context) {
-		var users []common.User
-		cursor, err := allControllers.UserCollection.Find(context.Background(), bson.M{})
+	userViewerRoutes := authenticated.Group("", RequirePermission(allControllers.Admins, PermViewUsers))
+	userManagerRoutes := authenticated.Group("", RequirePermission(allControllers.Admins, PermManageUsers))
+
+	userViewerRoutes.GET("/get_all_users", func(ctx *gin.Context) {
+		users, err := allControllers.Users.All(ctx)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
 			return
 		}
-		defer cursor.Close(context.Background())
-
-		if err = cursor.All(context.Background(), &users); err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode users"})
-			return
-		}
 
 		ctx.JSON(http.StatusOK, gin.H{"users": users})
 	})
 
-	authenticated.GET("/paginated_users", func(ctx *gin.Context) {
+	userViewerRoutes.GET("/paginated_users", func(ctx *gin.Context) {
 		page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
 		limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
 		search := strings.TrimSpace(ctx.Query("search"))
 
 		fmt.Printf("Received request - Page: %d, Limit: %d, Search: %s\n", page, limit, search)
 
-		filter := bson.M{}
-		if search != "" {
-			// Escape special regex characters and use case-insensitive search
-			escapedSearch := regexp.QuoteMeta(search)
-			filter = bson.M{
-				"$or": []bson.M{
-					{"username": primitive.Regex{Pattern: escapedSearch, Options: "i"}},
-					{"batch": primitive.Regex{Pattern: escapedSearch, Options: "i"}},
-				},
-			}
-		}
-
-		totalUsers, err := allControllers.UserCollection.CountDocuments(context.Background(), filter)
+		totalUsers, err := allControllers.Users.Count(ctx, search)
 		if err != nil {
 			fmt.Printf("Error counting users: %v\n", err)
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count total users"})
@@ -567,25 +923,12 @@ func UserRoutes(allControllers *Database, route *gin.Engine) {
 
 		skip := (page - 1) * limit
 
-		opts := options.Find().
-			SetSkip(int64(skip)).
-			SetLimit(int64(limit)).
-			SetSort(bson.D{{Key: "username", Value: 1}})
-
-		var users []common.User
-		cursor, err := allControllers.UserCollection.Find(context.Background(), filter, opts)
+		users, err := allControllers.Users.Search(ctx, search, skip, limit)
 		if err != nil {
 			fmt.Printf("Error fetching users: %v\n", err)
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
 			return
 		}
-		defer cursor.Close(context.Background())
-
-		if err = cursor.All(context.Background(), &users); err != nil {
-			fmt.Printf("Error decoding users: %v\n", err)
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode users"})
-			return
-		}
 
 		ctx.JSON(http.StatusOK, gin.H{
 			"users":       users,
@@ -618,7 +961,7 @@ func UserRoutes(allControllers *Database, route *gin.Engine) {
 	// 	})
 	// })
 
-	userRoute.DELETE("/delete_user", func(ctx *gin.Context) {
+	userManagerRoutes.DELETE("/delete_user", func(ctx *gin.Context) {
 		var deleteRequest struct {
 			UserId string `json:"userId"`
 		}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"common"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// login session behind a refresh token. access tokens carry the session id, so
+// revoking a session locks out its access tokens right away instead of when they expire
+type Session struct {
+	Id       common.ID `bson:"_id,omitempty"`
+	Username string
+	// audience of the keys the session's tokens are signed with (candidate or admin)
+	Audience string
+	// sha256 of the current refresh token. the token itself is never stored
+	RefreshHash string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	Revoked     bool
+}
+
+var ErrSessionRevoked = errors.New("session has been revoked or has expired")
+
+// ACCESS_TOKEN_TTL (default 15m) and REFRESH_TOKEN_TTL (default 12h)
+func accessTokenTTL() time.Duration {
+	return getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+func refreshTokenTTL() time.Duration {
+	return getEnvDuration("REFRESH_TOKEN_TTL", 12*time.Hour)
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func (self *Session) active() bool {
+	return !self.Revoked && time.Now().Before(self.ExpiresAt)
+}
+
+func issueAccessToken(keys *KeySet, session *Session) (string, error) {
+	return keys.Sign(&Claims{Username: session.Username, SessionId: session.Id.Hex()}, accessTokenTTL())
+}
+
+// starts a new session and returns its access and refresh tokens
+func StartSession(ctx context.Context, sessions SessionRepository, keys *KeySet, username string) (string, string, error) {
+	refresh, err := newRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	session := &Session{
+		Username:    username,
+		Audience:    keys.audience,
+		RefreshHash: hashRefreshToken(refresh),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(refreshTokenTTL()),
+	}
+	err = sessions.Add(ctx, session)
+	if err != nil {
+		return "", "", fmt.Errorf("error creating session: %v", err)
+	}
+
+	access, err := issueAccessToken(keys, session)
+	if err != nil {
+		return "", "", err
+	}
+	return access, refresh, nil
+}
+
+// trades a refresh token for a new access token and a new refresh token. the old refresh
+// token stops working
+func RefreshSession(ctx context.Context, sessions SessionRepository, keys *KeySet, refresh string) (string, string, *Session, error) {
+	session, err := sessions.FindByRefreshHash(ctx, hashRefreshToken(refresh))
+	if err == ErrNotFound {
+		return "", "", nil, ErrSessionRevoked
+	}
+	if err != nil {
+		return "", "", nil, err
+	}
+	if session.Audience != keys.audience || !session.active() {
+		return "", "", nil, ErrSessionRevoked
+	}
+
+	newRefresh, err := newRefreshToken()
+	if err != nil {
+		return "", "", nil, err
+	}
+	oldHash := session.RefreshHash
+	session.RefreshHash = hashRefreshToken(newRefresh)
+	session.ExpiresAt = time.Now().Add(refreshTokenTTL())
+	// a concurrent refresh with the same token may have won. only one of them gets tokens
+	err = sessions.Rotate(ctx, session.Id, oldHash, session.RefreshHash, session.ExpiresAt)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	access, err := issueAccessToken(keys, session)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return access, newRefresh, session, nil
+}
+
+// checks that the session an access token belongs to is still alive
+func CheckSession(ctx context.Context, sessions SessionRepository, claims *Claims) error {
+	id, err := primitive.ObjectIDFromHex(claims.SessionId)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+	session, err := sessions.FindById(ctx, id)
+	if err == ErrNotFound {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if !session.active() || session.Username != claims.Username {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+func RevokeSession(ctx context.Context, sessions SessionRepository, claims *Claims) error {
+	id, err := primitive.ObjectIDFromHex(claims.SessionId)
+	if err != nil {
+		return fmt.Errorf("invalid session id")
+	}
+	return sessions.Revoke(ctx, id)
+}
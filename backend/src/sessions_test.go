@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testSessions(t *testing.T) SessionRepository {
+	t.Helper()
+	repos, err := NewBoltRepositories(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repos.Sessions
+}
+
+func TestRefreshSession(t *testing.T) {
+	ctx := context.Background()
+	sessions := testSessions(t)
+	keys := mustKeySet(t, userAudience, "k1=secret")
+
+	_, refresh, err := StartSession(ctx, sessions, keys, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, next, session, err := RefreshSession(ctx, sessions, keys, refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Username != "alice" || next == refresh {
+		t.Fatalf("refreshed session of '%s', new token %v", session.Username, next != refresh)
+	}
+	if _, err := keys.Verify(access); err != nil {
+		t.Fatalf("new access token: %v", err)
+	}
+
+	// the old refresh token is used up, the new one works
+	if _, _, _, err := RefreshSession(ctx, sessions, keys, refresh); err != ErrSessionRevoked {
+		t.Fatalf("reused refresh token: got %v, want ErrSessionRevoked", err)
+	}
+	if _, _, _, err := RefreshSession(ctx, sessions, keys, next); err != nil {
+		t.Fatalf("new refresh token: %v", err)
+	}
+}
+
+func TestRefreshSessionConcurrently(t *testing.T) {
+	ctx := context.Background()
+	sessions := testSessions(t)
+	keys := mustKeySet(t, userAudience, "k1=secret")
+
+	_, refresh, err := StartSession(ctx, sessions, keys, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const tries = 8
+	errs := make([]error, tries)
+	var wg sync.WaitGroup
+	for i := 0; i < tries; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, _, errs[i] = RefreshSession(ctx, sessions, keys, refresh)
+		}(i)
+	}
+	wg.Wait()
+
+	refreshed := 0
+	for _, err := range errs {
+		switch err {
+		case nil:
+			refreshed++
+		case ErrSessionRevoked:
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	if refreshed != 1 {
+		t.Fatalf("refresh token was used %d times, want once", refreshed)
+	}
+}
+
+func TestSessionRotate(t *testing.T) {
+	ctx := context.Background()
+	sessions := testSessions(t)
+
+	session := &Session{Username: "alice", Audience: userAudience, RefreshHash: "old", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := sessions.Add(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(2 * time.Hour)
+
+	if err := sessions.Rotate(ctx, session.Id, "other", "new", expires); err != ErrSessionRevoked {
+		t.Errorf("wrong old hash: got %v, want ErrSessionRevoked", err)
+	}
+	if err := sessions.Rotate(ctx, session.Id, "old", "new", expires); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if err := sessions.Rotate(ctx, session.Id, "old", "newer", expires); err != ErrSessionRevoked {
+		t.Errorf("rotate twice: got %v, want ErrSessionRevoked", err)
+	}
+
+	if err := sessions.Revoke(ctx, session.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := sessions.Rotate(ctx, session.Id, "new", "newer", expires); err != ErrSessionRevoked {
+		t.Errorf("revoked session: got %v, want ErrSessionRevoked", err)
+	}
+}
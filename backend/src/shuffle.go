@@ -0,0 +1,102 @@
+package main
+
+import (
+	"common"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+)
+
+// every candidate sees the questions of an mcq test, and the options of every question, in
+// an order of their own, so copying from a neighbour by position does not work. the order
+// only depends on the candidate and the test. a paper fetched before the attempt started or
+// again after a restart is the same one the answers are mapped back with
+type mcqOrder struct {
+	// the i-th question the candidate sees is questions[i] of the test
+	questions []int
+	// the j-th option the candidate sees for question q of the test is options[q][j]
+	options [][]int
+}
+
+func newMcqOrder(username string, testId common.ID, questions []common.MCQ) *mcqOrder {
+	sum := sha256.Sum256([]byte(username + "/" + testId.Hex()))
+	rng := rand.NewPCG(binary.LittleEndian.Uint64(sum[0:8]), binary.LittleEndian.Uint64(sum[8:16]))
+
+	order := &mcqOrder{
+		questions: permutation(rng, len(questions)),
+		options:   make([][]int, len(questions)),
+	}
+	for q, question := range questions {
+		order.options[q] = permutation(rng, len(question.Options))
+	}
+	return order
+}
+
+// fisher-yates on the raw generator output. the shuffle helpers of math/rand may change
+// between go versions, which would change papers that are out already
+func permutation(rng *rand.PCG, n int) []int {
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		j := int(rng.Uint64() % uint64(i+1))
+		perm[i], perm[j] = perm[j], perm[i]
+	}
+	return perm
+}
+
+// the questions of an mcq test as the candidate sees them, in the format of CandidateTest.McqJson
+func shuffledMcqJson(username string, test *common.Test) (string, error) {
+	questions, err := test.GetMCQQuestions()
+	if err != nil {
+		return "", err
+	}
+	order := newMcqOrder(username, test.Id, questions)
+
+	candidateQuestions := make([]common.CandidateMCQ, len(questions))
+	for i, q := range order.questions {
+		options := make([]string, len(questions[q].Options))
+		for j, o := range order.options[q] {
+			options[j] = questions[q].Options[o]
+		}
+		candidateQuestions[i] = common.CandidateMCQ{
+			Question: questions[q].Question,
+			Options:  options,
+		}
+	}
+
+	jsonData, err := json.Marshal(candidateQuestions)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonData), nil
+}
+
+// turns the answers of a candidate, given by position in their shuffled paper, into option
+// indices of the test's own questions. submissions are stored, graded and exported like this
+func canonicalMcqAnswers(username string, test *common.Test, info *common.McqTestInfo) error {
+	questions, err := test.GetMCQQuestions()
+	if err != nil {
+		return fmt.Errorf("error decoding mcq questions: %v", err)
+	}
+	order := newMcqOrder(username, test.Id, questions)
+
+	answers := make([]*int, len(questions))
+	for i, answer := range info.Answers {
+		if i >= len(order.questions) || answer == nil {
+			continue
+		}
+		q := order.questions[i]
+		canonical := *answer
+		// an index that is not an option stays as it is, it is graded as wrong anyway
+		if canonical >= 0 && canonical < len(order.options[q]) {
+			canonical = order.options[q][canonical]
+		}
+		answers[q] = &canonical
+	}
+	info.Answers = answers
+	return nil
+}
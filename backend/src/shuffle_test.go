@@ -0,0 +1,139 @@
+package main
+
+import (
+	"common"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// a test with enough questions and options that two candidates hardly ever get the same order
+func shuffleTest(t *testing.T) *common.Test {
+	t.Helper()
+	questions := []common.MCQ{}
+	for i := 0; i < 8; i++ {
+		options := []string{}
+		for j := 0; j < 5; j++ {
+			options = append(options, fmt.Sprintf("q%d option %d", i, j))
+		}
+		questions = append(questions, common.MCQ{
+			Question: fmt.Sprintf("question %d", i),
+			Options:  options,
+			Answer:   options[i%5],
+			Marks:    float64(i%3 + 1),
+		})
+	}
+	test := mcqTest(t, 0.5, questions...)
+	// fixed, so the orders below do not change between runs
+	test.Id, _ = primitive.ObjectIDFromHex("64b000000000000000000001")
+	return test
+}
+
+func mustMcqQuestions(t *testing.T, test *common.Test) []common.MCQ {
+	t.Helper()
+	questions, err := test.GetMCQQuestions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return questions
+}
+
+func shuffledPaper(t *testing.T, username string, test *common.Test) []common.CandidateMCQ {
+	t.Helper()
+	data, err := shuffledMcqJson(username, test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paper []common.CandidateMCQ
+	if err := json.Unmarshal([]byte(data), &paper); err != nil {
+		t.Fatal(err)
+	}
+	return paper
+}
+
+func TestMcqOrderDeterministic(t *testing.T) {
+	test := shuffleTest(t)
+	questions := mustMcqQuestions(t, test)
+
+	order := newMcqOrder("alice", test.Id, questions)
+	if again := newMcqOrder("alice", test.Id, questions); !slices.Equal(order.questions, again.questions) ||
+		!slices.EqualFunc(order.options, again.options, slices.Equal[[]int]) {
+		t.Fatal("same candidate and test got another order")
+	}
+
+	sorted := slices.Clone(order.questions)
+	slices.Sort(sorted)
+	for i, q := range sorted {
+		if q != i {
+			t.Fatalf("question order %v is not a permutation", order.questions)
+		}
+	}
+
+	if other := newMcqOrder("bob", test.Id, questions); slices.Equal(order.questions, other.questions) {
+		t.Error("another candidate got the same question order")
+	}
+	otherTest, _ := primitive.ObjectIDFromHex("64b000000000000000000002")
+	if other := newMcqOrder("alice", otherTest, questions); slices.Equal(order.questions, other.questions) {
+		t.Error("another test got the same question order")
+	}
+}
+
+func TestShuffledMcqRoundTrip(t *testing.T) {
+	test := shuffleTest(t)
+	questions := mustMcqQuestions(t, test)
+
+	for _, username := range []string{"alice", "bob", "carol"} {
+		t.Run(username, func(t *testing.T) {
+			paper := shuffledPaper(t, username, test)
+			if len(paper) != len(questions) {
+				t.Fatalf("%d questions on the paper, want %d", len(paper), len(questions))
+			}
+
+			// the candidate picks the right option of every question as they see it
+			answers := make([]*int, len(paper))
+			for i, shown := range paper {
+				q := slices.IndexFunc(questions, func(question common.MCQ) bool {
+					return question.Question == shown.Question
+				})
+				if q < 0 {
+					t.Fatalf("unknown question '%s'", shown.Question)
+				}
+				correct, err := McqAnswerIndex(&questions[q])
+				if err != nil {
+					t.Fatal(err)
+				}
+				answers[i] = answer(slices.Index(shown.Options, questions[q].Options[correct]))
+			}
+
+			info := &common.McqTestInfo{Answers: answers}
+			if err := canonicalMcqAnswers(username, test, info); err != nil {
+				t.Fatal(err)
+			}
+			result := &common.Result{}
+			if err := GradeMcq(test, info, result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Score != result.MaxScore || result.MaxScore == 0 {
+				t.Fatalf("score %v of %v, want full marks", result.Score, result.MaxScore)
+			}
+		})
+	}
+}
+
+func TestCanonicalMcqAnswersKeepsInvalidIndices(t *testing.T) {
+	test := shuffleTest(t)
+	info := &common.McqTestInfo{Answers: []*int{answer(9), nil}}
+	if err := canonicalMcqAnswers("alice", test, info); err != nil {
+		t.Fatal(err)
+	}
+	order := newMcqOrder("alice", test.Id, mustMcqQuestions(t, test))
+	if got := info.Answers[order.questions[0]]; got == nil || *got != 9 {
+		t.Errorf("index that is not an option: got %v, want 9", got)
+	}
+	if got := info.Answers[order.questions[1]]; got != nil {
+		t.Errorf("unanswered question: got %d", *got)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"common"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var ErrNoSnapshot = errors.New("no snapshot of this test was uploaded")
+
+// largest document accepted as a snapshot. the same as test files uploaded by admins
+const snapshotSizeLimit = 10 << 20
+
+// two uploads of the same attempt at once must not get the same version
+var snapshotMutex sync.Mutex
+
+// stores the document a candidate is working on as the next version of their attempt at the
+// test, while it is open for submissions. a document identical to the latest version is not
+// stored again, the latest version is returned instead
+func (this *Database) SaveSnapshot(ctx context.Context, username string, testId common.ID, data io.Reader) (*common.Snapshot, error) {
+	now := time.Now()
+
+	attempt, err := this.Attempts.FindLatest(ctx, username, testId)
+	if err == ErrNotFound {
+		return nil, ErrTestNotStarted
+	}
+	if err != nil {
+		return nil, err
+	}
+	test, err := this.Tests.FindById(ctx, testId)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAttemptOpen(attempt, test.SubmissionPolicy, now)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := this.Storage.Put(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	info, err := this.Storage.Stat(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+
+	version := 1
+	latest, err := this.Snapshots.FindLatest(ctx, attempt.Id)
+	switch err {
+	case nil:
+		if latest.FileHash == hash {
+			return latest, nil
+		}
+		version = latest.Version + 1
+	case ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	snapshot := &common.Snapshot{
+		Username:  username,
+		TestId:    testId,
+		AttemptId: attempt.Id,
+		Version:   version,
+		FileHash:  hash,
+		Size:      info.Size,
+		TakenAt:   now,
+	}
+	err = this.Snapshots.Add(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// sends the latest snapshot of the candidate's running attempt at the test to their app,
+// which continues with it instead of the document it has. used when a candidate moves to a
+// replacement machine. an app that is offline gets it when it reconnects
+func (this *Database) RestoreSnapshot(ctx context.Context, username string, testId common.ID) (*common.Snapshot, DeliveryStatus, error) {
+	snapshot, err := this.LatestSnapshot(ctx, username, testId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	status := this.Clients.notify(username, common.NewMessage(common.TRestoreSnapshot{
+		TestId:   testId,
+		FileHash: snapshot.FileHash,
+		Version:  snapshot.Version,
+	}))
+	return snapshot, status, nil
+}
+
+// the latest snapshot of the candidate's attempt at the test, while it is open for
+// submissions. the only one their app may fetch, to continue with it
+func (this *Database) LatestSnapshot(ctx context.Context, username string, testId common.ID) (*common.Snapshot, error) {
+	attempt, err := this.Attempts.FindLatest(ctx, username, testId)
+	if err == ErrNotFound {
+		return nil, ErrTestNotStarted
+	}
+	if err != nil {
+		return nil, err
+	}
+	test, err := this.Tests.FindById(ctx, testId)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAttemptOpen(attempt, test.SubmissionPolicy, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := this.Snapshots.FindLatest(ctx, attempt.Id)
+	if err == ErrNotFound {
+		return nil, ErrNoSnapshot
+	}
+	return snapshot, err
+}
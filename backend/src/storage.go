@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+type BlobInfo struct {
+	Hash string
+	Size int64
+}
+
+// content addressed blob storage for test assets and submitted files.
+// blobs are identified by the hex encoded sha256 hash of their content
+type Storage interface {
+	// stores the data and returns its hash. storing the same data twice is a no-op
+	Put(ctx context.Context, data io.Reader) (string, error)
+	Get(ctx context.Context, hash string) (io.ReadCloser, error)
+	Delete(ctx context.Context, hash string) error
+	Stat(ctx context.Context, hash string) (*BlobInfo, error)
+}
+
+// STORAGE_BACKEND selects the implementation:
+//   - local (default): files in STORAGE_DIR (default ./storage)
+//   - s3: bucket AWS_S3_BUCKET in AWS_S3_REGION using AWS_S3_ACCESS_KEY and AWS_S3_ACCESS_KEY_SECRET
+func NewStorageFromEnv() (Storage, error) {
+	switch backend := getEnvOrDefault("STORAGE_BACKEND", "local"); backend {
+	case "local":
+		return NewLocalStorage(getEnvOrDefault("STORAGE_DIR", "storage"))
+	case "s3":
+		return NewS3Storage(
+			getEnvOrDefault("AWS_S3_REGION", "ap-south-1"),
+			getEnvOrDefault("AWS_S3_BUCKET", "collegeprojectbucket"),
+			os.Getenv("AWS_S3_ACCESS_KEY"),
+			os.Getenv("AWS_S3_ACCESS_KEY_SECRET"),
+		)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND '%s'", backend)
+	}
+}
+
+var blobHashRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// hashes come from urls and documents. never let one turn into an arbitrary path or key
+func validateBlobHash(hash string) error {
+	if !blobHashRegex.MatchString(hash) {
+		return fmt.Errorf("invalid blob hash '%s'", hash)
+	}
+	return nil
+}
+
+// url candidates and admins can fetch a blob from
+func BlobURL(hash string) string {
+	return os.Getenv("SERVER_URL") + "/storage/" + hash
+}
+
+type LocalStorage struct {
+	dir string
+}
+
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create storage dir: %v", err)
+	}
+	return &LocalStorage{dir: dir}, nil
+}
+
+// blobs are spread over subdirectories named after the first 2 chars of the hash
+func (self *LocalStorage) path(hash string) string {
+	return filepath.Join(self.dir, hash[:2], hash)
+}
+
+func (self *LocalStorage) Put(ctx context.Context, data io.Reader) (string, error) {
+	// write to a temp file first so a half written blob never shows up under its hash
+	tmp, err := os.CreateTemp(self.dir, "upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hasher), data)
+	if err != nil {
+		return "", err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return "", err
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	path := self.path(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (self *LocalStorage) Get(ctx context.Context, hash string) (io.ReadCloser, error) {
+	if err := validateBlobHash(hash); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(self.path(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return file, err
+}
+
+func (self *LocalStorage) Delete(ctx context.Context, hash string) error {
+	if err := validateBlobHash(hash); err != nil {
+		return err
+	}
+	err := os.Remove(self.path(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrBlobNotFound
+	}
+	return err
+}
+
+func (self *LocalStorage) Stat(ctx context.Context, hash string) (*BlobInfo, error) {
+	if err := validateBlobHash(hash); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(self.path(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &BlobInfo{Hash: hash, Size: info.Size()}, nil
+}
+
+type S3Storage struct {
+	bucket   string
+	client   *s3.S3
+	uploader *s3manager.Uploader
+}
+
+func NewS3Storage(region string, bucket string, accessKey string, secret string) (*S3Storage, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.NewStaticCredentials(accessKey, secret, ""),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %v", err)
+	}
+
+	return &S3Storage{
+		bucket:   bucket,
+		client:   s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+	}, nil
+}
+
+func isS3NotFound(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		return reqErr.StatusCode() == http.StatusNotFound
+	}
+	return false
+}
+
+func (self *S3Storage) Put(ctx context.Context, data io.Reader) (string, error) {
+	// the key is the hash, so the whole blob has to be read before uploading
+	buf, err := io.ReadAll(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf)
+	hash := hex.EncodeToString(sum[:])
+
+	_, err = self.Stat(ctx, hash)
+	if err == nil {
+		return hash, nil
+	}
+	if err != ErrBlobNotFound {
+		return "", err
+	}
+
+	_, err = self.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(self.bucket),
+		Key:    aws.String(hash),
+		Body:   bytes.NewReader(buf),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file to S3: %v", err)
+	}
+	return hash, nil
+}
+
+func (self *S3Storage) Get(ctx context.Context, hash string) (io.ReadCloser, error) {
+	if err := validateBlobHash(hash); err != nil {
+		return nil, err
+	}
+	output, err := self.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(self.bucket),
+		Key:    aws.String(hash),
+	})
+	if isS3NotFound(err) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+func (self *S3Storage) Delete(ctx context.Context, hash string) error {
+	if _, err := self.Stat(ctx, hash); err != nil {
+		return err
+	}
+	_, err := self.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(self.bucket),
+		Key:    aws.String(hash),
+	})
+	return err
+}
+
+func (self *S3Storage) Stat(ctx context.Context, hash string) (*BlobInfo, error) {
+	if err := validateBlobHash(hash); err != nil {
+		return nil, err
+	}
+	output, err := self.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(self.bucket),
+		Key:    aws.String(hash),
+	})
+	if isS3NotFound(err) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &BlobInfo{Hash: hash, Size: aws.Int64Value(output.ContentLength)}, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"common"
+	"math"
+	"strings"
+	"time"
+)
+
+// allowed difference between client reported and server computed numbers before a
+// submission gets flagged
+const typingWpmTolerance = 2.0
+const typingAccuracyTolerance = 2.0
+
+// seconds the client may claim less than the server measured. the server's time includes
+// reading the text before typing and the upload
+const typingTimeTolerance = 30.0
+
+// recomputes typing test scores from the typed text. client reported numbers are
+// only compared against these.
+//
+//   - chars are compared position by position with the typing text. every typed char
+//     that does not match (including ones typed past the end of the text) is a char error
+//   - words are split on whitespace and compared position by position. every typed word
+//     that does not match the word at the same position is a word error
+//   - gross wpm = (typed chars / 5) / minutes
+//   - net wpm = gross wpm - (word errors / minutes), never below 0
+//   - accuracy = correct chars / typed chars * 100
+//
+// time taken is the time the attempt ran on the server's clock, from its start to the
+// submission or the deadline. a client that claims more time gets it, a client that claims
+// less does not. it is capped to the time the attempt was allowed to run, or to the test
+// duration when the attempt is not known.
+func ScoreTyping(test *common.Test, info *common.TypingTestInfo, attempt *common.Attempt, submittedAt time.Time) *common.TypingResult {
+	result := &common.TypingResult{
+		TimeTaken:       info.TimeTaken,
+		ClientTimeTaken: info.TimeTaken,
+	}
+	allowed := float64(test.Duration * 60)
+	if attempt != nil && !attempt.StartedAt.IsZero() {
+		end := submittedAt
+		if end.IsZero() || end.After(attempt.Deadline) {
+			end = attempt.Deadline
+		}
+		measured := math.Max(end.Sub(attempt.StartedAt).Seconds(), 0)
+		result.TimeTaken = math.Max(result.TimeTaken, measured)
+		allowed = attempt.Deadline.Sub(attempt.StartedAt).Seconds()
+
+		if info.TimeTaken < measured-typingTimeTolerance {
+			result.MismatchFields = append(result.MismatchFields, "TimeTaken")
+		}
+	}
+	if allowed > 0 {
+		result.TimeTaken = math.Min(result.TimeTaken, allowed)
+	}
+
+	expected := []rune(test.TypingText)
+	typed := []rune(info.TypedText)
+	result.TypedChars = len(typed)
+	for i, char := range typed {
+		if i < len(expected) && expected[i] == char {
+			result.CorrectChars += 1
+		}
+	}
+	result.CharErrors = result.TypedChars - result.CorrectChars
+
+	expectedWords := strings.Fields(test.TypingText)
+	typedWords := strings.Fields(info.TypedText)
+	result.TypedWords = len(typedWords)
+	for i, word := range typedWords {
+		if i >= len(expectedWords) || expectedWords[i] != word {
+			result.WordErrors += 1
+		}
+	}
+
+	if result.TypedChars > 0 {
+		result.Accuracy = roundTo(float64(result.CorrectChars)/float64(result.TypedChars)*100, 2)
+	}
+
+	minutes := result.TimeTaken / 60
+	if minutes > 0 {
+		gross := float64(result.TypedChars) / 5 / minutes
+		result.GrossWPM = roundTo(gross, 2)
+		result.NetWPM = roundTo(math.Max(0, gross-float64(result.WordErrors)/minutes), 2)
+	}
+
+	if math.Abs(info.RawWPM-result.GrossWPM) > typingWpmTolerance {
+		result.MismatchFields = append(result.MismatchFields, "RawWPM")
+	}
+	if math.Abs(info.WPM-result.NetWPM) > typingWpmTolerance {
+		result.MismatchFields = append(result.MismatchFields, "WPM")
+	}
+	if math.Abs(info.Accuracy-result.Accuracy) > typingAccuracyTolerance {
+		result.MismatchFields = append(result.MismatchFields, "Accuracy")
+	}
+	result.Mismatch = len(result.MismatchFields) > 0
+
+	return result
+}
+
+func roundTo(val float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(val*scale) / scale
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"common"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestScoreTyping(t *testing.T) {
+	// 50 chars and 10 words, 10 wpm when typed in a minute
+	text := "aaaa aaaa aaaa aaaa aaaa aaaa aaaa aaaa aaaa aaaa "
+	test := &common.Test{Type: common.TypingTest, TypingText: text, Duration: 5}
+
+	cases := []struct {
+		name     string
+		info     common.TypingTestInfo
+		gross    float64
+		net      float64
+		accuracy float64
+		mismatch []string
+	}{
+		{
+			name:     "matching client numbers",
+			info:     common.TypingTestInfo{TypedText: text, TimeTaken: 60, WPM: 10, RawWPM: 10, Accuracy: 100},
+			gross:    10,
+			net:      10,
+			accuracy: 100,
+		},
+		{
+			name:     "wpm at the tolerance",
+			info:     common.TypingTestInfo{TypedText: text, TimeTaken: 60, WPM: 12, RawWPM: 8, Accuracy: 100},
+			gross:    10,
+			net:      10,
+			accuracy: 100,
+		},
+		{
+			name:     "wpm past the tolerance",
+			info:     common.TypingTestInfo{TypedText: text, TimeTaken: 60, WPM: 12.01, RawWPM: 7.99, Accuracy: 100},
+			gross:    10,
+			net:      10,
+			accuracy: 100,
+			mismatch: []string{"RawWPM", "WPM"},
+		},
+		{
+			name:     "accuracy at the tolerance",
+			info:     common.TypingTestInfo{TypedText: text, TimeTaken: 60, WPM: 10, RawWPM: 10, Accuracy: 98},
+			gross:    10,
+			net:      10,
+			accuracy: 100,
+		},
+		{
+			name:     "accuracy past the tolerance",
+			info:     common.TypingTestInfo{TypedText: text, TimeTaken: 60, WPM: 10, RawWPM: 10, Accuracy: 97.99},
+			gross:    10,
+			net:      10,
+			accuracy: 100,
+			mismatch: []string{"Accuracy"},
+		},
+		{
+			name:     "char and word errors",
+			info:     common.TypingTestInfo{TypedText: "aaaa abaa", TimeTaken: 60, WPM: 0.8, RawWPM: 1.8, Accuracy: 88.89},
+			gross:    1.8,
+			net:      0.8,
+			accuracy: 88.89,
+		},
+		{
+			name:     "word errors do not make net wpm negative",
+			info:     common.TypingTestInfo{TypedText: "b b b b b", TimeTaken: 60, WPM: 0, RawWPM: 1.8, Accuracy: 0},
+			gross:    1.8,
+			net:      0,
+			accuracy: 0,
+		},
+		{
+			name: "nothing typed",
+			info: common.TypingTestInfo{TypedText: "", TimeTaken: 60},
+		},
+		{
+			name: "nothing typed in no time",
+			info: common.TypingTestInfo{},
+		},
+		{
+			name:     "inflated client numbers",
+			info:     common.TypingTestInfo{TypedText: text, TimeTaken: 60, WPM: 80, RawWPM: 80, Accuracy: 100},
+			gross:    10,
+			net:      10,
+			accuracy: 100,
+			mismatch: []string{"RawWPM", "WPM"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := ScoreTyping(test, &c.info, nil, time.Time{})
+			if result.GrossWPM != c.gross || result.NetWPM != c.net || result.Accuracy != c.accuracy {
+				t.Errorf("gross %v, net %v, accuracy %v, want %v, %v, %v", result.GrossWPM, result.NetWPM, result.Accuracy, c.gross, c.net, c.accuracy)
+			}
+			if !slices.Equal(result.MismatchFields, c.mismatch) || result.Mismatch != (len(c.mismatch) > 0) {
+				t.Errorf("mismatch %v %v, want %v", result.Mismatch, result.MismatchFields, c.mismatch)
+			}
+		})
+	}
+}
+
+func TestScoreTypingEmptyText(t *testing.T) {
+	// every typed char of a test without text is an error
+	test := &common.Test{Type: common.TypingTest, Duration: 5}
+	result := ScoreTyping(test, &common.TypingTestInfo{TypedText: "abcde", TimeTaken: 60, RawWPM: 1}, nil, time.Time{})
+	if result.CharErrors != 5 || result.WordErrors != 1 || result.Accuracy != 0 {
+		t.Errorf("%d char errors, %d word errors, accuracy %v, want 5, 1, 0", result.CharErrors, result.WordErrors, result.Accuracy)
+	}
+	if result.NetWPM != 0 {
+		t.Errorf("net wpm %v, want 0", result.NetWPM)
+	}
+}
+
+func TestScoreTypingTime(t *testing.T) {
+	started := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	attempt := &common.Attempt{StartedAt: started, Deadline: started.Add(5 * time.Minute)}
+	test := &common.Test{Type: common.TypingTest, TypingText: "aaaa", Duration: 5}
+
+	cases := []struct {
+		name        string
+		attempt     *common.Attempt
+		submittedAt time.Time
+		client      float64
+		timeTaken   float64
+		mismatch    bool
+	}{
+		{"client and server agree", attempt, started.Add(time.Minute), 60, 60, false},
+		{"server time wins over a shorter claim", attempt, started.Add(time.Minute), 45, 60, false},
+		{"claim at the time tolerance", attempt, started.Add(time.Minute), 30, 60, false},
+		{"claim past the time tolerance", attempt, started.Add(time.Minute), 29.9, 60, true},
+		{"longer claim is kept", attempt, started.Add(time.Minute), 90, 90, false},
+		{"claim is capped to the attempt", attempt, started.Add(time.Minute), 1000, 300, false},
+		{"late submission counts to the deadline", attempt, started.Add(10 * time.Minute), 300, 300, false},
+		{"unknown submission time counts to the deadline", attempt, time.Time{}, 10, 300, true},
+		{"no attempt takes the client time", nil, started.Add(time.Minute), 45, 45, false},
+		{"no attempt caps to the test duration", nil, started.Add(time.Minute), 1000, 300, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := ScoreTyping(test, &common.TypingTestInfo{TypedText: "aaaa", TimeTaken: c.client}, c.attempt, c.submittedAt)
+			if result.TimeTaken != c.timeTaken {
+				t.Errorf("time taken %v, want %v", result.TimeTaken, c.timeTaken)
+			}
+			if result.ClientTimeTaken != c.client {
+				t.Errorf("client time taken %v, want %v", result.ClientTimeTaken, c.client)
+			}
+			if got := slices.Contains(result.MismatchFields, "TimeTaken"); got != c.mismatch {
+				t.Errorf("time mismatch %v, want %v", got, c.mismatch)
+			}
+		})
+	}
+}
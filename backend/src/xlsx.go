@@ -0,0 +1,613 @@
+package main
+
+import (
+	"common"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type xlsxCell struct {
+	Ref     string `xml:"r,attr"`
+	Type    string `xml:"t,attr"`
+	Style   int    `xml:"s,attr"`
+	Formula *struct {
+		Text string `xml:",chardata"`
+		T    string `xml:"t,attr"`
+		Si   string `xml:"si,attr"`
+	} `xml:"f"`
+	Value  string `xml:"v"`
+	Inline *struct {
+		T    string `xml:"t"`
+		Runs []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"is"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []xlsxCell `xml:"c"`
+	} `xml:"sheetData>row"`
+	ConditionalFormatting []struct {
+		Sqref string `xml:"sqref,attr"`
+	} `xml:"conditionalFormatting"`
+	Drawing *struct {
+		Id string `xml:"id,attr"`
+	} `xml:"drawing"`
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		Id   string `xml:"id,attr"`
+	} `xml:"sheets>sheet"`
+	DefinedNames []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"definedNames>definedName"`
+}
+
+type xlsxSheet struct {
+	part      string
+	worksheet xlsxWorksheet
+	// cell reference -> cell
+	cells map[string]*xlsxCell
+	// shared formula index -> formula text of the cell that defines it
+	sharedFormulas map[string]string
+}
+
+type xlsxFile struct {
+	pkg           *ooxmlPackage
+	workbook      xlsxWorkbook
+	sharedStrings []string
+	// style index -> number format code
+	cellFormats []string
+	// sheet name -> part name
+	sheetParts map[string]string
+	sheets     map[string]*xlsxSheet
+}
+
+// number formats that are built into excel and are not stored in the file
+var xlsxBuiltinFormats = map[int]string{
+	0:  "General",
+	1:  "0",
+	2:  "0.00",
+	3:  "#,##0",
+	4:  "#,##0.00",
+	9:  "0%",
+	10: "0.00%",
+	11: "0.00E+00",
+	12: "# ?/?",
+	13: "# ??/??",
+	14: "mm-dd-yy",
+	15: "d-mmm-yy",
+	16: "d-mmm",
+	17: "mmm-yy",
+	18: "h:mm AM/PM",
+	19: "h:mm:ss AM/PM",
+	20: "h:mm",
+	21: "h:mm:ss",
+	22: "m/d/yy h:mm",
+	37: "#,##0 ;(#,##0)",
+	38: "#,##0 ;[Red](#,##0)",
+	39: "#,##0.00;(#,##0.00)",
+	40: "#,##0.00;[Red](#,##0.00)",
+	45: "mm:ss",
+	46: "[h]:mm:ss",
+	47: "mmss.0",
+	48: "##0.0E+0",
+	49: "@",
+}
+
+func openXlsx(data []byte) (*xlsxFile, error) {
+	pkg, err := openOoxml(data)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &xlsxFile{
+		pkg:        pkg,
+		sheetParts: make(map[string]string),
+		sheets:     make(map[string]*xlsxSheet),
+	}
+
+	err = pkg.decode("xl/workbook.xml", &self.workbook)
+	if err != nil {
+		return nil, err
+	}
+
+	rels, err := pkg.rels("xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	for _, sheet := range self.workbook.Sheets {
+		rel, ok := rels[sheet.Id]
+		if ok {
+			self.sheetParts[sheet.Name] = rel.Target
+		}
+	}
+
+	if pkg.has("xl/sharedStrings.xml") {
+		var sst struct {
+			Items []struct {
+				T    string `xml:"t"`
+				Runs []struct {
+					T string `xml:"t"`
+				} `xml:"r"`
+			} `xml:"si"`
+		}
+		err = pkg.decode("xl/sharedStrings.xml", &sst)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range sst.Items {
+			text := item.T
+			for _, run := range item.Runs {
+				text += run.T
+			}
+			self.sharedStrings = append(self.sharedStrings, text)
+		}
+	}
+
+	if pkg.has("xl/styles.xml") {
+		var styles struct {
+			NumFmts []struct {
+				Id   int    `xml:"numFmtId,attr"`
+				Code string `xml:"formatCode,attr"`
+			} `xml:"numFmts>numFmt"`
+			CellXfs []struct {
+				NumFmtId int `xml:"numFmtId,attr"`
+			} `xml:"cellXfs>xf"`
+		}
+		err = pkg.decode("xl/styles.xml", &styles)
+		if err != nil {
+			return nil, err
+		}
+		formats := make(map[int]string)
+		for id, code := range xlsxBuiltinFormats {
+			formats[id] = code
+		}
+		for _, format := range styles.NumFmts {
+			formats[format.Id] = format.Code
+		}
+		for _, xf := range styles.CellXfs {
+			self.cellFormats = append(self.cellFormats, formats[xf.NumFmtId])
+		}
+	}
+
+	return self, nil
+}
+
+func (self *xlsxFile) sheet(name string) (*xlsxSheet, error) {
+	if sheet, ok := self.sheets[name]; ok {
+		return sheet, nil
+	}
+
+	part, ok := self.sheetParts[name]
+	if !ok {
+		// sheet names are case insensitive in excel
+		for sheetName, sheetPart := range self.sheetParts {
+			if strings.EqualFold(sheetName, name) {
+				part, ok = sheetPart, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("sheet '%s' not found", name)
+	}
+
+	sheet := &xlsxSheet{
+		part:           part,
+		cells:          make(map[string]*xlsxCell),
+		sharedFormulas: make(map[string]string),
+	}
+	err := self.pkg.decode(part, &sheet.worksheet)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sheet.worksheet.Rows {
+		row := &sheet.worksheet.Rows[i]
+		for j := range row.Cells {
+			cell := &row.Cells[j]
+			sheet.cells[strings.ToUpper(cell.Ref)] = cell
+			if cell.Formula != nil && cell.Formula.T == "shared" && cell.Formula.Text != "" {
+				sheet.sharedFormulas[cell.Formula.Si] = cell.Formula.Text
+			}
+		}
+	}
+
+	self.sheets[name] = sheet
+	return sheet, nil
+}
+
+func (self *xlsxFile) cellValue(cell *xlsxCell) string {
+	if cell == nil {
+		return ""
+	}
+
+	switch cell.Type {
+	case "s":
+		index, err := strconv.Atoi(cell.Value)
+		if err != nil || index < 0 || index >= len(self.sharedStrings) {
+			return ""
+		}
+		return self.sharedStrings[index]
+	case "inlineStr":
+		if cell.Inline == nil {
+			return ""
+		}
+		text := cell.Inline.T
+		for _, run := range cell.Inline.Runs {
+			text += run.T
+		}
+		return text
+	case "b":
+		if cell.Value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	default:
+		return cell.Value
+	}
+}
+
+func (self *xlsxSheet) formula(cell *xlsxCell) string {
+	if cell == nil || cell.Formula == nil {
+		return ""
+	}
+	if cell.Formula.Text == "" && cell.Formula.T == "shared" {
+		return self.sharedFormulas[cell.Formula.Si]
+	}
+	return cell.Formula.Text
+}
+
+var xlsxCellRefRegex = regexp.MustCompile(`^\$?([A-Za-z]{1,3})\$?([0-9]+)$`)
+
+// 1 based column and row of a cell reference like "B2" or "$B$2"
+func parseCellRef(ref string) (int, int, error) {
+	match := xlsxCellRefRegex.FindStringSubmatch(strings.TrimSpace(ref))
+	if match == nil {
+		return 0, 0, fmt.Errorf("invalid cell reference '%s'", ref)
+	}
+
+	col := 0
+	for _, char := range strings.ToUpper(match[1]) {
+		col = col*26 + int(char-'A'+1)
+	}
+	row, err := strconv.Atoi(match[2])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cell reference '%s'", ref)
+	}
+	return col, row, nil
+}
+
+func cellRefName(col int, row int) string {
+	name := ""
+	for col > 0 {
+		col -= 1
+		name = string(rune('A'+col%26)) + name
+		col /= 26
+	}
+	return fmt.Sprintf("%s%d", name, row)
+}
+
+type xlsxRange struct {
+	col1, row1, col2, row2 int
+}
+
+// ranges like "A1:B10", "$A$1:$B$10", "C3" and "Sheet1!A1:B2"
+func parseRange(ref string) (xlsxRange, error) {
+	if i := strings.LastIndex(ref, "!"); i >= 0 {
+		ref = ref[i+1:]
+	}
+	parts := strings.Split(ref, ":")
+	if len(parts) > 2 {
+		return xlsxRange{}, fmt.Errorf("invalid range '%s'", ref)
+	}
+
+	col1, row1, err := parseCellRef(parts[0])
+	if err != nil {
+		return xlsxRange{}, err
+	}
+	col2, row2 := col1, row1
+	if len(parts) == 2 {
+		col2, row2, err = parseCellRef(parts[1])
+		if err != nil {
+			return xlsxRange{}, err
+		}
+	}
+	return xlsxRange{
+		col1: min(col1, col2),
+		row1: min(row1, row2),
+		col2: max(col1, col2),
+		row2: max(row1, row2),
+	}, nil
+}
+
+func (self xlsxRange) overlaps(other xlsxRange) bool {
+	return self.col1 <= other.col2 && other.col1 <= self.col2 &&
+		self.row1 <= other.row2 && other.row1 <= self.row2
+}
+
+func normalizeNumberFormat(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(code, `\`, ""), `"`, ""))
+}
+
+func valuesEqual(a string, b string) bool {
+	a = strings.TrimSpace(a)
+	b = strings.TrimSpace(b)
+
+	numA, errA := strconv.ParseFloat(a, 64)
+	numB, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		// cached values of formulas carry floating point noise
+		diff := numA - numB
+		return diff < 1e-9 && diff > -1e-9
+	}
+	return strings.EqualFold(a, b)
+}
+
+// excel stores functions added after 2007 with a prefix, e.g. _xlfn.XLOOKUP(
+var xlsxFunctionPrefixes = strings.NewReplacer("_XLFN.", "", "_XLWS.", "")
+
+func isFormulaNameChar(char byte) bool {
+	return char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || char == '_' || char == '.'
+}
+
+// whether a formula calls a function. names are compared without case, so "SUM" is found in
+// "=sum(A1:A3)" but not in "=SUMIF(..)" or "=MYSUM(..)"
+func formulaCalls(formula string, function string) bool {
+	formula = xlsxFunctionPrefixes.Replace(strings.ToUpper(formula))
+	function = xlsxFunctionPrefixes.Replace(strings.ToUpper(strings.TrimSpace(function)))
+	if function == "" {
+		return false
+	}
+
+	for start := 0; ; start += 1 {
+		i := strings.Index(formula[start:], function)
+		if i < 0 {
+			return false
+		}
+		start += i
+		if start > 0 && isFormulaNameChar(formula[start-1]) {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimLeft(formula[start+len(function):], " \t\r\n"), "(") {
+			return true
+		}
+	}
+}
+
+// the parameters a xlsx rule needs, checked when the rubric is saved
+func validateXlsxRule(rule *common.RubricRule) error {
+	if rule.Kind != common.XlsxNamedRange && strings.TrimSpace(rule.Sheet) == "" {
+		return fmt.Errorf("needs a Sheet")
+	}
+
+	switch rule.Kind {
+	case common.XlsxCellEquals:
+		_, _, err := parseCellRef(rule.Ref)
+		return err
+	case common.XlsxCellFormula, common.XlsxNumberFormat:
+		_, _, err := parseCellRef(rule.Ref)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(rule.Text) == "" {
+			return fmt.Errorf("needs Text")
+		}
+	case common.XlsxConditionalFormatting:
+		if rule.Ref != "" {
+			_, err := parseRange(rule.Ref)
+			return err
+		}
+	case common.XlsxSortedRange:
+		rng, err := parseRange(rule.Ref)
+		if err != nil {
+			return err
+		}
+		if rng.col1 != rng.col2 {
+			return fmt.Errorf("sorted range must be a single column")
+		}
+		switch strings.ToLower(strings.TrimSpace(rule.Text)) {
+		case "", "asc", "desc":
+		default:
+			return fmt.Errorf("Text must be 'asc' or 'desc'")
+		}
+	case common.XlsxNamedRange:
+		if strings.TrimSpace(rule.Text) == "" {
+			return fmt.Errorf("needs a name in Text")
+		}
+		if rule.Ref != "" {
+			_, err := parseRange(rule.Ref)
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *xlsxFile) check(rule *common.RubricRule) (bool, string, error) {
+	if rule.Kind == common.XlsxNamedRange {
+		for _, name := range self.workbook.DefinedNames {
+			if !strings.EqualFold(name.Name, rule.Text) {
+				continue
+			}
+			if rule.Ref == "" {
+				return true, "", nil
+			}
+			want, err := parseRange(rule.Ref)
+			if err != nil {
+				return false, "", err
+			}
+			got, err := parseRange(name.Value)
+			if err == nil && got == want {
+				return true, "", nil
+			}
+			return false, fmt.Sprintf("'%s' refers to %s", name.Name, name.Value), nil
+		}
+		return false, fmt.Sprintf("name '%s' is not defined", rule.Text), nil
+	}
+
+	sheet, err := self.sheet(rule.Sheet)
+	if err != nil {
+		return false, "", err
+	}
+
+	switch rule.Kind {
+	case common.XlsxCellEquals:
+		col, row, err := parseCellRef(rule.Ref)
+		if err != nil {
+			return false, "", err
+		}
+		value := self.cellValue(sheet.cells[cellRefName(col, row)])
+		if valuesEqual(value, rule.Text) {
+			return true, "", nil
+		}
+		return false, fmt.Sprintf("%s is '%s'", rule.Ref, value), nil
+
+	case common.XlsxCellFormula:
+		col, row, err := parseCellRef(rule.Ref)
+		if err != nil {
+			return false, "", err
+		}
+		formula := sheet.formula(sheet.cells[cellRefName(col, row)])
+		if formula == "" {
+			return false, fmt.Sprintf("%s has no formula", rule.Ref), nil
+		}
+		if formulaCalls(formula, rule.Text) {
+			return true, "", nil
+		}
+		return false, fmt.Sprintf("%s has formula '=%s'", rule.Ref, formula), nil
+
+	case common.XlsxNumberFormat:
+		col, row, err := parseCellRef(rule.Ref)
+		if err != nil {
+			return false, "", err
+		}
+		cell := sheet.cells[cellRefName(col, row)]
+		format := "General"
+		if cell != nil && cell.Style >= 0 && cell.Style < len(self.cellFormats) {
+			format = self.cellFormats[cell.Style]
+		}
+		if normalizeNumberFormat(format) == normalizeNumberFormat(rule.Text) {
+			return true, "", nil
+		}
+		return false, fmt.Sprintf("%s has number format '%s'", rule.Ref, format), nil
+
+	case common.XlsxConditionalFormatting:
+		if rule.Ref == "" {
+			if len(sheet.worksheet.ConditionalFormatting) > 0 {
+				return true, "", nil
+			}
+			// conditional formatting added by newer excel versions lives in extension lists
+			data, err := self.pkg.read(sheet.part)
+			if err != nil {
+				return false, "", err
+			}
+			if strings.Contains(string(data), ":conditionalFormatting") {
+				return true, "", nil
+			}
+			return false, "no conditional formatting on sheet", nil
+		}
+
+		want, err := parseRange(rule.Ref)
+		if err != nil {
+			return false, "", err
+		}
+		for _, formatting := range sheet.worksheet.ConditionalFormatting {
+			for _, ref := range strings.Fields(formatting.Sqref) {
+				got, err := parseRange(ref)
+				if err == nil && got.overlaps(want) {
+					return true, "", nil
+				}
+			}
+		}
+		return false, fmt.Sprintf("no conditional formatting on %s", rule.Ref), nil
+
+	case common.XlsxChartExists:
+		if sheet.worksheet.Drawing == nil {
+			return false, "sheet has no drawings", nil
+		}
+		rels, err := self.pkg.rels(sheet.part)
+		if err != nil {
+			return false, "", err
+		}
+		drawing, ok := rels[sheet.worksheet.Drawing.Id]
+		if !ok {
+			return false, "sheet has no drawings", nil
+		}
+		drawingRels, err := self.pkg.rels(drawing.Target)
+		if err != nil {
+			return false, "", err
+		}
+		for _, rel := range drawingRels {
+			if strings.HasSuffix(rel.Type, "/chart") {
+				return true, "", nil
+			}
+		}
+		return false, "sheet has no charts", nil
+
+	case common.XlsxSortedRange:
+		rng, err := parseRange(rule.Ref)
+		if err != nil {
+			return false, "", err
+		}
+		if rng.col1 != rng.col2 {
+			return false, "", fmt.Errorf("sorted range must be a single column")
+		}
+
+		values := []string{}
+		for row := rng.row1; row <= rng.row2; row++ {
+			value := strings.TrimSpace(self.cellValue(sheet.cells[cellRefName(rng.col1, row)]))
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+
+		descending := strings.EqualFold(strings.TrimSpace(rule.Text), "desc")
+		for i := 1; i < len(values); i++ {
+			cmp := compareCellValues(values[i-1], values[i])
+			if (!descending && cmp > 0) || (descending && cmp < 0) {
+				return false, fmt.Sprintf("'%s' comes before '%s'", values[i-1], values[i]), nil
+			}
+		}
+		return true, "", nil
+
+	default:
+		return false, "", fmt.Errorf("rule '%s' can not be used for xlsx tests", rule.Kind)
+	}
+}
+
+// numbers sort before text, like in excel
+func compareCellValues(a string, b string) int {
+	numA, errA := strconv.ParseFloat(a, 64)
+	numB, errB := strconv.ParseFloat(b, 64)
+	switch {
+	case errA == nil && errB == nil:
+		if numA < numB {
+			return -1
+		} else if numA > numB {
+			return 1
+		}
+		return 0
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	}
+}
+
+func GradeXlsx(test *common.Test, data []byte, result *common.Result) error {
+	xlsx, err := openXlsx(data)
+	if err != nil {
+		return err
+	}
+
+	GradeRubric(test.Rubric, xlsx.check, result)
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"common"
+	"testing"
+)
+
+const ooxmlRelsHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`
+
+const xlsxNamespaces = `xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+
+var xlsxFixture = map[string]string{
+	"xl/workbook.xml": `<workbook ` + xlsxNamespaces + `>
+		<sheets>
+			<sheet name="Data" sheetId="1" r:id="rId1"/>
+			<sheet name="Empty" sheetId="2" r:id="rId2"/>
+		</sheets>
+		<definedNames><definedName name="Prices">Data!$B$1:$B$3</definedName></definedNames>
+	</workbook>`,
+	"xl/_rels/workbook.xml.rels": ooxmlRelsHeader + `
+		<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+		<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+	</Relationships>`,
+	"xl/sharedStrings.xml": `<sst ` + xlsxNamespaces + `>
+		<si><t>Apple</t></si>
+		<si><t>Banana</t></si>
+		<si><r><t>Cher</t></r><r><t>ry</t></r></si>
+		<si><t>Total</t></si>
+	</sst>`,
+	"xl/styles.xml": `<styleSheet ` + xlsxNamespaces + `>
+		<numFmts><numFmt numFmtId="164" formatCode="&quot;$&quot;#,##0.00"/></numFmts>
+		<cellXfs><xf numFmtId="0"/><xf numFmtId="164"/><xf numFmtId="10"/></cellXfs>
+	</styleSheet>`,
+	"xl/worksheets/sheet1.xml": `<worksheet ` + xlsxNamespaces + `>
+		<sheetData>
+			<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1"><v>10</v></c></row>
+			<row r="2"><c r="A2" t="s"><v>1</v></c><c r="B2"><v>20</v></c><c r="C2" s="2"><f>B2/B4</f><v>0.33333333333333331</v></c></row>
+			<row r="3"><c r="A3" t="s"><v>2</v></c><c r="B3"><v>30</v></c><c r="C3" s="2"><f t="shared" ref="C3:C4" si="0">IF(B3&gt;15,B3,0)</f><v>30</v></c></row>
+			<row r="4"><c r="A4" t="s"><v>3</v></c><c r="B4" s="1"><f>SUM(B1:B3)</f><v>60</v></c><c r="C4"><f t="shared" si="0"/><v>60</v></c></row>
+			<row r="5"><c r="A5" t="inlineStr"><is><t>Lookup</t></is></c><c r="B5"><f>_xlfn.XLOOKUP("Apple",A1:A3,B1:B3)</f><v>10</v></c><c r="C5" t="b"><v>1</v></c></row>
+		</sheetData>
+		<conditionalFormatting sqref="B1:B3 D1"><cfRule type="cellIs" priority="1"/></conditionalFormatting>
+		<drawing r:id="rId1"/>
+	</worksheet>`,
+	"xl/worksheets/_rels/sheet1.xml.rels": ooxmlRelsHeader + `
+		<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/drawing" Target="../drawings/drawing1.xml"/>
+	</Relationships>`,
+	"xl/drawings/drawing1.xml": `<xdr:wsDr xmlns:xdr="http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing"/>`,
+	"xl/drawings/_rels/drawing1.xml.rels": ooxmlRelsHeader + `
+		<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart" Target="../charts/chart1.xml"/>
+	</Relationships>`,
+	"xl/charts/chart1.xml":     `<c:chartSpace xmlns:c="http://schemas.openxmlformats.org/drawingml/2006/chart"/>`,
+	"xl/worksheets/sheet2.xml": `<worksheet ` + xlsxNamespaces + `><sheetData/></worksheet>`,
+}
+
+func TestGradeXlsx(t *testing.T) {
+	data := ooxmlFile(t, xlsxFixture)
+	rule := func(kind common.RuleKind, ref string, text string) common.RubricRule {
+		return common.RubricRule{Kind: kind, Sheet: "Data", Ref: ref, Text: text}
+	}
+	checkRubric(t, GradeXlsx, data, []rubricCase{
+		{name: "number", rule: rule(common.XlsxCellEquals, "B2", "20.0"), passed: true},
+		{name: "shared string", rule: rule(common.XlsxCellEquals, "$A$1", "apple"), passed: true},
+		{name: "rich shared string", rule: rule(common.XlsxCellEquals, "A3", "Cherry"), passed: true},
+		{name: "inline string", rule: rule(common.XlsxCellEquals, "A5", "Lookup"), passed: true},
+		{name: "boolean", rule: rule(common.XlsxCellEquals, "C5", "true"), passed: true},
+		{name: "cached formula value", rule: rule(common.XlsxCellEquals, "C2", "0.333333333333333333"), passed: true},
+		{name: "wrong value", rule: rule(common.XlsxCellEquals, "A1", "Banana"), passed: false, detail: "A1 is 'Apple'"},
+		{name: "empty cell", rule: rule(common.XlsxCellEquals, "Z9", "1"), passed: false},
+		{name: "unknown sheet", rule: common.RubricRule{Kind: common.XlsxCellEquals, Sheet: "Missing", Ref: "A1", Text: "Apple"}, passed: false},
+		{name: "sheet names ignore case", rule: common.RubricRule{Kind: common.XlsxCellEquals, Sheet: "data", Ref: "A1", Text: "Apple"}, passed: true},
+
+		{name: "function", rule: rule(common.XlsxCellFormula, "B4", "sum"), passed: true},
+		{name: "shared formula", rule: rule(common.XlsxCellFormula, "C4", "IF"), passed: true},
+		{name: "function with a prefix", rule: rule(common.XlsxCellFormula, "B5", "XLOOKUP"), passed: true},
+		{name: "function named with its prefix", rule: rule(common.XlsxCellFormula, "B5", "_xlfn.XLOOKUP"), passed: true},
+		{name: "other function", rule: rule(common.XlsxCellFormula, "B4", "AVERAGE"), passed: false, detail: "B4 has formula '=SUM(B1:B3)'"},
+		{name: "part of a function name", rule: rule(common.XlsxCellFormula, "B5", "LOOKUP"), passed: false},
+		{name: "no formula", rule: rule(common.XlsxCellFormula, "B2", "SUM"), passed: false, detail: "B2 has no formula"},
+
+		{name: "custom number format", rule: rule(common.XlsxNumberFormat, "B4", "$#,##0.00"), passed: true},
+		{name: "builtin number format", rule: rule(common.XlsxNumberFormat, "C2", "0.00%"), passed: true},
+		{name: "general number format", rule: rule(common.XlsxNumberFormat, "B2", "General"), passed: true},
+		{name: "wrong number format", rule: rule(common.XlsxNumberFormat, "B2", "0.00%"), passed: false},
+
+		{name: "any conditional formatting", rule: rule(common.XlsxConditionalFormatting, "", ""), passed: true},
+		{name: "conditional formatting on a range", rule: rule(common.XlsxConditionalFormatting, "B2:B10", ""), passed: true},
+		{name: "conditional formatting elsewhere", rule: rule(common.XlsxConditionalFormatting, "E1:E5", ""), passed: false},
+		{name: "no conditional formatting", rule: common.RubricRule{Kind: common.XlsxConditionalFormatting, Sheet: "Empty"}, passed: false},
+
+		{name: "chart", rule: rule(common.XlsxChartExists, "", ""), passed: true},
+		{name: "no chart", rule: common.RubricRule{Kind: common.XlsxChartExists, Sheet: "Empty"}, passed: false, detail: "sheet has no drawings"},
+
+		{name: "ascending", rule: rule(common.XlsxSortedRange, "B1:B4", ""), passed: true},
+		{name: "ascending text", rule: rule(common.XlsxSortedRange, "A1:A4", "asc"), passed: true},
+		{name: "not descending", rule: rule(common.XlsxSortedRange, "B1:B3", "desc"), passed: false, detail: "'10' comes before '20'"},
+		{name: "more than a column", rule: rule(common.XlsxSortedRange, "A1:B3", ""), passed: false},
+
+		{name: "named range", rule: common.RubricRule{Kind: common.XlsxNamedRange, Text: "prices", Ref: "B1:B3"}, passed: true},
+		{name: "name anywhere", rule: common.RubricRule{Kind: common.XlsxNamedRange, Text: "Prices"}, passed: true},
+		{name: "name of another range", rule: common.RubricRule{Kind: common.XlsxNamedRange, Text: "Prices", Ref: "B1:B4"}, passed: false},
+		{name: "undefined name", rule: common.RubricRule{Kind: common.XlsxNamedRange, Text: "Costs"}, passed: false},
+	})
+}
+
+func TestFormulaCalls(t *testing.T) {
+	cases := []struct {
+		formula  string
+		function string
+		want     bool
+	}{
+		{"SUM(A1:A3)", "SUM", true},
+		{"sum (A1:A3)", "SUM", true},
+		{"1+SUM(A1:A3)", "sum", true},
+		{"SUMIF(A1:A3,\">1\")", "SUM", false},
+		{"MYSUM(A1:A3)", "SUM", false},
+		{"SUM", "SUM", false},
+		{"A1+SUM", "SUM", false},
+		{"IF(A1>1,SUM(A1:A3),0)", "SUM", true},
+		{"_xlfn.IFS(A1>1,1,TRUE,0)", "IFS", true},
+		{"_xlfn._xlws.SORT(A1:A3)", "SORT", true},
+		{"Sheet2.SUM(A1)", "SUM", false},
+		{"SUM(A1)", "", false},
+	}
+	for _, c := range cases {
+		if got := formulaCalls(c.formula, c.function); got != c.want {
+			t.Errorf("formulaCalls(%q, %q) = %v, want %v", c.formula, c.function, got, c.want)
+		}
+	}
+}
+
+func TestValidateRubricXlsx(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  common.RubricRule
+		valid bool
+	}{
+		{"cell value", common.RubricRule{Kind: common.XlsxCellEquals, Sheet: "Data", Ref: "B2", Text: "20"}, true},
+		{"empty cell value", common.RubricRule{Kind: common.XlsxCellEquals, Sheet: "Data", Ref: "B2"}, true},
+		{"cell value without a cell", common.RubricRule{Kind: common.XlsxCellEquals, Sheet: "Data", Text: "20"}, false},
+		{"cell value without a sheet", common.RubricRule{Kind: common.XlsxCellEquals, Ref: "B2", Text: "20"}, false},
+		{"cell value with a range", common.RubricRule{Kind: common.XlsxCellEquals, Sheet: "Data", Ref: "B2:B3"}, false},
+		{"formula", common.RubricRule{Kind: common.XlsxCellFormula, Sheet: "Data", Ref: "B4", Text: "SUM"}, true},
+		{"formula without a function", common.RubricRule{Kind: common.XlsxCellFormula, Sheet: "Data", Ref: "B4"}, false},
+		{"number format", common.RubricRule{Kind: common.XlsxNumberFormat, Sheet: "Data", Ref: "B4", Text: "0.00"}, true},
+		{"number format without a format", common.RubricRule{Kind: common.XlsxNumberFormat, Sheet: "Data", Ref: "B4"}, false},
+		{"conditional formatting anywhere", common.RubricRule{Kind: common.XlsxConditionalFormatting, Sheet: "Data"}, true},
+		{"conditional formatting on a bad range", common.RubricRule{Kind: common.XlsxConditionalFormatting, Sheet: "Data", Ref: "B:"}, false},
+		{"chart", common.RubricRule{Kind: common.XlsxChartExists, Sheet: "Data"}, true},
+		{"chart without a sheet", common.RubricRule{Kind: common.XlsxChartExists}, false},
+		{"sorted range", common.RubricRule{Kind: common.XlsxSortedRange, Sheet: "Data", Ref: "A1:A9", Text: "desc"}, true},
+		{"sorted range over columns", common.RubricRule{Kind: common.XlsxSortedRange, Sheet: "Data", Ref: "A1:B9"}, false},
+		{"sorted range with an unknown order", common.RubricRule{Kind: common.XlsxSortedRange, Sheet: "Data", Ref: "A1:A9", Text: "random"}, false},
+		{"named range", common.RubricRule{Kind: common.XlsxNamedRange, Text: "Prices"}, true},
+		{"named range without a name", common.RubricRule{Kind: common.XlsxNamedRange, Ref: "A1:A3"}, false},
+		{"rule of another test type", common.RubricRule{Kind: common.DocxTableColumns, Count: 2}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateRubric(common.ExcelTest, []common.RubricRule{c.rule})
+			if (err == nil) != c.valid {
+				t.Fatalf("got %v, want valid %v", err, c.valid)
+			}
+		})
+	}
+}
@@ -1,13 +1,10 @@
 package common
 
 import (
-	"context"
 	"encoding/json"
-	"os"
+	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func (test *Test) GetCollectionName() string {
@@ -30,14 +27,52 @@ func (batch *Batch) GetCollectionName() string {
 	return "batches"
 }
 
+func (result *Result) GetCollectionName() string {
+	return "results"
+}
+
 // primitive id converted to string
 // type ID = string
 type ID = primitive.ObjectID
 
+type AdminRole string
+
+const (
+	// everything, including managing other admins
+	SuperAdmin AdminRole = "super_admin"
+	// tests, batches and candidates
+	ExamManager AdminRole = "exam_manager"
+	// watches candidates during a live exam at a centre
+	Proctor AdminRole = "proctor"
+	// results and rubrics
+	Grader AdminRole = "grader"
+	// read only
+	Auditor AdminRole = "auditor"
+)
+
+func (self AdminRole) TSName() string {
+	switch self {
+	case SuperAdmin:
+		return "SuperAdmin"
+	case ExamManager:
+		return "ExamManager"
+	case Proctor:
+		return "Proctor"
+	case Grader:
+		return "Grader"
+	case Auditor:
+		return "Auditor"
+	default:
+		return "Unknown"
+	}
+}
+
 type Admin struct {
 	Id       ID `bson:"_id,omitempty" ts_type:"string"`
 	Username string
 	Password string
+	// admins from before roles existed have none and are treated as auditors
+	Role AdminRole
 }
 
 // type AdminRequest struct {
@@ -51,11 +86,221 @@ type Batch struct {
 	Tests []ID `ts_type:"string[]"`
 }
 
+// a scheduled sitting of a batch. its tests can only be started between StartsAt and
+// EndsAt, and each one has to be submitted within its duration of being started
+type ExamSession struct {
+	Id       ID `bson:"_id,omitempty" ts_type:"string"`
+	Name     string
+	Batch    string
+	Tests    []SessionTest
+	StartsAt time.Time `ts_type:"string"`
+	EndsAt   time.Time `ts_type:"string"`
+	// set once every candidate of the batch was told the session is over
+	Finished bool
+}
+
+type SessionTest struct {
+	TestId ID `ts_type:"string"`
+	// minutes. 0 uses the Duration of the test
+	Duration int
+}
+
+// a candidate's go at one test of a session. only the server's clock counts
+type Attempt struct {
+	Id        ID `bson:"_id,omitempty" ts_type:"string"`
+	SessionId ID `ts_type:"string"`
+	Username  string
+	TestId    ID `ts_type:"string"`
+	// counts up from 1 for each attempt of a user at a test. 0 for attempts from before
+	// they were numbered
+	Number    int
+	StartedAt time.Time `ts_type:"string"`
+	// StartedAt plus the test duration, but never after the end of the session. extra
+	// time given during the exam is added on top
+	Deadline time.Time `ts_type:"string"`
+	// minutes of extra time given so far
+	ExtraMinutes int
+	// zero until submitted
+	SubmittedAt time.Time `ts_type:"string"`
+	Late        bool
+}
+
+// live state of a candidate's app as the server sees it. shown to proctors
+type CandidatePresence struct {
+	Username  string
+	Batch     string
+	Connected bool
+	// start of the current connection, or of the last one while disconnected
+	ConnectedSince time.Time `ts_type:"string"`
+	// last time anything was heard from the app
+	LastSeen time.Time `ts_type:"string"`
+	Hostname string
+	OS       string
+	Route    string
+	OpenApp  string
+	// tests submitted since the server started
+	Submitted []ID `ts_type:"string[]"`
+}
+
+// something a candidate did during the exam, as recorded by the server
+type ActivityEvent struct {
+	Id       ID `bson:"_id,omitempty" ts_type:"string"`
+	Username string
+	// the attempt at TestId that was running, zero if none was
+	AttemptId ID `ts_type:"string"`
+	TestId    ID `ts_type:"string"`
+	Kind      ActivityKind
+	Detail    string
+	// when it happened on the candidate's machine
+	At time.Time `ts_type:"string"`
+	// when the server got it. far from At if the app was offline for a while
+	ReceivedAt time.Time `ts_type:"string"`
+}
+
+// copy of the document a candidate was working on for an office test, uploaded by the app
+// while the test runs. versions count up from 1 within an attempt
+type Snapshot struct {
+	Id        ID `bson:"_id,omitempty" ts_type:"string"`
+	Username  string
+	TestId    ID `ts_type:"string"`
+	AttemptId ID `ts_type:"string"`
+	Version   int
+	// the document in blob storage
+	FileHash string
+	Size     int64
+	TakenAt  time.Time `ts_type:"string"`
+}
+
+// what a candidate gets back when starting a test
+type AttemptStatus struct {
+	AttemptId ID        `ts_type:"string"`
+	TestId    ID        `ts_type:"string"`
+	Deadline  time.Time `ts_type:"string"`
+	// seconds left when the server answered. count down from this instead of comparing
+	// the candidate's clock with Deadline
+	Remaining int64
+}
+
 type MCQ struct {
 	Question string
 	Options  []string
-	Answer   string
+	// the correct option. either the option text, an option letter (A, B, ..) or a 1 based option number
+	Answer string
+	// marks for a correct answer. 0 means 1 mark
+	Marks float64 `json:",omitempty"`
+}
+type RuleKind string
+
+const (
+	// Index: 1 based paragraph number (empty paragraphs are not counted)
+	DocxParagraphBold RuleKind = "docx_paragraph_bold"
+	// Text: style name or id (e.g. "Heading 1")
+	DocxHeadingStyle RuleKind = "docx_heading_style"
+	// Count: number of columns
+	DocxTableColumns RuleKind = "docx_table_columns"
+	// Text: "landscape" or "portrait"
+	DocxOrientation RuleKind = "docx_orientation"
+	// Text: text that must appear in a page header
+	DocxHeaderContains RuleKind = "docx_header_contains"
+
+	// Sheet, Ref: cell, Text: expected value
+	XlsxCellEquals RuleKind = "xlsx_cell_equals"
+	// Sheet, Ref: cell, Text: function name (e.g. "SUM")
+	XlsxCellFormula RuleKind = "xlsx_cell_formula"
+	// Sheet, Ref: cell, Text: number format code (e.g. "0.00%")
+	XlsxNumberFormat RuleKind = "xlsx_number_format"
+	// Sheet, Ref: optional range the formatting must apply to
+	XlsxConditionalFormatting RuleKind = "xlsx_conditional_formatting"
+	// Sheet
+	XlsxChartExists RuleKind = "xlsx_chart_exists"
+	// Sheet, Ref: single column range, Text: "asc" (default) or "desc"
+	XlsxSortedRange RuleKind = "xlsx_sorted_range"
+	// Text: name, Ref: optional range the name must refer to
+	XlsxNamedRange RuleKind = "xlsx_named_range"
+
+	// for pptx rules Index is a 1 based slide number. 0 means any slide
+
+	// Count: exact number of slides
+	PptxSlideCount RuleKind = "pptx_slide_count"
+	// Index, Text: title of the slide
+	PptxSlideTitle RuleKind = "pptx_slide_title"
+	// Index, Text: layout name (e.g. "Title and Content")
+	PptxLayoutUsed RuleKind = "pptx_layout_used"
+	// Index, Count: minimum number of images (default 1)
+	PptxImageInserted RuleKind = "pptx_image_inserted"
+	// Index
+	PptxTransition RuleKind = "pptx_transition"
+	// Index
+	PptxAnimation RuleKind = "pptx_animation"
+	// Index
+	PptxSpeakerNotes RuleKind = "pptx_speaker_notes"
+	// Text: theme name. empty means any theme other than the default one
+	PptxThemeApplied RuleKind = "pptx_theme_applied"
+)
+
+func (self RuleKind) TSName() string {
+	switch self {
+	case DocxParagraphBold:
+		return "DocxParagraphBold"
+	case DocxHeadingStyle:
+		return "DocxHeadingStyle"
+	case DocxTableColumns:
+		return "DocxTableColumns"
+	case DocxOrientation:
+		return "DocxOrientation"
+	case DocxHeaderContains:
+		return "DocxHeaderContains"
+	case XlsxCellEquals:
+		return "XlsxCellEquals"
+	case XlsxCellFormula:
+		return "XlsxCellFormula"
+	case XlsxNumberFormat:
+		return "XlsxNumberFormat"
+	case XlsxConditionalFormatting:
+		return "XlsxConditionalFormatting"
+	case XlsxChartExists:
+		return "XlsxChartExists"
+	case XlsxSortedRange:
+		return "XlsxSortedRange"
+	case XlsxNamedRange:
+		return "XlsxNamedRange"
+	case PptxSlideCount:
+		return "PptxSlideCount"
+	case PptxSlideTitle:
+		return "PptxSlideTitle"
+	case PptxLayoutUsed:
+		return "PptxLayoutUsed"
+	case PptxImageInserted:
+		return "PptxImageInserted"
+	case PptxTransition:
+		return "PptxTransition"
+	case PptxAnimation:
+		return "PptxAnimation"
+	case PptxSpeakerNotes:
+		return "PptxSpeakerNotes"
+	case PptxThemeApplied:
+		return "PptxThemeApplied"
+	default:
+		return "Unknown"
+	}
+}
+
+// a single check that submissions are graded against. which of the parameters
+// are used depends on the Kind of the rule
+type RubricRule struct {
+	Kind        RuleKind
+	Description string
+	// marks awarded if the rule passes. 0 means 1 mark
+	Marks float64
+
+	Index int    `bson:"index,omitempty" json:"Index,omitempty"`
+	Count int    `bson:"count,omitempty" json:"Count,omitempty"`
+	Sheet string `bson:"sheet,omitempty" json:"Sheet,omitempty"`
+	// cell or range reference (e.g. "B2", "A1:C10")
+	Ref  string `bson:"ref,omitempty" json:"Ref,omitempty"`
+	Text string `bson:"text,omitempty" json:"Text,omitempty"`
 }
+
 type Test struct {
 	Id       ID `bson:"_id,omitempty" ts_type:"string"`
 	TestName string
@@ -65,28 +310,104 @@ type Test struct {
 	FilePath   string `bson:"file,omitempty" json:"FilePath,omitempty"`
 	TypingText string `bson:"typingtext,omitempty" json:"TypingText,omitempty"`
 	McqJson    string `bson:"mcqjson,omitempty" json:"McqJson,omitempty"`
+	// hash of the question material in blob storage. takes precedence over FilePath
+	FileHash string `bson:"filehash,omitempty" json:"FileHash,omitempty"`
+	// marks deducted for every wrong answer in a mcq test. unanswered questions are not penalised
+	NegativeMarks float64 `bson:"negativemarks,omitempty" json:"NegativeMarks,omitempty"`
+	// rules used to grade docx, xlsx and pptx submissions
+	Rubric []RubricRule `bson:"rubric,omitempty" json:"Rubric,omitempty"`
+	// empty is SubmitOnce
+	SubmissionPolicy SubmissionPolicy `bson:"submissionpolicy,omitempty" json:"SubmissionPolicy,omitempty"`
+	// attempts a candidate gets per exam session with SubmitMultiple. 0 for no limit
+	MaxAttempts int `bson:"maxattempts,omitempty" json:"MaxAttempts,omitempty"`
+}
+
+// test as it is delivered to candidates. this must never carry answers, reference files
+// or anything else used for grading. admin endpoints use Test directly
+type CandidateTest struct {
+	Id       ID `ts_type:"string"`
+	TestName string
+	Duration int
+
+	Type TestType
+	// question material shown to the candidate (not a reference solution)
+	FilePath   string `json:"FilePath,omitempty"`
+	TypingText string `json:"TypingText,omitempty"`
+	// json encoded []CandidateMCQ
+	McqJson string `json:"McqJson,omitempty"`
+	// tells the ui whether a submitted test can be opened again
+	SubmissionPolicy SubmissionPolicy `json:"SubmissionPolicy,omitempty"`
+}
+
+type CandidateMCQ struct {
+	Question string
+	Options  []string
+}
+
+func (t *Test) ToCandidateTest() (*CandidateTest, error) {
+	candidateTest := &CandidateTest{
+		Id:         t.Id,
+		TestName:   t.TestName,
+		Duration:   t.Duration,
+		Type:       t.Type,
+		FilePath:   t.FilePath,
+		TypingText: t.TypingText,
+
+		SubmissionPolicy: t.SubmissionPolicy,
+	}
+
+	if t.Type == MCQTest {
+		questions, err := t.GetMCQQuestions()
+		if err != nil {
+			return nil, err
+		}
+
+		candidateQuestions := make([]CandidateMCQ, len(questions))
+		for i, question := range questions {
+			candidateQuestions[i] = CandidateMCQ{
+				Question: question.Question,
+				Options:  question.Options,
+			}
+		}
+
+		jsonData, err := json.Marshal(candidateQuestions)
+		if err != nil {
+			return nil, err
+		}
+		candidateTest.McqJson = string(jsonData)
+	}
+
+	return candidateTest, nil
 }
 
 type User struct {
 	Id       ID `bson:"_id,omitempty" ts_type:"string"`
 	Username string
-	// TODO: plaintext password yo!
-	// passwords should be stored in another table hashed
-	Password string
+	// bcrypt hash. never sent to clients
+	Password string `json:"-"`
 	Batch    string
 }
 
 type AppTestInfo struct {
-	FileData string
+	// base64 encoded file as sent by the application. the server moves it to blob
+	// storage and only keeps FileHash
+	FileData string `bson:"filedata,omitempty" json:"FileData,omitempty"`
+	FileHash string `bson:"filehash,omitempty" json:"FileHash,omitempty"`
 }
 type McqTestInfo struct {
 	Answers []*int // indices to answers
 }
 type TypingTestInfo struct {
+	// text exactly as typed by the candidate
+	TypedText string
+	// seconds
 	TimeTaken float64
-	WPM       float64
-	RawWPM    float64
-	Accuracy  float64
+
+	// computed by the client. the server recomputes these from TypedText and only
+	// keeps these for comparison
+	WPM      float64
+	RawWPM   float64
+	Accuracy float64
 }
 type TestInfo struct {
 	Type           TestType
@@ -98,12 +419,81 @@ type TestInfo struct {
 }
 
 type TestSubmission struct {
+	Id     ID `bson:"_id,omitempty" json:"Id,omitempty" ts_type:"string"`
 	UserId ID `ts_type:"string"`
 	TestId ID `ts_type:"string"`
+	// made up by the app once per submission and kept when the upload is retried. the server
+	// stores a submission only once, however often it arrives
+	ClientSubmissionId string `bson:"clientsubmissionid,omitempty" json:"ClientSubmissionId,omitempty"`
+
+	// filled in by the server from the candidate's attempt
+	Username      string    `bson:"username,omitempty" json:"Username,omitempty"`
+	AttemptId     ID        `json:"AttemptId,omitempty" ts_type:"string"`
+	AttemptNumber int       `bson:"attemptnumber,omitempty" json:"AttemptNumber,omitempty"`
+	SubmittedAt   time.Time `json:"SubmittedAt,omitempty" ts_type:"string"`
+	// submitted after the deadline, within the grace period
+	Late bool `json:"Late,omitempty"`
+	// a later submission of the same attempt replaced this one (SubmitLastWins). stored even
+	// when false, the unique index on the submissions that count relies on it
+	Superseded bool `json:"Superseded,omitempty"`
 
 	TestInfo TestInfo
 }
 
+type QuestionResult struct {
+	Answer  *int
+	Correct bool
+	Marks   float64
+}
+
+type RuleResult struct {
+	Kind        RuleKind
+	Description string
+	Passed      bool
+	Marks       float64
+	// why the rule failed
+	Detail string `bson:"detail,omitempty" json:"Detail,omitempty"`
+}
+
+// typing test scores computed by the server
+type TypingResult struct {
+	// seconds, as measured by the server
+	TimeTaken float64
+	// seconds, as reported by the client. only compared against TimeTaken
+	ClientTimeTaken float64
+
+	TypedChars   int
+	CorrectChars int
+	CharErrors   int
+	TypedWords   int
+	WordErrors   int
+
+	GrossWPM float64
+	NetWPM   float64
+	Accuracy float64
+
+	// client reported numbers differ from the ones computed here
+	Mismatch       bool
+	MismatchFields []string
+}
+
+// graded result of a submission
+type Result struct {
+	Id           ID `bson:"_id,omitempty" ts_type:"string"`
+	SubmissionId ID `ts_type:"string"`
+	UserId       ID `ts_type:"string"`
+	TestId       ID `ts_type:"string"`
+
+	Score    float64
+	MaxScore float64
+
+	Questions []QuestionResult `bson:"questions,omitempty" json:"Questions,omitempty"`
+	Typing    *TypingResult    `bson:"typing,omitempty" json:"Typing,omitempty"`
+	Rules     []RuleResult     `bson:"rules,omitempty" json:"Rules,omitempty"`
+	// the submission was replaced by a later one and does not count
+	Superseded bool `bson:"superseded,omitempty" json:"Superseded,omitempty"`
+}
+
 // type UserModelUpdateRequest struct {
 // 	Id           ID
 // 	Username     string
@@ -119,8 +509,41 @@ type TestSubmission struct {
 // }
 
 type UserLoginResponse struct {
-	Jwt  string
-	User User
+	// short lived access token
+	Jwt string
+	// trade for a new Jwt (and RefreshToken) at /user/refresh once Jwt expires
+	RefreshToken string
+	User         User
+}
+
+type UserRefreshRequest struct {
+	RefreshToken string
+}
+
+// what happens when a candidate submits a test again
+type SubmissionPolicy string
+
+const (
+	// one submission per attempt
+	SubmitOnce SubmissionPolicy = "single"
+	// resubmitting until the deadline replaces the earlier submission
+	SubmitLastWins SubmissionPolicy = "last_wins"
+	// every submission ends its attempt and is graded. the candidate can start another
+	// attempt, up to MaxAttempts
+	SubmitMultiple SubmissionPolicy = "multiple"
+)
+
+func (self SubmissionPolicy) TSName() string {
+	switch self {
+	case SubmitOnce:
+		return "SubmitOnce"
+	case SubmitLastWins:
+		return "SubmitLastWins"
+	case SubmitMultiple:
+		return "SubmitMultiple"
+	default:
+		return "Unknown"
+	}
 }
 
 type TestType string
@@ -150,31 +573,6 @@ func (self TestType) TSName() string {
 	}
 }
 
-func FindAdminByUsername(collection *mongo.Collection, username string) (*Admin, error) {
-	filter := bson.M{"username": username}
-
-	var admin Admin
-	err := collection.FindOne(context.TODO(), filter).Decode(&admin)
-	if err != nil {
-		return nil, err
-	}
-
-	return &admin, nil
-}
-
-func FindByUsername(Collection *mongo.Collection, userName string) (*User, error) {
-
-	filter := bson.M{"username": userName}
-
-	var user User
-	err := Collection.FindOne(context.TODO(), filter).Decode(&user)
-	if err != nil {
-		return nil, err
-	}
-
-	return &user, nil
-}
-
 func (t *Test) SetMCQQuestions(questions []MCQ) error {
 	jsonData, err := json.Marshal(questions)
 	if err != nil {
@@ -192,8 +590,3 @@ func (t *Test) GetMCQQuestions() ([]MCQ, error) {
 	err := json.Unmarshal([]byte(t.McqJson), &questions)
 	return questions, err
 }
-
-func GetCollection(client *mongo.Client, collectionName string) *mongo.Collection {
-	dbName := os.Getenv("DB_NAME")
-	return client.Database(dbName).Collection(collectionName)
-}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"time"
 
 	"github.com/tkrajina/typescriptify-golang-structs/typescriptify"
 )
@@ -39,6 +40,12 @@ const (
 	CheckSystem
 	OpenApp
 	QuitApp
+	DeadlineChanged
+	Presence
+	Activity
+	SubmissionStatus
+	ResumeSession
+	RestoreSnapshot
 	Unknown // NOTE: keep this as the last constant here.
 )
 
@@ -70,6 +77,18 @@ func (self Varient) TSName() string {
 		return "OpenApp"
 	case QuitApp:
 		return "QuitApp"
+	case DeadlineChanged:
+		return "DeadlineChanged"
+	case Presence:
+		return "Presence"
+	case Activity:
+		return "Activity"
+	case SubmissionStatus:
+		return "SubmissionStatus"
+	case ResumeSession:
+		return "ResumeSession"
+	case RestoreSnapshot:
+		return "RestoreSnapshot"
 	default:
 		return "Unknown"
 	}
@@ -102,6 +121,18 @@ func varientFromName(typ string) Varient {
 		return OpenApp
 	case "QuitApp":
 		return QuitApp
+	case "DeadlineChanged":
+		return DeadlineChanged
+	case "Presence":
+		return Presence
+	case "Activity":
+		return Activity
+	case "SubmissionStatus":
+		return SubmissionStatus
+	case "ResumeSession":
+		return ResumeSession
+	case "RestoreSnapshot":
+		return RestoreSnapshot
 	default:
 		return Unknown
 	}
@@ -147,7 +178,8 @@ type TReloadUi struct{}
 
 type TStartTest struct{}
 
-// TODO: Send this to every client from server when time ends and submit whatever stuff the client can submit
+// every test is over. the server sends it when the exam session ends or a proctor ends it,
+// the app then submits whatever is left and passes it on to the ui
 type TTestFinished struct{}
 
 type AppType int
@@ -181,6 +213,122 @@ type TOpenApp struct {
 
 type TQuitApp struct{}
 
+// the server moved the deadline of a started test, e.g. a proctor gave extra time
+type TDeadlineChanged struct {
+	TestId ID `ts_type:"string"`
+	// seconds left
+	Remaining int64
+	// minutes added
+	Minutes int
+}
+
+// what the candidate's machine is doing. the app sends it to the server when it connects and
+// whenever something changes
+type TPresence struct {
+	Hostname string
+	OS       string
+	// route of the ui, e.g. /tests
+	Route string
+	// app the candidate is working in (e.g. DOCX). empty while none is open
+	OpenApp string
+}
+
+type ActivityKind string
+
+const (
+	ActivityTestOpened  ActivityKind = "test_opened"
+	ActivityAppLaunched ActivityKind = "app_launched"
+	ActivityAppClosed   ActivityKind = "app_closed"
+	// the exam window lost focus
+	ActivityFocusLost ActivityKind = "focus_lost"
+	// Detail: title of the window that was hidden
+	ActivityForeignWindow ActivityKind = "foreign_window"
+	// Detail: "ok" or why the submission failed
+	ActivitySubmissionAttempted ActivityKind = "submission_attempted"
+)
+
+func (self ActivityKind) TSName() string {
+	switch self {
+	case ActivityTestOpened:
+		return "TestOpened"
+	case ActivityAppLaunched:
+		return "AppLaunched"
+	case ActivityAppClosed:
+		return "AppClosed"
+	case ActivityFocusLost:
+		return "FocusLost"
+	case ActivityForeignWindow:
+		return "ForeignWindow"
+	case ActivitySubmissionAttempted:
+		return "SubmissionAttempted"
+	default:
+		return "Unknown"
+	}
+}
+
+// something the candidate did during the exam. the app sends these to the server, which keeps
+// them as evidence for the examiners
+type TActivity struct {
+	Kind ActivityKind
+	// test the candidate was working on, if any
+	TestId ID `ts_type:"string"`
+	Detail string
+	// when it happened on the candidate's machine
+	At time.Time `ts_type:"string"`
+}
+
+type SyncStatus string
+
+const (
+	// saved on the candidate's machine, waiting for the server
+	SyncQueued   SyncStatus = "queued"
+	SyncUploaded SyncStatus = "uploaded"
+	// the server refused it. sending it again won't help
+	SyncRejected SyncStatus = "rejected"
+)
+
+func (self SyncStatus) TSName() string {
+	switch self {
+	case SyncQueued:
+		return "Queued"
+	case SyncUploaded:
+		return "Uploaded"
+	case SyncRejected:
+		return "Rejected"
+	default:
+		return "Unknown"
+	}
+}
+
+// where a submission is on its way to the server. the app sends it to the ui whenever it
+// changes
+type TSubmissionStatus struct {
+	TestId ID `ts_type:"string"`
+	Status SyncStatus
+	// why the last upload failed, if it did
+	Message string
+}
+
+// a session that was cut short (e.g. by a crash or a power cut) and can be picked up again.
+// the ui gets it from the app's /get-resumable and answers with a ResumeSession message
+type ResumableSession struct {
+	Username string
+	SavedAt  time.Time `ts_type:"string"`
+}
+
+// Resume false throws the saved session away
+type TResumeSession struct {
+	Resume bool
+}
+
+// a proctor restored the latest snapshot of the candidate's document for a test, e.g. on a
+// replacement machine. the app fetches it from the server's blob storage and continues with it
+type TRestoreSnapshot struct {
+	TestId   ID `ts_type:"string"`
+	FileHash string
+	Version  int
+}
+
 func NewMessage(typ interface{}) Message {
 	name := reflect.TypeOf(typ).Name()[1:]
 	varient := varientFromName(name)
@@ -232,7 +380,23 @@ func DumpTypes(dir string) {
 		Add(TCheckSystem{}).
 		Add(TOpenApp{}).
 		Add(TQuitApp{}).
+		Add(TDeadlineChanged{}).
+		Add(TPresence{}).
+		Add(TActivity{}).
+		Add(TSubmissionStatus{}).
+		Add(ResumableSession{}).
+		Add(TResumeSession{}).
+		Add(TRestoreSnapshot{}).
 		AddEnum([]AppType{TXT, DOCX, XLSX, PPTX}).
+		AddEnum([]SyncStatus{SyncQueued, SyncUploaded, SyncRejected}).
+		AddEnum([]ActivityKind{
+			ActivityTestOpened,
+			ActivityAppLaunched,
+			ActivityAppClosed,
+			ActivityFocusLost,
+			ActivityForeignWindow,
+			ActivitySubmissionAttempted,
+		}).
 		AddEnum(allVarients)
 
 	converter = converter.
@@ -243,10 +407,43 @@ func DumpTypes(dir string) {
 		Add(McqTestInfo{}).
 		// Add(UserBatchRequestData{}).
 		Add(Test{}).
+		Add(CandidateTest{}).
+		Add(CandidateMCQ{}).
 		Add(Admin{}).
 		// Add(AdminRequest{}).
 		Add(Batch{}).
-		AddEnum([]TestType{TypingTest, DocxTest, ExcelTest, PptTest, MCQTest})
+		Add(ExamSession{}).
+		Add(Attempt{}).
+		Add(AttemptStatus{}).
+		Add(CandidatePresence{}).
+		Add(ActivityEvent{}).
+		Add(Snapshot{}).
+		Add(Result{}).
+		AddEnum([]TestType{TypingTest, DocxTest, ExcelTest, PptTest, MCQTest}).
+		AddEnum([]AdminRole{SuperAdmin, ExamManager, Proctor, Grader, Auditor}).
+		AddEnum([]SubmissionPolicy{SubmitOnce, SubmitLastWins, SubmitMultiple}).
+		AddEnum([]RuleKind{
+			DocxParagraphBold,
+			DocxHeadingStyle,
+			DocxTableColumns,
+			DocxOrientation,
+			DocxHeaderContains,
+			XlsxCellEquals,
+			XlsxCellFormula,
+			XlsxNumberFormat,
+			XlsxConditionalFormatting,
+			XlsxChartExists,
+			XlsxSortedRange,
+			XlsxNamedRange,
+			PptxSlideCount,
+			PptxSlideTitle,
+			PptxLayoutUsed,
+			PptxImageInserted,
+			PptxTransition,
+			PptxAnimation,
+			PptxSpeakerNotes,
+			PptxThemeApplied,
+		})
 
 	err := os.MkdirAll(dir, 0755)
 	if err != nil {
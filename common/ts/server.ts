@@ -45,6 +45,24 @@ export type Message = {
 } | {
     Typ: types.Varient.QuitApp,
     Val: types.TQuitApp,
+} | {
+    Typ: types.Varient.DeadlineChanged,
+    Val: types.TDeadlineChanged,
+} | {
+    Typ: types.Varient.Presence,
+    Val: types.TPresence,
+} | {
+    Typ: types.Varient.Activity,
+    Val: types.TActivity,
+} | {
+    Typ: types.Varient.SubmissionStatus,
+    Val: types.TSubmissionStatus,
+} | {
+    Typ: types.Varient.ResumeSession,
+    Val: types.TResumeSession,
+} | {
+    Typ: types.Varient.RestoreSnapshot,
+    Val: types.TRestoreSnapshot,
 } | {
     Typ: types.Varient.Unknown,
     Val: unknown,
@@ -136,6 +154,8 @@ export class Server {
             case types.Varient.WarnUser:
             case types.Varient.StartTest:
             case types.Varient.TestFinished:
+            case types.Varient.DeadlineChanged:
+            case types.Varient.SubmissionStatus:
                 break;
             case types.Varient.ReloadUi:
                 window.location.href = "/";
@@ -148,6 +168,10 @@ export class Server {
                 this.send_message(msg);
                 break;
             case types.Varient.Unknown:
+            case types.Varient.Presence:
+            case types.Varient.Activity:
+            case types.Varient.ResumeSession:
+            case types.Varient.RestoreSnapshot:
             case types.Varient.UserLoginRequest: {
                 throw new Error(`message type '${msg.Typ}' can't be handled here`);
             } break;
@@ -164,6 +188,27 @@ export class Server {
     }
 }
 
+// keeps the app up to date with answers that are not submitted yet, so it can submit them
+// if the exam ends before the candidate does. the app fills in the UserId
+export async function save_draft(test: types.CandidateTest, info: types.TestInfo) {
+    let draft: types.TestSubmission = {
+        UserId: "",
+        TestId: test.Id,
+        TestInfo: info,
+    };
+    try {
+        await fetch(base_url + "/save-draft", {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(draft),
+        });
+    } catch (e) {
+        console.error("could not save draft:", e);
+    }
+}
+
 // @ts-ignore
 export let server: Server = null;
 export async function init() {
@@ -7,6 +7,19 @@ export enum AppType {
     XLSX = 2,
     PPTX = 3,
 }
+export enum SyncStatus {
+    Queued = "queued",
+    Uploaded = "uploaded",
+    Rejected = "rejected",
+}
+export enum ActivityKind {
+    TestOpened = "test_opened",
+    AppLaunched = "app_launched",
+    AppClosed = "app_closed",
+    FocusLost = "focus_lost",
+    ForeignWindow = "foreign_window",
+    SubmissionAttempted = "submission_attempted",
+}
 export enum Varient {
     Err = 0,
     Notification = 1,
@@ -21,7 +34,13 @@ export enum Varient {
     CheckSystem = 10,
     OpenApp = 11,
     QuitApp = 12,
-    Unknown = 13,
+    DeadlineChanged = 13,
+    Presence = 14,
+    Activity = 15,
+    SubmissionStatus = 16,
+    ResumeSession = 17,
+    RestoreSnapshot = 18,
+    Unknown = 19,
 }
 export enum TestType {
     TypingTest = "typing",
@@ -30,6 +49,40 @@ export enum TestType {
     PptTest = "pptx",
     MCQTest = "mcq",
 }
+export enum AdminRole {
+    SuperAdmin = "super_admin",
+    ExamManager = "exam_manager",
+    Proctor = "proctor",
+    Grader = "grader",
+    Auditor = "auditor",
+}
+export enum SubmissionPolicy {
+    SubmitOnce = "single",
+    SubmitLastWins = "last_wins",
+    SubmitMultiple = "multiple",
+}
+export enum RuleKind {
+    DocxParagraphBold = "docx_paragraph_bold",
+    DocxHeadingStyle = "docx_heading_style",
+    DocxTableColumns = "docx_table_columns",
+    DocxOrientation = "docx_orientation",
+    DocxHeaderContains = "docx_header_contains",
+    XlsxCellEquals = "xlsx_cell_equals",
+    XlsxCellFormula = "xlsx_cell_formula",
+    XlsxNumberFormat = "xlsx_number_format",
+    XlsxConditionalFormatting = "xlsx_conditional_formatting",
+    XlsxChartExists = "xlsx_chart_exists",
+    XlsxSortedRange = "xlsx_sorted_range",
+    XlsxNamedRange = "xlsx_named_range",
+    PptxSlideCount = "pptx_slide_count",
+    PptxSlideTitle = "pptx_slide_title",
+    PptxLayoutUsed = "pptx_layout_used",
+    PptxImageInserted = "pptx_image_inserted",
+    PptxTransition = "pptx_transition",
+    PptxAnimation = "pptx_animation",
+    PptxSpeakerNotes = "pptx_speaker_notes",
+    PptxThemeApplied = "pptx_theme_applied",
+}
 export interface TErr {
     Message: string;
 }
@@ -76,20 +129,55 @@ export interface TOpenApp {
 }
 export interface TQuitApp {
 
+}
+export interface TDeadlineChanged {
+    TestId: string;
+    Remaining: number;
+    Minutes: number;
+}
+export interface TPresence {
+    Hostname: string;
+    OS: string;
+    Route: string;
+    OpenApp: string;
+}
+export interface TActivity {
+    Kind: ActivityKind;
+    TestId: string;
+    Detail: string;
+    At: string;
+}
+export interface TSubmissionStatus {
+    TestId: string;
+    Status: SyncStatus;
+    Message: string;
+}
+export interface ResumableSession {
+    Username: string;
+    SavedAt: string;
+}
+export interface TResumeSession {
+    Resume: boolean;
+}
+export interface TRestoreSnapshot {
+    TestId: string;
+    FileHash: string;
+    Version: number;
 }
 export interface User {
     Id: string;
     Username: string;
-    Password: string;
     Batch: string;
 }
 export interface AppTestInfo {
-    FileData: string;
+    FileData?: string;
+    FileHash?: string;
 }
 export interface McqTestInfo {
     Answers: number[];
 }
 export interface TypingTestInfo {
+    TypedText: string;
     TimeTaken: number;
     WPM: number;
     RawWPM: number;
@@ -104,13 +192,31 @@ export interface TestInfo {
     PptTestInfo?: AppTestInfo;
 }
 export interface TestSubmission {
+    Id?: string;
     UserId: string;
     TestId: string;
+    ClientSubmissionId?: string;
+    Username?: string;
+    AttemptId?: string;
+    AttemptNumber?: number;
+    SubmittedAt?: string;
+    Late?: boolean;
+    Superseded?: boolean;
     TestInfo: TestInfo;
 }
 
 
 
+export interface RubricRule {
+    Kind: RuleKind;
+    Description: string;
+    Marks: number;
+    Index?: number;
+    Count?: number;
+    Sheet?: string;
+    Ref?: string;
+    Text?: string;
+}
 export interface Test {
     Id: string;
     TestName: string;
@@ -119,14 +225,135 @@ export interface Test {
     FilePath?: string;
     TypingText?: string;
     McqJson?: string;
+    FileHash?: string;
+    NegativeMarks?: number;
+    Rubric?: RubricRule[];
+    SubmissionPolicy?: SubmissionPolicy;
+    MaxAttempts?: number;
+}
+export interface CandidateTest {
+    Id: string;
+    TestName: string;
+    Duration: number;
+    Type: TestType;
+    FilePath?: string;
+    TypingText?: string;
+    McqJson?: string;
+    SubmissionPolicy?: SubmissionPolicy;
+}
+export interface CandidateMCQ {
+    Question: string;
+    Options: string[];
 }
 export interface Admin {
     Id: string;
     Username: string;
     Password: string;
+    Role: AdminRole;
 }
 export interface Batch {
     Id: string;
     Name: string;
     Tests: string[];
+}
+export interface SessionTest {
+    TestId: string;
+    Duration: number;
+}
+export interface ExamSession {
+    Id: string;
+    Name: string;
+    Batch: string;
+    Tests: SessionTest[];
+    StartsAt: string;
+    EndsAt: string;
+    Finished: boolean;
+}
+export interface Attempt {
+    Id: string;
+    SessionId: string;
+    Username: string;
+    TestId: string;
+    Number: number;
+    StartedAt: string;
+    Deadline: string;
+    ExtraMinutes: number;
+    SubmittedAt: string;
+    Late: boolean;
+}
+export interface AttemptStatus {
+    AttemptId: string;
+    TestId: string;
+    Deadline: string;
+    Remaining: number;
+}
+export interface CandidatePresence {
+    Username: string;
+    Batch: string;
+    Connected: boolean;
+    ConnectedSince: string;
+    LastSeen: string;
+    Hostname: string;
+    OS: string;
+    Route: string;
+    OpenApp: string;
+    Submitted: string[];
+}
+export interface ActivityEvent {
+    Id: string;
+    Username: string;
+    AttemptId: string;
+    TestId: string;
+    Kind: ActivityKind;
+    Detail: string;
+    At: string;
+    ReceivedAt: string;
+}
+export interface Snapshot {
+    Id: string;
+    Username: string;
+    TestId: string;
+    AttemptId: string;
+    Version: number;
+    FileHash: string;
+    Size: number;
+    TakenAt: string;
+}
+export interface RuleResult {
+    Kind: RuleKind;
+    Description: string;
+    Passed: boolean;
+    Marks: number;
+    Detail?: string;
+}
+export interface TypingResult {
+    TimeTaken: number;
+    ClientTimeTaken: number;
+    TypedChars: number;
+    CorrectChars: number;
+    CharErrors: number;
+    TypedWords: number;
+    WordErrors: number;
+    GrossWPM: number;
+    NetWPM: number;
+    Accuracy: number;
+    Mismatch: boolean;
+    MismatchFields: string[];
+}
+export interface QuestionResult {
+    Answer: number;
+    Correct: boolean;
+    Marks: number;
+}
+export interface Result {
+    Id: string;
+    SubmissionId: string;
+    UserId: string;
+    TestId: string;
+    Score: number;
+    MaxScore: number;
+    Questions?: QuestionResult[];
+    Typing?: TypingResult;
+    Rules?: RuleResult[];
+    Superseded?: boolean;
 }
\ No newline at end of file
@@ -13,7 +13,7 @@ const appMapping = {
 };
 
 interface DocumentTestsProps {
-  testData: types.Test;
+  testData: types.CandidateTest;
   handleFinishTest: () => void;
 }
 
@@ -21,7 +21,7 @@ export default function DocumentTests({
   testData,
   handleFinishTest,
 }: DocumentTestsProps) {
-  const handleOpenApp = (app: types.Test) => {
+  const handleOpenApp = (app: types.CandidateTest) => {
     /// @ts-ignore
     let typ: types.AppType = appMapping[testData.Type].appType;
     server.server.send_message({
@@ -100,7 +100,7 @@ export default function DocumentTests({
         </div>
         <div className='flex-grow overflow-auto'>
           <img
-            src={testData.FilePath}
+            src={server.base_url + "/test-file?id=" + testData.Id}
             alt={`${testData.Id} Test`}
             className="w-full h-full object-contain"
           />
@@ -1,4 +1,4 @@
-import { useState } from 'react';
+import { useEffect, useState } from 'react';
 import { ChevronLeft, ChevronRight } from 'lucide-react';
 import { Button } from './ui/button';
 import { Card, CardContent, CardHeader, CardTitle } from './ui/card';
@@ -7,11 +7,8 @@ import * as server from '@common/server';
 import * as types from '@common/types';
 
 interface MCQTestProps {
-    Test: types.Test,
-    testData: {
-        question: string;
-        options: string[];
-    }[];
+    Test: types.CandidateTest,
+    testData: types.CandidateMCQ[];
     handleFinishTest: () => void;
 }
 
@@ -25,6 +22,15 @@ export default function MCQTest({
 
 
 
+    useEffect(() => {
+        server.save_draft(Test, {
+            Type: Test.Type,
+            McqTestInfo: {
+                Answers: answers,
+            }
+        });
+    }, [answers]);
+
     const handleAnswerSelect = (index: number) => {
         const newAnswers = [...answers];
         newAnswers[currentQuestion] = index;
@@ -67,9 +73,9 @@ export default function MCQTest({
             </CardHeader>
             <CardContent>
                 <div className="mb-6">
-                    <p className="text-lg text-primary font-medium mb-4">{testData[currentQuestion].question}</p>
+                    <p className="text-lg text-primary font-medium mb-4">{testData[currentQuestion].Question}</p>
                     <div className="space-y-2">
-                        {testData[currentQuestion].options.map((option, index) => (
+                        {testData[currentQuestion].Options.map((option, index) => (
                             <Button
                                 key={index}
                                 onClick={() => handleAnswerSelect(index)}
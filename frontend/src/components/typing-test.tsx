@@ -9,7 +9,7 @@ import * as types from "@common/types";
 import * as server from '@common/server';
 
 interface TypingTestProps {
-    testData: types.Test,
+    testData: types.CandidateTest,
     typingText: string;
     handleFinishTest: () => void;
     isTestActive: boolean;
@@ -92,6 +92,26 @@ export default function TypingTest({
         }
     }, [inputText, timeLeft, isStarted]);
 
+    // a second after the candidate stops typing
+    useEffect(() => {
+        if (!isStarted) {
+            return;
+        }
+        const timeout = setTimeout(() => {
+            const timeTaken = testime - timeLeft;
+            server.save_draft(testData, {
+                Type: testData.Type,
+                TypingTestInfo: {
+                    TypedText: inputText,
+                    TimeTaken: timeTaken,
+                    ...calculateScores(inputText, typingText, timeTaken),
+                },
+            });
+        }, 1000);
+
+        return () => clearTimeout(timeout);
+    }, [inputText, isStarted]);
+
     const handleStart = () => {
         setIsStarted(true);
         setIsTestActive(true);
@@ -114,11 +134,11 @@ export default function TypingTest({
         console.log('TotalCharsTyped:', totalCharsTyped);
         console.log('TotalCorrectCharacters:', totalCorrectCharacters);
 
+        const timeTaken = testime - timeLeft;
         const result: types.TypingTestInfo = {
-            TimeTaken: testime - timeLeft,
-            WPM: wpm,
-            RawWPM: rawWPM,
-            Accuracy: calculateAccuracy(inputText, typingText)
+            TypedText: inputText,
+            TimeTaken: timeTaken,
+            ...calculateScores(inputText, typingText, timeTaken),
         }
         console.log('Submitting results:', result);
         let resp = await fetch(server.base_url + "/get-user");
@@ -142,11 +162,26 @@ export default function TypingTest({
         handleFinishTest();
     };
 
-    const calculateAccuracy = (input: string, original: string) => {
-        const inputWords = input.trim().split(/\s+/);
-        const originalWords = original.trim().split(/\s+/);
-        const correctWords = inputWords.filter((word, index) => word === originalWords[index]);
-        return Math.round((correctWords.length / originalWords.length) * 100);
+    // same algorithm as the server. the server recomputes these and flags any mismatch
+    const calculateScores = (input: string, original: string, seconds: number) => {
+        const typed = Array.from(input);
+        const expected = Array.from(original);
+        const correctChars = typed.filter((char, index) => char === expected[index]).length;
+
+        const inputWords = input.split(/\s+/).filter(word => word.length > 0);
+        const originalWords = original.split(/\s+/).filter(word => word.length > 0);
+        const wordErrors = inputWords.filter((word, index) => word !== originalWords[index]).length;
+
+        const minutes = seconds / 60;
+        const rawWPM = minutes > 0 ? (typed.length / 5) / minutes : 0;
+        const wpm = minutes > 0 ? Math.max(0, rawWPM - wordErrors / minutes) : 0;
+        const accuracy = typed.length > 0 ? (correctChars / typed.length) * 100 : 0;
+
+        return {
+            RawWPM: Math.round(rawWPM * 100) / 100,
+            WPM: Math.round(wpm * 100) / 100,
+            Accuracy: Math.round(accuracy * 100) / 100,
+        };
     };
 
     const getHighlightedText = () => {
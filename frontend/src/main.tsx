@@ -87,7 +87,22 @@ function WebSocketHandler() {
       disable.push(d);
     });
 
+    // the examiners get to see when the candidate left the exam window
+    const onBlur = () => {
+      server.server.send_message({
+        Typ: types.Varient.Activity,
+        Val: {
+          Kind: types.ActivityKind.FocusLost,
+          TestId: "",
+          Detail: window.location.hash,
+          At: new Date().toISOString(),
+        },
+      });
+    };
+    window.addEventListener('blur', onBlur);
+
     return () => {
+      window.removeEventListener('blur', onBlur);
       for (let fn of disable) {
         fn();
       }
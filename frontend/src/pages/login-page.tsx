@@ -1,8 +1,10 @@
+import { useEffect, useState } from 'react';
 import { UserIcon, KeyIcon,  } from 'lucide-react';
 import { Button } from '@/components/ui/button';
 import { useStateContext } from '@/context/app-context';
-import { server } from '@common/server';
+import { base_url, server } from '@common/server';
 import * as types from '@common/types';
+import { AlertDialog, AlertDialogAction, AlertDialogCancel, AlertDialogContent, AlertDialogDescription, AlertDialogFooter, AlertDialogHeader, AlertDialogTitle } from '@/components/ui/alert-dialog';
 
 
 
@@ -15,6 +17,29 @@ export default function LoginPage() {
     setUserPassword,
   } = useStateContext();
 
+  // the app was closed in the middle of an exam (crash, power cut, ...)
+  const [resumable, setResumable] = useState<types.ResumableSession | null>(null);
+
+  useEffect(() => {
+    fetch(base_url + "/get-resumable")
+      .then(r => r.json())
+      .then((session: types.ResumableSession | null) => setResumable(session))
+      .catch(err => console.error("could not check for a saved session:", err));
+  }, []);
+
+  const handleResume = (resume: boolean) => {
+    if (resume && resumable !== null) {
+      setUsername(resumable.Username);
+    }
+    server.send_message({
+      Typ: types.Varient.ResumeSession,
+      Val: {
+        Resume: resume,
+      }
+    });
+    setResumable(null);
+  };
+
   const handleSubmit = (e: React.FormEvent) => {
     e.preventDefault();
     server.send_message({
@@ -110,6 +135,22 @@ export default function LoginPage() {
           </div>
         </form>
       </div>
+
+      <AlertDialog open={resumable !== null}>
+        <AlertDialogContent>
+          <AlertDialogHeader>
+            <AlertDialogTitle>Resume your exam?</AlertDialogTitle>
+            <AlertDialogDescription>
+              The exam of {resumable?.Username} was interrupted at {resumable && new Date(resumable.SavedAt).toLocaleTimeString()}.
+              Resume to continue with your saved work. Start over to log in again.
+            </AlertDialogDescription>
+          </AlertDialogHeader>
+          <AlertDialogFooter>
+            <AlertDialogCancel onClick={() => handleResume(false)}>Start over</AlertDialogCancel>
+            <AlertDialogAction onClick={() => handleResume(true)}>Resume</AlertDialogAction>
+          </AlertDialogFooter>
+        </AlertDialogContent>
+      </AlertDialog>
     </div>
   );
 }
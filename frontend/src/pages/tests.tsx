@@ -5,16 +5,18 @@ import TypingTest from "@/components/typing-test";
 import MCQTest from '@/components/mcq-test';
 import { Button } from "@/components/ui/button";
 import * as types from "@common/types";
-import { CheckCircle, UserIcon } from 'lucide-react';
+import { AlertTriangle, CheckCircle, CloudUpload, UserIcon } from 'lucide-react';
 import * as server from "@common/server.ts";
 import { useStateContext } from '@/context/app-context';
 import { AlertDialog, AlertDialogAction, AlertDialogCancel, AlertDialogContent, AlertDialogDescription, AlertDialogFooter, AlertDialogHeader, AlertDialogTitle } from '@/components/ui/alert-dialog';
 
 
 export default function TestsPage() {
-    const [testData, setTestData] = useState<types.Test[]>([]);
+    const [testData, setTestData] = useState<types.CandidateTest[]>([]);
     const [selectedTestIndex, setSelectedTestIndex] = useState<number | null>(0);
     const [completedTests, setCompletedTests] = useState<string[]>([]);
+    // where each submitted test is on its way to the server, by test id
+    const [syncStatus, setSyncStatus] = useState<Record<string, types.TSubmissionStatus>>({});
 
     const [showConfirmDialog, setShowConfirmDialog] = useState(false);
     const [isTestActive, setIsTestActive] = useState(false);
@@ -26,17 +28,117 @@ export default function TestsPage() {
     const startXRef = useRef<number>(0);
     const startWidthRef = useRef<number>(0);
 
-    const [timeLeft, setTimeLeft] = useState(3600); // 1 hour in seconds
+    // seconds left for the selected test, as told by the server. null until it answers
+    const [timeLeft, setTimeLeft] = useState<number | null>(null);
 
     useEffect(() => {
         const timer = setInterval(() => {
-            setTimeLeft((prevTime) => (prevTime > 0 ? prevTime - 1 : 0));
+            setTimeLeft((prevTime) => (prevTime !== null && prevTime > 0 ? prevTime - 1 : prevTime));
         }, 1000);
 
         return () => clearInterval(timer);
     }, []);
 
-    const formatTime = (seconds: number) => {
+    // opening a test starts its clock on the server. opening it again (e.g. after a restart)
+    // continues the same clock
+    useEffect(() => {
+        if (selectedTestIndex === null || !testData[selectedTestIndex]) {
+            return;
+        }
+        setTimeLeft(null);
+        fetch(server.base_url + "/start-test?id=" + testData[selectedTestIndex].Id)
+            .then(r => r.ok ? r.json() : Promise.reject(r.statusText))
+            .then((status: types.AttemptStatus) => setTimeLeft(status.Remaining))
+            .catch(err => console.error("could not start test:", err));
+    }, [selectedTestIndex, testData]);
+
+    // a proctor gave extra time
+    useEffect(() => {
+        let disable: (() => PromiseLike<void>) | null = null;
+        server.server.add_callback(types.Varient.DeadlineChanged, async (res) => {
+            if (selectedTestIndex !== null && testData[selectedTestIndex]?.Id === res.TestId) {
+                setTimeLeft(res.Remaining);
+            }
+        }).then(d => {
+            disable = d;
+        });
+
+        return () => {
+            if (disable !== null) {
+                disable();
+            }
+        };
+    }, [selectedTestIndex, testData]);
+
+    // submissions are saved by the app first and uploaded in the background
+    useEffect(() => {
+        fetch(server.base_url + "/get-sync-status")
+            .then(r => r.json())
+            .then((statuses: types.TSubmissionStatus[]) => {
+                setSyncStatus(prev => {
+                    let next = { ...prev };
+                    for (let status of statuses) {
+                        next[status.TestId] = status;
+                    }
+                    return next;
+                });
+            })
+            .catch(err => console.error("could not get sync status:", err));
+
+        let disable: (() => PromiseLike<void>) | null = null;
+        server.server.add_callback(types.Varient.SubmissionStatus, async (res) => {
+            setSyncStatus(prev => ({ ...prev, [res.TestId]: res }));
+        }).then(d => {
+            disable = d;
+        });
+
+        return () => {
+            if (disable !== null) {
+                disable();
+            }
+        };
+    }, []);
+
+    const isSubmitted = (testId: string) => completedTests.includes(testId) || syncStatus[testId] !== undefined;
+
+    // tests with a last_wins or multiple policy stay open after they are submitted
+    const isCompleted = (test: types.CandidateTest) => {
+        switch (test.SubmissionPolicy) {
+            case types.SubmissionPolicy.SubmitLastWins:
+            case types.SubmissionPolicy.SubmitMultiple:
+                return false;
+            default:
+                return isSubmitted(test.Id);
+        }
+    };
+
+    const renderSyncStatus = (testId: string) => {
+        const status = syncStatus[testId];
+        if (status === undefined) {
+            return completedTests.includes(testId) && <CheckCircle className="ml-2 text-green-500" size={16} />;
+        }
+        switch (status.Status) {
+            case types.SyncStatus.Uploaded:
+                return <CheckCircle className="ml-2 text-green-500" size={16} />;
+            case types.SyncStatus.Queued:
+                return (
+                    <span className="ml-2 flex items-center text-xs text-amber-600" title={status.Message || "Saved locally, waiting for the server"}>
+                        <CloudUpload size={16} className="mr-1" /> saved locally
+                    </span>
+                );
+            case types.SyncStatus.Rejected:
+                return (
+                    <span className="ml-2 flex items-center text-xs text-red-600" title={status.Message}>
+                        <AlertTriangle size={16} className="mr-1" /> not accepted
+                    </span>
+                );
+        }
+    };
+
+    const formatTime = (seconds: number | null) => {
+        if (seconds === null) {
+            return "--:--";
+        }
         const minutes = Math.floor(seconds / 60);
         const remainingSeconds = seconds % 60;
         return `${minutes.toString().padStart(2, '0')}:${remainingSeconds.toString().padStart(2, '0')}`;
@@ -152,18 +254,16 @@ export default function TestsPage() {
                     className="bg-gray-100 p-4 overflow-y-auto"
                 >
                     <h2 className="text-xl font-bold mb-4">Tests</h2>
-                    {testData.map((test: types.Test, index:number) => (
+                    {testData.map((test: types.CandidateTest, index:number) => (
                         <Button
                             key={test.Id}
                             onClick={() => !isTestActive && setSelectedTestIndex(index)}
                             variant={selectedTestIndex === index ? 'default' : 'outline'}
                             className={`w-full mb-2 justify-start text-left whitespace-normal ${isTestActive ? 'opacity-50 cursor-not-allowed' : ''}`}
-                            disabled={completedTests.includes(test.Id) || isTestActive}
+                            disabled={isCompleted(test) || isTestActive}
                         >
                             <span className="truncate flex-grow">{test.TestName}</span>
-                            {completedTests.includes(test.Id) && (
-                                <CheckCircle className="ml-2 text-green-500" size={16} />
-                            )}
+                            {renderSyncStatus(test.Id)}
                         </Button>
                     ))}
                 </div>